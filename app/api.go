@@ -0,0 +1,149 @@
+package bridge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// apiEntitiesPath is the prefix of POST /api/entities/{key}.
+const apiEntitiesPath = "/api/entities/"
+
+// apiEntity is an entity as listed by GET /api/entities.
+type apiEntity struct {
+	Key       string            `json:"key"`
+	Component string            `json:"component"`
+	Settable  bool              `json:"settable"`
+	Options   []string          `json:"options,omitempty"`
+	Config    map[string]string `json:"config"`
+}
+
+// apiHandler serves the REST API. Every request must carry the token as
+// "Authorization: Bearer <token>". Set requests are queued for the publish
+// loop like MQTT commands.
+func apiHandler(token string, states *stateStore, commands *commandQueue) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/state", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(rw, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		values := make(map[string]string)
+		for _, state := range states.all() {
+			values[state.Key] = state.Value
+		}
+		apiJSON(rw, http.StatusOK, values)
+	})
+
+	mux.HandleFunc("/api/entities", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(rw, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		entities := []apiEntity{}
+		for _, state := range states.all() {
+			entities = append(entities, apiEntity{
+				Key:       state.Key,
+				Component: state.Component,
+				Settable:  state.Settable,
+				Options:   state.Options,
+				Config:    state.Config,
+			})
+		}
+		apiJSON(rw, http.StatusOK, entities)
+	})
+
+	mux.HandleFunc(apiEntitiesPath, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiError(rw, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, apiEntitiesPath)
+		if !commands.settable(key) {
+			apiError(rw, http.StatusNotFound, fmt.Sprintf("no settable entity %q", key))
+			return
+		}
+		value, err := apiValue(r)
+		if err != nil {
+			apiError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		apiLog.Infof("Setting %s %s", key, value)
+		if err := commands.submit(key, value); err != nil {
+			apiError(rw, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		apiJSON(rw, http.StatusAccepted, map[string]string{"key": key, "value": value})
+	})
+
+	return requireToken(token, false, mux)
+}
+
+// requireToken rejects requests without the token. With allowQuery the
+// token may also be passed as ?token=, for clients such as EventSource that
+// cannot set headers.
+func requireToken(token string, allowQuery bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		given := ""
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			given = strings.TrimPrefix(authorization, "Bearer ")
+		} else if allowQuery {
+			given = r.URL.Query().Get("token")
+		}
+		if !validAPIToken(token, given) {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			apiError(rw, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+func validAPIToken(token, given string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// apiValue reads the value to set: {"value": ...} for JSON requests,
+// otherwise the plain body.
+func apiValue(r *http.Request) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var request struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil || request.Value == nil {
+			return "", fmt.Errorf(`expected {"value": ...}`)
+		}
+		var s string
+		if err := json.Unmarshal(request.Value, &s); err == nil {
+			return s, nil
+		}
+		// Numbers and booleans are passed on as written.
+		return string(request.Value), nil
+	}
+	value := strings.TrimSpace(string(body))
+	if value == "" {
+		return "", fmt.Errorf("empty value")
+	}
+	return value, nil
+}
+
+func apiJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		apiLog.Errorf("Failed to write response: %v", err)
+	}
+}
+
+func apiError(rw http.ResponseWriter, status int, message string) {
+	apiJSON(rw, status, map[string]string{"error": message})
+}
@@ -0,0 +1,122 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPI() (http.Handler, *commandQueue, map[string]string) {
+	set := make(map[string]string)
+	states := newStateStore()
+	now := time.Now()
+	lock := Entity{Component: "lock", Setter: func(v string) { set["lock"] = v }, Config: map[string]string{"name": "Lock"}}
+	states.update("lock", lock, "0", nil, now)
+	states.update("charging_power", Entity{Component: "sensor", Config: map[string]string{"name": "Charging power"}}, "2300", nil, now)
+
+	setters := map[string]func(string){
+		"lock":                 lock.Setter,
+		"max_charging_current": func(v string) { set["max_charging_current"] = v },
+	}
+	commands := newCommandQueue(setters)
+	return apiHandler("secret", states, commands), commands, set
+}
+
+// applyQueued runs the queued commands as the publish loop does.
+func applyQueued(commands *commandQueue) {
+	for {
+		select {
+		case cmd := <-commands.commands():
+			commands.apply(cmd)
+		default:
+			return
+		}
+	}
+}
+
+func serveAPI(h http.Handler, method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	h, _, _ := newTestAPI()
+	for _, token := range []string{"", "wrong"} {
+		if rec := serveAPI(h, "GET", "/api/state", token, "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	if validAPIToken("", "") {
+		t.Errorf("an empty configured token must never match")
+	}
+}
+
+func TestAPIState(t *testing.T) {
+	h, _, _ := newTestAPI()
+	rec := serveAPI(h, "GET", "/api/state", "secret", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var state map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state["charging_power"] != "2300" || state["lock"] != "0" {
+		t.Fatalf("state = %v", state)
+	}
+}
+
+func TestAPIEntities(t *testing.T) {
+	h, _, _ := newTestAPI()
+	rec := serveAPI(h, "GET", "/api/entities", "secret", "", "")
+	var entities []apiEntity
+	if err := json.Unmarshal(rec.Body.Bytes(), &entities); err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 || entities[1].Key != "lock" || !entities[1].Settable || entities[1].Config["name"] != "Lock" {
+		t.Fatalf("entities = %+v", entities)
+	}
+}
+
+func TestAPISetEntity(t *testing.T) {
+	h, commands, set := newTestAPI()
+
+	if rec := serveAPI(h, "POST", "/api/entities/lock", "secret", "text/plain", "1\n"); rec.Code != http.StatusAccepted {
+		t.Fatalf("plain body: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serveAPI(h, "POST", "/api/entities/max_charging_current", "secret", "application/json", `{"value": 16}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("JSON body: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(set) != 0 {
+		t.Fatalf("setters ran on the HTTP goroutine: %v", set)
+	}
+	applyQueued(commands)
+	if set["lock"] != "1" || set["max_charging_current"] != "16" {
+		t.Fatalf("setters got %v", set)
+	}
+
+	for _, tc := range []struct {
+		method, path, contentType, body string
+		want                            int
+	}{
+		{"POST", "/api/entities/charging_power", "", "1", http.StatusNotFound},
+		{"POST", "/api/entities/lock", "", "", http.StatusBadRequest},
+		{"POST", "/api/entities/lock", "application/json", `{"state": 1}`, http.StatusBadRequest},
+		{"GET", "/api/entities/lock", "", "", http.StatusMethodNotAllowed},
+	} {
+		if rec := serveAPI(h, tc.method, tc.path, "secret", tc.contentType, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s %q: status %d, want %d", tc.method, tc.path, tc.body, rec.Code, tc.want)
+		}
+	}
+}
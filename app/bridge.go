@@ -3,15 +3,22 @@ package bridge
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"reflect"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"wallbox-mqtt-bridge/app/dashboard"
+	"wallbox-mqtt-bridge/app/heal"
+	"wallbox-mqtt-bridge/app/logging"
+	"wallbox-mqtt-bridge/app/ratelimit"
+	"wallbox-mqtt-bridge/app/system"
 	"wallbox-mqtt-bridge/app/wallbox"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -21,188 +28,249 @@ var (
 	buildVersion = "dev"
 )
 
-var connectLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
-	panic("Connection to MQTT lost")
+// RunOptions changes how RunBridge runs.
+type RunOptions struct {
+	// Once exits after the first polling cycle has been published.
+	Once bool
+	// LogLevel overrides the [log] level unless empty.
+	LogLevel string
 }
 
-func RunBridge(configPath string) {
-	c := LoadConfig(configPath)
-	if c.Settings.OCPPMismatchSeconds == 0 {
-		c.Settings.OCPPMismatchSeconds = 60
+func RunBridge(configPath string, opts RunOptions) {
+	c, err := loadBridgeConfig(configPath)
+	if err != nil {
+		panic(err)
 	}
-	if c.Settings.OCPPRestartCooldown == 0 {
-		c.Settings.OCPPRestartCooldown = 600
+	// Entries are forwarded from the start and published once connected.
+	logs := newLogForwarder()
+	logging.SetForwarder(configureLogging(c, opts.LogLevel), logs.forward)
+
+	// Every charger runs on its own, with its own MQTT connection, until
+	// interrupted. The other chargers are connected in the background, so
+	// one that cannot be reached does not hold up the rest; the site device
+	// adds them as they connect.
+	local := bridgeCharger{w: wallbox.New()}
+	connected := make(chan bridgeCharger, len(c.Chargers))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runCharger(configPath, opts, c, local, logs)
+	}()
+	for _, cc := range c.Chargers {
+		cc := cc
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			charger, ok := connectRemote(cc, opts.Once)
+			if !ok {
+				return
+			}
+			connected <- charger
+			config, _ := chargerConfig(c, charger.name)
+			runCharger(configPath, opts, config, charger, nil)
+		}()
 	}
-	if c.Settings.OCPPMaxRestarts <= 0 {
-		// Default to a small number of restart attempts before either giving up
-		// or escalating to a full reboot (if enabled).
-		c.Settings.OCPPMaxRestarts = 3
+	if len(c.Chargers) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSite(c, local, connected, opts)
+		}()
 	}
-	if c.Settings.PilotErrorSeconds == 0 {
-		c.Settings.PilotErrorSeconds = 300
+	wg.Wait()
+}
+
+// connectBroker connects to the broker of c with availabilityTopic as the
+// will. A lost connection is re-established in the background; availability
+// is then reported online again. onConnect, if set, is called on every
+// connection and told whether it is a reconnect.
+func connectBroker(c *WallboxConfig, availabilityTopic string, onConnect func(client mqtt.Client, reconnected bool)) (mqtt.Client, error) {
+	broker := fmt.Sprintf("tcp://%s:%d", c.MQTT.Host, c.MQTT.Port)
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(broker)
+	opts.SetUsername(c.MQTT.Username)
+	opts.SetPassword(c.MQTT.Password)
+	opts.SetWill(availabilityTopic, "offline", 1, true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		mqttLog.Warnf("Connection to %s lost, reconnecting: %v", broker, err)
+	})
+	var connects int32
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		reconnected := atomic.AddInt32(&connects, 1) > 1
+		if reconnected {
+			mqttLog.Infof("Reconnected to %s", broker)
+			client.Publish(availabilityTopic, 1, true, "online").Wait()
+		}
+		if onConnect != nil {
+			onConnect(client, reconnected)
+		}
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
 	}
+	return client, nil
+}
 
-	w := wallbox.New()
-	w.RefreshData()
+// runCharger publishes charger with the configuration c, as it applies to
+// the charger, until interrupted. logs is nil unless the charger publishes
+// the forwarded log entries.
+func runCharger(configPath string, opts RunOptions, c *WallboxConfig, charger bridgeCharger, logs *logForwarder) {
+	w := charger.w
+	if err := w.RefreshData(); err != nil {
+		bridgeLog.Warnf("Cannot poll the charger: %v", err)
+	}
 	w.StartRedisSubscriptions()
-	w.StartOCPPJournalWatcher()
 	defer w.StopRedisSubscriptions()
-	defer w.StopOCPPJournalWatcher()
+	if charger.name == "" {
+		// The OCPP journal can only be read on the charger itself.
+		w.StartOCPPJournalWatcher()
+		defer w.StopOCPPJournalWatcher()
+	}
 
 	serialNumber := w.SerialNumber()
 	firmwareVersion := w.FirmwareVersion()
 	entityConfig := getEntities(w)
-	if c.Settings.DebugSensors {
-		for k, v := range getDebugEntities(w) {
-			entityConfig[k] = v
-		}
-		for k, v := range getTelemetryEventEntities(w) {
-			entityConfig[k] = v
-		}
-	}
-
-	if c.Settings.PowerBoostEnabled {
-		for k, v := range getPowerBoostEntities(w, c) {
-			entityConfig[k] = v
-		}
-	}
-
-	ocppMismatchState := "0"
-	ocppLastRestart := "never"
-	ocppLastHealAction := "idle"
-	ocppLastHealAt := "never"
-	ocppLastHealDetail := ""
-	var mismatchStart time.Time
-	var lastRestart time.Time
-	var ocppRestartCount int
-	var lastFullReboot time.Time
-	var pilotErrorStart time.Time
-	var lastPilotErrorReboot time.Time
-
-	entityConfig["ocpp_mismatch"] = Entity{
-		Component: "binary_sensor",
-		Getter:    func() string { return ocppMismatchState },
-		Config: map[string]string{
-			"name":            "OCPP mismatch",
-			"payload_on":      "1",
-			"payload_off":     "0",
-			"device_class":    "problem",
-			"entity_category": "diagnostic",
-		},
-	}
-
-	entityConfig["ocpp_last_restart"] = Entity{
-		Component: "sensor",
-		Getter:    func() string { return ocppLastRestart },
-		Config: map[string]string{
-			"name":            "OCPP last restart",
-			"entity_category": "diagnostic",
-		},
-	}
-
-	entityConfig["ocpp_enabled"] = Entity{
-		Component: "binary_sensor",
-		Getter:    w.OCPPEnabled,
-		Config: map[string]string{
-			"name":         "OCPP enabled",
-			"payload_on":   "1",
-			"payload_off":  "0",
-			"device_class": "power",
-		},
-	}
-
-	entityConfig["ocpp_connected"] = Entity{
-		Component: "binary_sensor",
-		Getter:    w.OCPPConnected,
-		Config: map[string]string{
-			"name":         "OCPP connected",
-			"payload_on":   "1",
-			"payload_off":  "0",
-			"device_class": "connectivity",
-		},
-	}
-
-	entityConfig["ocpp_last_heal_action"] = Entity{
-		Component: "sensor",
-		Getter:    func() string { return ocppLastHealAction },
-		Config: map[string]string{
-			"name":            "OCPP last heal action",
-			"entity_category": "diagnostic",
-		},
-	}
-
-	entityConfig["ocpp_last_heal_at"] = Entity{
-		Component: "sensor",
-		Getter:    func() string { return ocppLastHealAt },
-		Config: map[string]string{
-			"name":            "OCPP last heal at",
-			"entity_category": "diagnostic",
-		},
-	}
-
-	entityConfig["ocpp_last_heal_detail"] = Entity{
-		Component: "sensor",
-		Getter: func() string {
-			if ocppLastHealDetail == "" {
-				return "none"
-			}
-			return ocppLastHealDetail
-		},
-		Config: map[string]string{
-			"name":            "OCPP last heal detail",
-			"entity_category": "diagnostic",
-		},
-	}
+	services := newServiceMonitor(c)
 
+	bridgeMetrics := newBridgeMetrics(serialNumber)
 	topicPrefix := "wallbox_" + serialNumber
 	availabilityTopic := topicPrefix + "/availability"
+	healEventTopic := topicPrefix + "/heal/event"
+	var client mqtt.Client
 
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", c.MQTT.Host, c.MQTT.Port))
-	opts.SetUsername(c.MQTT.Username)
-	opts.SetPassword(c.MQTT.Password)
-	opts.SetWill(availabilityTopic, "offline", 1, true)
-	opts.OnConnectionLost = connectLostHandler
+	ocpp := newOCPPRuntime()
 
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		panic(token.Error())
+	// startHealEngine creates the engine for c and publishes its actions. A
+	// reload creates it again when it switches dry run or the state file.
+	startHealEngine := func(c *WallboxConfig, rules []heal.Rule) {
+		engine := newHealEngine(c, w, rules)
+		for _, entry := range engine.History() {
+			ocpp.recordHeal(entry)
+		}
+
+		engine.OnOutcome = func(o heal.Outcome) {
+			history := engine.History()
+			entry := history[len(history)-1]
+			ocpp.recordHeal(entry)
+			bridgeMetrics.healed(entry.Rule, string(entry.Action))
+			event := map[string]interface{}{
+				"event_type": "action_executed",
+				"rule":       entry.Rule,
+				"action":     entry.Action,
+				"label":      entry.Label,
+				"detail":     entry.Detail,
+				"attempt":    entry.Attempt,
+				"at":         entry.At.Format(time.RFC3339),
+				"held_s":     int(o.Held.Seconds()),
+				"dry_run":    c.Settings.HealDryRun,
+			}
+			if entry.Error != "" {
+				event["error"] = entry.Error
+			}
+			payload, _ := json.Marshal(event)
+			client.Publish(healEventTopic, 1, false, payload)
+		}
+		ocpp.heal = engine
 	}
 
+	healRules, err := buildHealRules(c)
+	if err != nil {
+		panic(err)
+	}
+	startHealEngine(c, healRules)
+
+	for k, v := range getOCPPEntities(w, ocpp) {
+		entityConfig[k] = v
+	}
+
+	// The entities c switches on are kept apart from the others, so that a
+	// reload can add and remove them.
+	baseEntities := entityConfig
+	entityConfig = withConfigEntities(baseEntities, c, w, services, logs)
+	// uncatalogued holds the uncatalogued telemetry entities exposed so far.
+	uncatalogued := make(map[string]bool)
+
+	states := newStateStore()
+
+	// MQTT and API commands are queued for the publish loop, which runs
+	// the setters and then polls to publish the result right away.
+	setters := make(map[string]func(string))
 	for key, val := range entityConfig {
-		component := val.Component
-		uid := serialNumber + "_" + key
-		config := map[string]interface{}{
-			"~":                  topicPrefix + "/" + key,
-			"availability_topic": availabilityTopic,
-			"state_topic":        "~/state",
-			"unique_id":          uid,
-			"device": map[string]string{
-				"identifiers": serialNumber,
-				"name":        c.Settings.DeviceName,
-				"sw_version":  fmt.Sprintf("%s (FW %s)", bridgeVersion(), firmwareVersion),
-			},
-		}
 		if val.Setter != nil {
-			config["command_topic"] = "~/set"
-		}
-		if component == "select" {
-			// Home Assistant MQTT discovery requires an "options" field for select entities.
-			// Always include it, even if empty, to ensure the entity is created.
-			if val.Options != nil {
-				config["options"] = val.Options
-			} else {
-				config["options"] = []string{}
+			setters[key] = val.Setter
+		}
+	}
+	commands := newCommandQueue(setters)
+	messageHandler := mqttCommandHandler(commands)
+
+	// unreachable is 1 while polling the charger fails; it is then
+	// reported offline.
+	var unreachable int32
+
+	// The broker forgets the subscription when the connection drops, so
+	// it is renewed on every reconnect.
+	connectMQTT := func(c *WallboxConfig) (mqtt.Client, error) {
+		return connectBroker(c, availabilityTopic, func(client mqtt.Client, reconnected bool) {
+			bridgeMetrics.connected()
+			if reconnected {
+				client.Subscribe(topicPrefix+"/+/set", 1, messageHandler)
+				if atomic.LoadInt32(&unreachable) == 1 {
+					client.Publish(availabilityTopic, 1, true, "offline").Wait()
+				}
 			}
+		})
+	}
+	if client, err = connectMQTT(c); err != nil {
+		panic(err)
+	}
+
+	device := func() discoveryDevice {
+		return discoveryDevice{Serial: serialNumber, Name: c.Settings.DeviceName, Firmware: firmwareVersion}
+	}
+	publishDiscovery := func(key string, val Entity) {
+		client.Publish(discoveryTopic(device(), key, val), 1, true, discoveryConfig(device(), key, val)).Wait()
+	}
+	// publishEventDiscovery announces the event entities and device
+	// triggers, which the publish loop does not evaluate.
+	publishEventDiscovery := func() {
+		for key, val := range eventEntities() {
+			publishDiscovery(key, val)
 		}
-		for k, v := range val.Config {
-			config[k] = v
+		for topic, config := range deviceTriggerDiscovery(device()) {
+			client.Publish(topic, 1, true, config).Wait()
 		}
-		jsonPayload, _ := json.Marshal(config)
-		token := client.Publish("homeassistant/"+component+"/"+uid+"/config", 1, true, jsonPayload)
-		token.Wait()
 	}
 
+	// removeDiscovery removes an entity from Home Assistant and clears its
+	// retained topics.
+	removeDiscovery := func(key string, val Entity) {
+		client.Publish(discoveryTopic(device(), key, val), 1, true, []byte{}).Wait()
+		client.Publish(topicPrefix+"/"+key+"/state", 1, true, []byte{}).Wait()
+		if val.Attributes != nil {
+			client.Publish(topicPrefix+"/"+key+"/attributes", 1, true, []byte{}).Wait()
+		}
+	}
+
+	// announce publishes discovery and availability and subscribes to the
+	// command topics, on startup and after switching brokers.
+	announce := func() {
+		for key, val := range entityConfig {
+			publishDiscovery(key, val)
+		}
+		publishEventDiscovery()
+		availability := "online"
+		if atomic.LoadInt32(&unreachable) == 1 {
+			availability = "offline"
+		}
+		client.Publish(availabilityTopic, 1, true, availability).Wait()
+		client.Subscribe(topicPrefix+"/+/set", 1, messageHandler)
+	}
+	announce()
+
 	if entity, ok := entityConfig["user_id_select"]; ok {
 		w.SetSelectedUserId(w.UserId())
 		payload := entity.Getter()
@@ -210,190 +278,486 @@ func RunBridge(configPath string) {
 		client.Publish(topicPrefix+"/user_id_select/state", 1, true, bytePayload).Wait()
 	}
 
-	token := client.Publish(availabilityTopic, 1, true, "online")
-	token.Wait()
-
-	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
-		field := strings.Split(msg.Topic(), "/")[1]
-		payload := string(msg.Payload())
-		setter := entityConfig[field].Setter
-		fmt.Println("Setting", field, payload)
-		setter(payload)
+	if c.HTTP.Listen != "" {
+		mux := http.NewServeMux()
+		if c.HTTP.Metrics {
+			mux.Handle("/metrics", metricsHandler(bridgeMetrics, w, states))
+		}
+		// LoadConfig makes sure these have a token.
+		if c.HTTP.API || c.HTTP.Dashboard {
+			mux.Handle("/api/", apiHandler(c.HTTP.Token, states, commands))
+			if c.HTTP.Dashboard {
+				mux.Handle("/api/events", requireToken(c.HTTP.Token, true, dashboardEventsHandler(serialNumber, w, states)))
+				mux.Handle("/", dashboard.Handler())
+			}
+		}
+		if c.HTTP.ConfigEditor {
+			editor := &configEditor{
+				path:      configPath,
+				token:     c.HTTP.Token,
+				testMQTT:  testMQTTConnection,
+				savedHint: "The bridge applies it within a few seconds.",
+			}
+			mux.Handle("/config/", requireToken(c.HTTP.Token, true, editor))
+		}
+		server := startHTTPServer(c.HTTP.Listen, mux)
+		defer server.Close()
 	}
 
-	topic := topicPrefix + "/+/set"
-	client.Subscribe(topic, 1, messageHandler)
-
+	// The Redis hashes and MySQL are polled on the polling interval. Telemetry,
+	// session and journal events publish the entities depending on them as
+	// soon as they arrive, collected for EventDebounceMilliseconds.
 	ticker := time.NewTicker(time.Duration(c.Settings.PollingIntervalSeconds) * time.Second)
 	defer ticker.Stop()
+	debounce := time.Duration(c.Settings.EventDebounceMilliseconds) * time.Millisecond
+	var debounceC <-chan time.Time
 
-	published := make(map[string]interface{})
+	policies, err := publishPolicies(c, entityConfig)
+	if err != nil {
+		panic(err)
+	}
+	publishers := make(map[string]*ratelimit.Publisher)
+	publishedAttributes := make(map[string]string)
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
-	for {
-		select {
-		case <-ticker.C:
-			w.RefreshData()
-			now := time.Now()
-
-			pilotConnected := w.HasTelemetry && (w.CableConnected() == 1 || w.IsChargingPilot())
-			ocppCode := w.OCPPStatusCode()
-			ocppIndicatesDisconnect := w.OCPPIndicatesDisconnect()
-
-			if pilotConnected && ocppIndicatesDisconnect {
-				if mismatchStart.IsZero() {
-					mismatchStart = now
-					ocppRestartCount = 0
-					log.Printf("OCPP mismatch detected: pilot=%d (%s), OCPP=%d (%s)", w.ControlPilotCode(), w.ControlPilotStatus(), ocppCode, w.OCPPStatusDescription())
-				}
-				ocppMismatchState = "1"
-			} else {
-				if ocppMismatchState != "0" {
-					log.Println("OCPP mismatch cleared")
-				}
-				ocppMismatchState = "0"
-				mismatchStart = time.Time{}
-				ocppRestartCount = 0
+	// The config file is applied again on SIGHUP and whenever it changes.
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	configChanged := watchConfigFile(configPath, configWatchInterval, watchDone)
+
+	publishState := func(key, payload string) {
+		mqttLog.Debugf("Publishing %s %s", key, payload)
+		token := client.Publish(topicPrefix+"/"+key+"/state", 1, true, []byte(payload))
+		token.Wait()
+		bridgeMetrics.published()
+	}
+
+	// A held back value is flushed when its rate limit allows, without
+	// waiting for the state to change again.
+	var flushTimer *time.Timer
+	var flushC <-chan time.Time
+	scheduleFlush := func() {
+		var next time.Time
+		for _, publisher := range publishers {
+			if at, ok := publisher.FlushAt(); ok && (next.IsZero() || at.Before(next)) {
+				next = at
 			}
+		}
+		if flushTimer != nil {
+			flushTimer.Stop()
+		}
+		flushC = nil
+		if !next.IsZero() {
+			flushTimer = time.NewTimer(time.Until(next))
+			flushC = flushTimer.C
+		}
+	}
 
-			if c.Settings.AutoRestartOCPP && ocppMismatchState == "1" && !mismatchStart.IsZero() {
-				threshold := time.Duration(c.Settings.OCPPMismatchSeconds) * time.Second
-				cooldown := time.Duration(c.Settings.OCPPRestartCooldown) * time.Second
-
-				if now.Sub(mismatchStart) >= threshold && (lastRestart.IsZero() || now.Sub(lastRestart) >= cooldown) {
-					// First try a bounded number of OCPP service restarts. If
-					// those do not clear the mismatch and full reboot is
-					// enabled, we can optionally escalate to a complete
-					// Wallbox reboot as a last resort.
-					if c.Settings.OCPPMaxRestarts == 0 || ocppRestartCount < c.Settings.OCPPMaxRestarts {
-						log.Printf("Restarting ocppwallbox.service after %s mismatch (OCPP %d: %s) [attempt %d/%d]",
-							now.Sub(mismatchStart).Round(time.Second), ocppCode, w.OCPPStatusDescription(), ocppRestartCount+1, c.Settings.OCPPMaxRestarts)
-						action, detail, err := restartCriticalServices()
-						ocppLastHealAction = action
-						ocppLastHealDetail = detail
-						ocppLastHealAt = now.Format(time.RFC3339)
-						if err != nil {
-							log.Printf("Failed to restart charging stack: %v", err)
-							continue
-						}
-						ocppRestartCount++
-						lastRestart = now
-						mismatchStart = now
-						ocppLastRestart = now.Format(time.RFC3339)
-					} else if c.Settings.OCPPFullReboot {
-						// Only perform a full reboot if we have not recently done so.
-						if lastFullReboot.IsZero() || now.Sub(lastFullReboot) >= cooldown {
-							log.Printf("Escalating to full system reboot after %d failed OCPP restart attempts and %s mismatch (OCPP %d: %s)",
-								ocppRestartCount, now.Sub(mismatchStart).Round(time.Second), ocppCode, w.OCPPStatusDescription())
-							go func() {
-								if err := rebootSystem(); err != nil {
-									log.Printf("Failed to reboot system for OCPP heal: %v", err)
-								}
-							}()
-							lastFullReboot = now
-						}
-					}
+	publishEntities := func(sources wallbox.Source) {
+		now := time.Now()
+		for key, val := range entityConfig {
+			if val.Sources != 0 && val.Sources&sources == 0 {
+				continue
+			}
+			var attributes []byte
+			if val.Attributes != nil {
+				attributes, _ = json.Marshal(val.Attributes())
+				if publishedAttributes[key] != string(attributes) {
+					client.Publish(topicPrefix+"/"+key+"/attributes", 1, true, attributes).Wait()
+					publishedAttributes[key] = string(attributes)
 				}
 			}
+			publisher, ok := publishers[key]
+			if !ok {
+				publisher = newEntityPublisher(policies, key, val)
+				publishers[key] = publisher
+			}
+			value := val.Getter()
+			states.update(key, val, value, attributes, now)
+			payload, ok := publisher.Publish(now, value)
+			if !ok {
+				continue
+			}
+			publishState(key, payload)
+		}
+		scheduleFlush()
+	}
 
-			// Independent safety net: if control pilot reports error state 14 for a sustained period, reboot.
-			if c.Settings.PilotErrorReboot {
-				if w.ControlPilotCode() == 14 {
-					if pilotErrorStart.IsZero() {
-						pilotErrorStart = now
-						log.Printf("Control pilot entered error state 14; starting reboot timer (%ds)", c.Settings.PilotErrorSeconds)
-					}
-					if now.Sub(pilotErrorStart) >= time.Duration(c.Settings.PilotErrorSeconds)*time.Second {
-						if lastPilotErrorReboot.IsZero() || now.Sub(lastPilotErrorReboot) >= time.Duration(c.Settings.PilotErrorSeconds)*time.Second {
-							log.Printf("Rebooting due to sustained control pilot error state 14 for %s", now.Sub(pilotErrorStart).Round(time.Second))
-							go func() {
-								if err := rebootSystem(); err != nil {
-									log.Printf("Failed to reboot after control pilot error: %v", err)
-								}
-							}()
-							lastPilotErrorReboot = now
-							pilotErrorStart = time.Time{}
-						}
-					}
+	events := &eventDetector{user: w.SelectedUserId}
+	publishEvents := func() {
+		for _, event := range events.detect(sampleEvents(w, ocpp.mismatch == "1")) {
+			mqttLog.Infof("Event %s %s", event.Group, event.Type)
+			client.Publish(event.topic(device()), 1, false, event.payload()).Wait()
+		}
+	}
+
+	// flushHeldBack publishes the values held back by rate limits whose
+	// interval has passed.
+	flushHeldBack := func() {
+		now := time.Now()
+		for key, publisher := range publishers {
+			if payload, ok := publisher.Flush(now); ok {
+				publishState(key, payload)
+			}
+		}
+		scheduleFlush()
+	}
+
+	// reload applies the config file again. Nothing changes unless the new
+	// configuration is valid and, if the broker changed, connects.
+	reload := func() {
+		next, err := reloadConfig(configPath, charger.name)
+		if err != nil {
+			configLog.Errorf("Reload failed, keeping the current configuration: %v", err)
+			return
+		}
+		nextRules, err := buildHealRules(next)
+		if err != nil {
+			configLog.Errorf("Reload failed, keeping the current configuration: %v", err)
+			return
+		}
+		nextServices := services
+		if next.Settings.ServiceHealth != c.Settings.ServiceHealth ||
+			next.Settings.ServiceLeakWindowMinutes != c.Settings.ServiceLeakWindowMinutes ||
+			next.Settings.ServiceLeakGrowthPercent != c.Settings.ServiceLeakGrowthPercent {
+			nextServices = newServiceMonitor(next)
+		}
+		nextEntities := withConfigEntities(baseEntities, next, w, nextServices, logs)
+		if next.Settings.UncataloguedTelemetry {
+			for key := range uncatalogued {
+				nextEntities[key] = entityConfig[key]
+			}
+		}
+		nextPolicies, err := publishPolicies(next, nextEntities)
+		if err != nil {
+			configLog.Errorf("Reload failed, keeping the current configuration: %v", err)
+			return
+		}
+		var nextClient mqtt.Client
+		if next.MQTT != c.MQTT {
+			configLog.Infof("MQTT broker settings changed, connecting to %s:%d", next.MQTT.Host, next.MQTT.Port)
+			if nextClient, err = connectMQTT(next); err != nil {
+				configLog.Errorf("Reload failed, keeping the current configuration: %v", err)
+				return
+			}
+		}
+		if next.HTTP != c.HTTP {
+			configLog.Warnf("Changes to [http] apply after a restart")
+		}
+		if !sameChargers(next, c) {
+			configLog.Warnf("Adding, removing or moving chargers applies after a restart")
+		}
+
+		previous := c
+		c = next
+		if logs != nil {
+			logging.SetForwarder(configureLogging(next, opts.LogLevel), logs.forward)
+		}
+
+		added, removed := diffEntities(entityConfig, nextEntities)
+		for _, key := range removed {
+			configLog.Infof("Removing entity %s", key)
+			removeDiscovery(key, entityConfig[key])
+			delete(publishers, key)
+			delete(publishedAttributes, key)
+			delete(uncatalogued, key)
+			states.remove(key)
+		}
+		entityConfig = nextEntities
+		services = nextServices
+
+		if !reflect.DeepEqual(previous.PublishPolicies, next.PublishPolicies) {
+			publishers = make(map[string]*ratelimit.Publisher)
+		}
+		policies = nextPolicies
+
+		switch {
+		case nextClient != nil:
+			client.Publish(availabilityTopic, 1, true, "offline").Wait()
+			client.Disconnect(250)
+			client = nextClient
+			// The new broker has none of the retained states yet.
+			publishers = make(map[string]*ratelimit.Publisher)
+			publishedAttributes = make(map[string]string)
+			announce()
+		case next.Settings.DeviceName != previous.Settings.DeviceName:
+			for key, val := range entityConfig {
+				publishDiscovery(key, val)
+			}
+			publishEventDiscovery()
+		default:
+			for _, key := range added {
+				publishDiscovery(key, entityConfig[key])
+			}
+		}
+
+		if next.Settings.HealDryRun != previous.Settings.HealDryRun || next.Settings.HealStateFile != previous.Settings.HealStateFile {
+			startHealEngine(next, nextRules)
+		} else {
+			ocpp.heal.SetRules(nextRules)
+			ocpp.heal.MaxRebootsPerDay = next.Settings.MaxRebootsPerDay
+		}
+
+		if next.Settings.PollingIntervalSeconds != previous.Settings.PollingIntervalSeconds {
+			ticker.Reset(time.Duration(next.Settings.PollingIntervalSeconds) * time.Second)
+		}
+		debounce = time.Duration(next.Settings.EventDebounceMilliseconds) * time.Millisecond
+
+		configLog.Infof("Configuration reloaded: %d entities added, %d removed", len(added), len(removed))
+		publishEntities(wallbox.AllSources)
+	}
+
+	publishAll := true
+	// poll reads the Redis hashes and MySQL, updates the OCPP, service and
+	// heal state and publishes what changed.
+	poll := func() {
+		refreshStart := time.Now()
+		if err := w.RefreshData(); err != nil {
+			if atomic.CompareAndSwapInt32(&unreachable, 0, 1) {
+				bridgeLog.Errorf("Cannot poll the charger, reporting it offline: %v", err)
+				client.Publish(availabilityTopic, 1, true, "offline").Wait()
+			}
+			return
+		}
+		if atomic.CompareAndSwapInt32(&unreachable, 1, 0) {
+			bridgeLog.Infof("Charger can be polled again, reporting it online")
+			client.Publish(availabilityTopic, 1, true, "online").Wait()
+		}
+		bridgeMetrics.refreshed(time.Since(refreshStart))
+		now := time.Now()
+
+		if code := w.OCPPOnlineCode(); code > 0 {
+			if ocpp.health.Observe(now, code == 4, ocppDisconnectReason(w)) {
+				if code == 4 {
+					ocppLog.Infof("Backend %s", describeOCPPConnection(true, ""))
 				} else {
-					pilotErrorStart = time.Time{}
+					ocppLog.Warnf("Backend %s", describeOCPPConnection(false, ocpp.health.LastDisconnectReason()))
 				}
 			}
+		}
 
-			for key, val := range entityConfig {
-				payload := val.Getter()
-				bytePayload := []byte(fmt.Sprint(payload))
-				if published[key] != payload {
-					if val.RateLimit != nil && !val.RateLimit.Allow(strToFloat(payload)) {
-						continue
-					}
-					fmt.Println("Publishing: ", key, payload)
-					token := client.Publish(topicPrefix+"/"+key+"/state", 1, true, bytePayload)
-					token.Wait()
-					published[key] = payload
+		if services != nil {
+			observeServices(w, services, now)
+		}
+
+		ocpp.updateMismatch(w)
+		ocpp.heal.Evaluate(healReadings(w, ocpp.mismatch == "1", services))
+
+		if c.Settings.UncataloguedTelemetry {
+			for _, sensorID := range w.UncataloguedTelemetrySensors() {
+				key := uncataloguedTelemetryEntityKey(sensorID)
+				if _, ok := entityConfig[key]; ok {
+					continue
 				}
+				bridgeLog.Infof("Exposing uncatalogued telemetry sensor %s as %s", sensorID, key)
+				entityConfig[key] = uncataloguedTelemetryEntity(w, sensorID)
+				uncatalogued[key] = true
+				publishDiscovery(key, entityConfig[key])
+				publishAll = true
+			}
+		}
+
+		// Only the entities depending on what changed are published,
+		// including pending events; those without sources depend on
+		// the health state evaluated above. The first poll and new
+		// entities publish everything.
+		sources := w.TakeChanges()
+		if publishAll {
+			sources = wallbox.AllSources
+			publishAll = false
+		}
+		publishEntities(sources)
+		publishEvents()
+	}
+
+	var logEntries <-chan logging.Entry
+	if logs != nil {
+		logEntries = logs.entries
+	}
+
+	shutdown := func() {
+		client.Publish(availabilityTopic, 1, true, "offline").Wait()
+		client.Disconnect(250)
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			poll()
+			if opts.Once {
+				shutdown()
+				return
+			}
+		case <-w.Changes():
+			if debounceC == nil {
+				debounceC = time.After(debounce)
 			}
+		case <-debounceC:
+			debounceC = nil
+			sources := w.TakeChanges()
+			if sources == 0 {
+				continue
+			}
+			ocpp.updateMismatch(w)
+			ocpp.heal.Evaluate(healReadings(w, ocpp.mismatch == "1", services))
+			publishEntities(sources)
+			publishEvents()
+		case cmd := <-commands.commands():
+			commands.apply(cmd)
+			poll()
+		case <-flushC:
+			flushHeldBack()
+		case entry := <-logEntries:
+			payload, _ := json.Marshal(entry)
+			client.Publish(topicPrefix+"/log", 0, false, payload).Wait()
+		case <-reloadSignal:
+			configLog.Infof("SIGHUP received, reloading %s", configPath)
+			reload()
+		case <-configChanged:
+			configLog.Infof("%s changed, reloading", configPath)
+			reload()
 		case <-interrupt:
-			fmt.Println("Interrupted. Exiting...")
-			token := client.Publish(availabilityTopic, 1, true, "offline")
-			token.Wait()
-			client.Disconnect(250)
+			bridgeLog.Infof("Interrupted, exiting")
+			shutdown()
 			return
 		}
 	}
+}
 
-	w.StopRedisSubscriptions()
+// ocppDisconnectReason explains why the OCPP backend is down, telling a charger
+// without network apart from a backend that is unreachable or erroring.
+func ocppDisconnectReason(w *wallbox.Wallbox) string {
+	if w.HasTelemetry() && w.ConnectivityStatus() == "Offline" {
+		return "charger offline (connectivity Offline)"
+	}
+	reason := w.OCPPOnlineDescription()
+	if journal := w.OCPPJournal(); journal.LastErrorCode != "" && time.Since(journal.LastErrorAt) < 5*time.Minute {
+		reason += fmt.Sprintf("; last OCPP error %s", journal.LastErrorCode)
+	}
+	return reason
 }
 
-func restartCriticalServices() (action string, detail string, err error) {
+func describeOCPPConnection(connected bool, reason string) string {
+	if connected {
+		return "connected"
+	}
+	return "disconnected: " + reason
+}
+
+// healExecutor runs heal rule actions against systemd and the Wallbox
+// reboot flow. In dry run mode it only describes what it would have done.
+type healExecutor struct {
+	sys    system.SystemController
+	dryRun bool
+}
+
+func (e healExecutor) Execute(rule heal.Rule, action heal.Action) (string, string, error) {
+	if e.dryRun {
+		detail := describeHealAction(rule, action)
+		healLog.Infof("dry run: %s would %s", rule.Name, detail)
+		return "dry_run_" + string(action), "would " + detail, nil
+	}
+
+	switch action {
+	case heal.RestartService:
+		return restartCriticalServices(e.sys, rule.Service)
+	case heal.RestartDependencies:
+		return restartDependencies(e.sys, rule.Service)
+	case heal.VendorReboot:
+		go func() {
+			if err := rebootSystem(e.sys); err != nil {
+				healLog.Errorf("Failed to reboot system for %s heal: %v", rule.Name, err)
+			}
+		}()
+		return "reboot", "Wallbox reboot.sh issued", nil
+	case heal.SystemReboot:
+		go func() {
+			if err := e.sys.Reboot(); err != nil {
+				healLog.Errorf("Failed to reboot system for %s heal: %v", rule.Name, err)
+			}
+		}()
+		return "reboot", "systemctl reboot issued", nil
+	}
+	return "noop", fmt.Sprintf("unknown action %s", action), fmt.Errorf("unknown heal action %q", action)
+}
+
+func describeHealAction(rule heal.Rule, action heal.Action) string {
+	switch action {
+	case heal.RestartService:
+		return fmt.Sprintf("stop+start %s (falling back to restart, then reboot)", rule.Service)
+	case heal.RestartDependencies:
+		return fmt.Sprintf("restart %s and %s", strings.Join(healDependencies, ", "), rule.Service)
+	case heal.VendorReboot:
+		return "run Wallbox reboot.sh (falling back to systemctl reboot)"
+	case heal.SystemReboot:
+		return "run systemctl reboot"
+	}
+	return fmt.Sprintf("run unknown action %s", action)
+}
+
+// healDependencies are the services the Wallbox charging stack relies on.
+var healDependencies = []string{
+	"redis.service",
+	"mysqld.service",
+}
+
+func restartCriticalServices(sys system.SystemController, svc string) (action string, detail string, err error) {
 	// Basic dependency sanity checks. If Redis/MySQL are down, restarting OCPP
 	// will likely flap; log but do not block the heal.
 	checkService := func(name string) {
-		if err := exec.Command("systemctl", "is-active", "--quiet", name).Run(); err != nil {
-			log.Printf("warning: dependency %s is not active: %v", name, err)
+		if err := sys.ServiceActive(name); err != nil {
+			healLog.Warnf("dependency %s is not active: %v", name, err)
 		}
 	}
-	checkService("redis.service")
-	checkService("mysqld.service")
-
-	services := []string{
-		"ocppwallbox.service",
+	for _, dep := range healDependencies {
+		checkService(dep)
 	}
 
-	for _, svc := range services {
-		// Prefer a graceful stop + start to let the service flush state.
-		stopCmd := exec.Command("systemctl", "stop", svc)
-		startCmd := exec.Command("systemctl", "start", svc)
-
-		stopErr := stopCmd.Run()
-		if stopErr == nil {
-			log.Printf("heal: stopped %s", svc)
-			if startErr := startCmd.Run(); startErr == nil {
-				log.Printf("heal: started %s", svc)
-				return "stop_start", fmt.Sprintf("%s stopped+started", svc), nil
-			}
-			log.Printf("heal: start %s failed after stop, will retry with restart", svc)
-		} else {
-			log.Printf("heal: stop %s failed (%v), will retry with restart", svc, stopErr)
+	// Prefer a graceful stop + start to let the service flush state.
+	stopErr := sys.StopService(svc)
+	if stopErr == nil {
+		healLog.Infof("stopped %s", svc)
+		if startErr := sys.StartService(svc); startErr == nil {
+			healLog.Infof("started %s", svc)
+			return "stop_start", fmt.Sprintf("%s stopped+started", svc), nil
 		}
+		healLog.Warnf("start %s failed after stop, will retry with restart", svc)
+	} else {
+		healLog.Warnf("stop %s failed (%v), will retry with restart", svc, stopErr)
+	}
 
-		// If stop/start fails, fall back to a direct restart.
-		restartCmd := exec.Command("systemctl", "restart", svc)
-		if err := restartCmd.Run(); err != nil {
-			// As a final safeguard, invoke the Wallbox reboot flow.
-			log.Printf("restart %s failed (%v); escalating to full reboot", svc, err)
-			if rebootErr := rebootSystem(); rebootErr != nil {
-				return "reboot", fmt.Sprintf("reboot failed after restart error: %v", rebootErr), rebootErr
-			}
-			return "reboot", "reboot issued after restart failure", nil
+	// If stop/start fails, fall back to a direct restart.
+	if err := sys.RestartService(svc); err != nil {
+		// As a final safeguard, invoke the Wallbox reboot flow.
+		healLog.Errorf("restart %s failed (%v); escalating to full reboot", svc, err)
+		if rebootErr := rebootSystem(sys); rebootErr != nil {
+			return "reboot", fmt.Sprintf("reboot failed after restart error: %v", rebootErr), rebootErr
 		}
-		log.Printf("heal: restarted %s via systemctl restart", svc)
-		return "restart", fmt.Sprintf("%s restarted", svc), nil
+		return "reboot", "reboot issued after restart failure", nil
 	}
+	healLog.Infof("restarted %s via systemctl restart", svc)
+	return "restart", fmt.Sprintf("%s restarted", svc), nil
+}
 
-	return "noop", "no services to restart", nil
+// restartDependencies restarts Redis and MySQL before the service itself, for
+// cases where a plain service restart did not help because its backing stores
+// are wedged.
+func restartDependencies(sys system.SystemController, svc string) (action string, detail string, err error) {
+	for _, dep := range healDependencies {
+		if err := sys.RestartService(dep); err != nil {
+			return "restart_dependencies", fmt.Sprintf("restart %s failed: %v", dep, err), err
+		}
+		healLog.Infof("restarted %s", dep)
+	}
+	if err := sys.RestartService(svc); err != nil {
+		return "restart_dependencies", fmt.Sprintf("restart %s failed: %v", svc, err), err
+	}
+	healLog.Infof("restarted %s", svc)
+	return "restart_dependencies", fmt.Sprintf("%s and %s restarted", strings.Join(healDependencies, ", "), svc), nil
 }
 
 // rebootSystem triggers the Wallbox-provided reboot flow. Prefer the vendor
@@ -401,16 +765,14 @@ func restartCriticalServices() (action string, detail string, err error) {
 // config) and fall back to a raw systemd reboot if unavailable. This is used
 // as an optional last‑resort healing step when repeated service restarts have
 // not cleared a persistent OCPP/pilot mismatch. Use with care.
-func rebootSystem() error {
+func rebootSystem(sys system.SystemController) error {
 	// Preferred: Wallbox official reboot wrapper.
-	scriptCmd := exec.Command("/home/root/.wallbox/reboot.sh")
-	if err := scriptCmd.Run(); err == nil {
+	if err := sys.VendorReboot(); err == nil {
 		return nil
 	}
 
 	// Fallback: direct systemd reboot.
-	cmd := exec.Command("systemctl", "reboot")
-	return cmd.Run()
+	return sys.Reboot()
 }
 
 func bridgeVersion() string {
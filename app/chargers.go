@@ -0,0 +1,139 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"wallbox-mqtt-bridge/app/system"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func (cc ChargerConfig) validate() error {
+	for key, address := range map[string]string{"mysql": cc.MySQL, "redis": cc.Redis} {
+		_, port, err := net.SplitHostPort(address)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			return fmt.Errorf("[%s%s] %s: %q is not host:port", chargerSectionPrefix, cc.Name, key, address)
+		}
+	}
+	return nil
+}
+
+func (cc ChargerConfig) endpoint() wallbox.Endpoint {
+	return wallbox.Endpoint{MySQL: cc.MySQL, Redis: cc.Redis}
+}
+
+// bridgeCharger is a Wallbox the bridge publishes.
+type bridgeCharger struct {
+	w *wallbox.Wallbox
+	// name is its [charger.<name>] section, empty for the charger the
+	// bridge runs on.
+	name string
+}
+
+// How long the bridge waits before trying an unreachable charger again. The
+// wait doubles after every attempt, up to connectRetryMax.
+const (
+	connectRetry    = 5 * time.Second
+	connectRetryMax = 5 * time.Minute
+)
+
+// connectRemote connects to the charger of the [charger.<name>] section cc,
+// retrying until it can be reached. ok is false if the bridge was
+// interrupted first, or with once if the first attempt failed.
+func connectRemote(cc ChargerConfig, once bool) (charger bridgeCharger, ok bool) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	retry := connectRetry
+	for {
+		w, err := wallbox.Connect(cc.endpoint(), system.Unavailable{})
+		if err == nil {
+			return bridgeCharger{w: w, name: cc.Name}, true
+		}
+		if once {
+			bridgeLog.Errorf("Charger %s cannot be reached: %v", cc.Name, err)
+			return bridgeCharger{}, false
+		}
+		bridgeLog.Warnf("Charger %s cannot be reached, retrying in %s: %v", cc.Name, retry, err)
+		select {
+		case <-time.After(retry):
+		case <-interrupt:
+			return bridgeCharger{}, false
+		}
+		if retry *= 2; retry > connectRetryMax {
+			retry = connectRetryMax
+		}
+	}
+}
+
+// chargerConfig returns c as it applies to the charger of the
+// [charger.<name>] section, or c itself for the local charger (empty name).
+// The bridge cannot control the host of another charger, so it gets no heal
+// rules, and the HTTP server only serves the local one. ok is false if c
+// has no such section.
+func chargerConfig(c *WallboxConfig, name string) (config *WallboxConfig, ok bool) {
+	if name == "" {
+		return c, true
+	}
+	for _, cc := range c.Chargers {
+		if cc.Name != name {
+			continue
+		}
+		remote := *c
+		remote.Settings.DeviceName = cc.DeviceName
+		remote.Settings.AutoRestartOCPP = false
+		remote.Settings.PilotErrorReboot = false
+		remote.Settings.ServiceHealthHeal = false
+		remote.Settings.HealStateFile = filepath.Join(filepath.Dir(c.Settings.HealStateFile), "heal_state_"+name+".json")
+		remote.HealRules = nil
+		remote.HTTP.Listen = ""
+		remote.Chargers = nil
+		return &remote, true
+	}
+	return nil, false
+}
+
+// reloadConfig loads the configuration at path again as it applies to the
+// charger of the [charger.<name>] section. Only the local charger logs the
+// warnings, which are the same for every charger.
+func reloadConfig(path, name string) (*WallboxConfig, error) {
+	var c *WallboxConfig
+	var err error
+	if name == "" {
+		c, err = loadBridgeConfig(path)
+	} else {
+		c, _, err = LoadConfig(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config, ok := chargerConfig(c, name)
+	if !ok {
+		return nil, fmt.Errorf("[%s%s] was removed; restart the bridge to stop publishing it", chargerSectionPrefix, name)
+	}
+	return config, nil
+}
+
+// sameChargers reports whether a and b connect to the same chargers. Their
+// device names may differ.
+func sameChargers(a, b *WallboxConfig) bool {
+	if len(a.Chargers) != len(b.Chargers) {
+		return false
+	}
+	for i := range a.Chargers {
+		if a.Chargers[i].Name != b.Chargers[i].Name || a.Chargers[i].endpoint() != b.Chargers[i].endpoint() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package bridge
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func TestLoadConfigChargers(t *testing.T) {
+	c, _, err := LoadConfig(writeConfig(t, `[mqtt]
+host = broker.lan
+
+[settings]
+heal_state_file = /data/heal_state.json
+
+[charger.garage]
+mysql = 192.168.1.21:3306
+redis = 192.168.1.21:6379
+
+[charger.driveway]
+mysql = 192.168.1.22:3306
+redis = 192.168.1.22:6379
+device_name = Driveway
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Chargers) != 2 {
+		t.Fatalf("chargers = %+v", c.Chargers)
+	}
+	garage, ok := chargerConfig(c, "garage")
+	if !ok || garage.Settings.DeviceName != "Wallbox garage" || garage.HealRules != nil ||
+		garage.HTTP.Listen != "" || garage.Settings.AutoRestartOCPP ||
+		garage.Settings.HealStateFile != filepath.Join("/data", "heal_state_garage.json") {
+		t.Fatalf("garage = %+v", garage)
+	}
+	if driveway, _ := chargerConfig(c, "driveway"); driveway.Settings.DeviceName != "Driveway" {
+		t.Fatalf("driveway device name = %q", driveway.Settings.DeviceName)
+	}
+	if local, _ := chargerConfig(c, ""); local != c {
+		t.Fatal("the local charger does not use the configuration as loaded")
+	}
+	if _, ok := chargerConfig(c, "carport"); ok {
+		t.Fatal("found a charger without a section")
+	}
+
+	_, _, err = LoadConfig(writeConfig(t, `[mqtt]
+host = broker.lan
+
+[charger.garage]
+mysql = 192.168.1.21
+redis = 192.168.1.21:6379
+`))
+	if err == nil || !strings.Contains(err.Error(), "[charger.garage] mysql") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSameChargers(t *testing.T) {
+	a := &WallboxConfig{Chargers: []ChargerConfig{{Name: "garage", MySQL: "10.0.0.2:3306", Redis: "10.0.0.2:6379", DeviceName: "Garage"}}}
+	b := &WallboxConfig{Chargers: []ChargerConfig{{Name: "garage", MySQL: "10.0.0.2:3306", Redis: "10.0.0.2:6379", DeviceName: "Car port"}}}
+	if !sameChargers(a, b) {
+		t.Fatal("renaming a charger counted as a different charger")
+	}
+	b.Chargers[0].Redis = "10.0.0.3:6379"
+	if sameChargers(a, b) {
+		t.Fatal("moving a charger counted as the same charger")
+	}
+	if sameChargers(a, &WallboxConfig{}) {
+		t.Fatal("removing a charger counted as the same chargers")
+	}
+}
+
+func TestSiteEntities(t *testing.T) {
+	charging := &wallbox.Wallbox{}
+	charging.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_INTERNAL_METER_VOLTAGE_L1","value":230},
+		{"id":"SENSOR_INTERNAL_METER_CURRENT_L1","value":10}]}}`)
+	entities := getSiteEntities(map[string]*wallbox.Wallbox{"Garage": charging, "Driveway": {}})
+
+	power := entities["total_charging_power"]
+	if state := power.Getter(); state != "2300" {
+		t.Fatalf("total_charging_power = %s", state)
+	}
+	if attributes := power.Attributes(); attributes["Garage"] != 2300.0 || attributes["Driveway"] != 0.0 {
+		t.Fatalf("attributes = %v", attributes)
+	}
+	if state := entities["chargers_charging"].Getter(); state != "1" {
+		t.Fatalf("chargers_charging = %s", state)
+	}
+}
+
+func TestConnectRemoteUnreachable(t *testing.T) {
+	cc := ChargerConfig{Name: "garage", MySQL: "127.0.0.1:1", Redis: "127.0.0.1:1"}
+	if _, err := wallbox.Connect(cc.endpoint(), nil); err == nil {
+		t.Fatal("expected an error for an unreachable MySQL")
+	}
+	if _, ok := connectRemote(cc, true); ok {
+		t.Fatal("expected connectRemote to give up with once")
+	}
+}
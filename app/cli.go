@@ -0,0 +1,385 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"wallbox-mqtt-bridge/app/logging"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+const defaultConfigPath = "bridge.ini"
+
+const cliUsage = `Usage: bridge <command> [flags] [bridge.ini]
+
+Commands:
+  run             run the bridge (also: bridge bridge.ini)
+  configure       edit the configuration in a web form (also: bridge --config)
+  check-config    validate the configuration
+  status          print the current value of every entity
+  set             set an entity: bridge set <entity> <value> [bridge.ini]
+  discovery dump  print the Home Assistant discovery configs
+  diagnose        collect a diagnostics report for a support request
+  version         print the version
+
+Flags go before the arguments; "bridge <command> -h" lists them.
+The configuration defaults to bridge.ini in the working directory.
+`
+
+// errUsage reports a command line that could not be parsed; the flag
+// package has already printed why.
+var errUsage = errors.New("usage")
+
+// RunCLI runs the command line in args (without the program name) and
+// returns the exit status.
+func RunCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	var err error
+	switch command, rest := args[0], args[1:]; command {
+	case "run":
+		err = runCommand(rest, stderr)
+	case "configure", "--config":
+		err = configureCommand(rest, stderr)
+	case "check-config":
+		err = checkConfigCommand(rest, stdout, stderr)
+	case "status":
+		err = statusCommand(rest, stdout, stderr)
+	case "set":
+		err = setCommand(rest, stdout, stderr)
+	case "discovery":
+		err = discoveryCommand(rest, stdout, stderr)
+	case "diagnose":
+		err = diagnoseCommand(rest, stdout, stderr)
+	case "version", "--version":
+		fmt.Fprintln(stdout, bridgeVersion())
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cliUsage)
+	default:
+		if len(args) == 1 && filepathLooksLikeConfig(command) {
+			// The original invocation, still used by the systemd unit.
+			err = runCommand(args, stderr)
+			break
+		}
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", command, cliUsage)
+		return 2
+	}
+
+	switch {
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func filepathLooksLikeConfig(arg string) bool {
+	return len(arg) > 0 && arg[0] != '-'
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: bridge %s [flags] %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses args and returns the positional arguments, of which
+// there must be at least min and at most max.
+func parseFlags(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if flags.NArg() < min || flags.NArg() > max {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+// configPathArg returns the optional configuration path at args[i].
+func configPathArg(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return defaultConfigPath
+}
+
+func runCommand(args []string, stderr io.Writer) error {
+	flags := newFlagSet("run", "[bridge.ini]", stderr)
+	once := flags.Bool("once", false, "publish one polling cycle and exit")
+	logLevel := flags.String("log-level", "", `overrides the [log] level; "debug" also logs every published state`)
+	args, err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if *logLevel != "" {
+		if _, err := logging.ParseLevel(*logLevel); err != nil {
+			return err
+		}
+	}
+
+	RunBridge(configPathArg(args, 0), RunOptions{Once: *once, LogLevel: *logLevel})
+	return nil
+}
+
+func configureCommand(args []string, stderr io.Writer) error {
+	flags := newFlagSet("configure", "[bridge.ini]", stderr)
+	listen := flags.String("listen", ":8080", "address of the config editor")
+	args, err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	RunConfigEditor(configPathArg(args, 0), *listen)
+	return nil
+}
+
+func checkConfigCommand(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("check-config", "[bridge.ini]", stderr)
+	args, err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if !CheckConfig(configPathArg(args, 0), stdout) {
+		return errors.New("configuration is invalid")
+	}
+	return nil
+}
+
+func statusCommand(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("status", "[bridge.ini]", stderr)
+	asJSON := flags.Bool("json", false, "print JSON instead of a table")
+	wait := flags.Duration("wait", 5*time.Second, "how long to wait for the first telemetry event")
+	args, err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	charger, err := openCharger(configPathArg(args, 0), *wait, nil)
+	if err != nil {
+		return err
+	}
+	defer charger.close()
+	return printStatus(stdout, charger.entities, *asJSON)
+}
+
+func setCommand(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("set", "<entity> <value> [bridge.ini]", stderr)
+	args, err := parseFlags(flags, args, 2, 3)
+	if err != nil {
+		return err
+	}
+
+	charger, err := openCharger(configPathArg(args, 2), 0, nil)
+	if err != nil {
+		return err
+	}
+	defer charger.close()
+	if err := setEntity(charger.entities, args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s set to %s\n", args[0], args[1])
+	return nil
+}
+
+func discoveryCommand(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("discovery", "dump [bridge.ini]", stderr)
+	args, err := parseFlags(flags, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if args[0] != "dump" {
+		flags.Usage()
+		return errUsage
+	}
+
+	charger, err := openCharger(configPathArg(args, 1), 0, nil)
+	if err != nil {
+		return err
+	}
+	defer charger.close()
+	device := discoveryDevice{
+		Serial:   charger.w.SerialNumber(),
+		Name:     charger.config.Settings.DeviceName,
+		Firmware: charger.w.FirmwareVersion(),
+	}
+	dumpDiscovery(stdout, device, charger.entities)
+	dumpDiscovery(stdout, device, eventEntities())
+	dumpDeviceTriggers(stdout, device)
+	return nil
+}
+
+// cliCharger is a connection to the charger for one-shot commands, with the
+// entities the bridge would publish.
+type cliCharger struct {
+	config   *WallboxConfig
+	w        *wallbox.Wallbox
+	ocpp     *ocppRuntime
+	entities map[string]Entity
+}
+
+// openCharger connects to the charger like the bridge does, without MQTT,
+// and waits up to wait for the first telemetry event. onEvent, if not nil,
+// receives every Redis event.
+func openCharger(configPath string, wait time.Duration, onEvent func(channel, message string)) (*cliCharger, error) {
+	c, err := loadBridgeConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	configureLogging(c, "")
+	rules, err := buildHealRules(c)
+	if err != nil {
+		return nil, err
+	}
+
+	w := wallbox.New()
+	if err := w.RefreshData(); err != nil {
+		return nil, err
+	}
+	if onEvent != nil {
+		w.SetEventHandler(onEvent)
+	}
+	w.StartRedisSubscriptions()
+	w.StartOCPPJournalWatcher()
+	w.SetSelectedUserId(w.UserId())
+
+	deadline := time.After(wait)
+waitTelemetry:
+	for !w.HasTelemetry() {
+		select {
+		case <-w.Changes():
+		case <-deadline:
+			break waitTelemetry
+		}
+	}
+
+	now := time.Now()
+	ocpp := newOCPPRuntime()
+	ocpp.heal = newHealEngine(c, w, rules)
+	// Only the bridge itself may write the heal state.
+	ocpp.heal.Store = nil
+	for _, entry := range ocpp.heal.History() {
+		ocpp.recordHeal(entry)
+	}
+	if code := w.OCPPOnlineCode(); code > 0 {
+		ocpp.health.Observe(now, code == 4, ocppDisconnectReason(w))
+	}
+	ocpp.updateMismatch(w)
+
+	services := newServiceMonitor(c)
+	if services != nil {
+		observeServices(w, services, now)
+	}
+
+	base := getEntities(w)
+	for k, v := range getOCPPEntities(w, ocpp) {
+		base[k] = v
+	}
+	return &cliCharger{config: c, w: w, ocpp: ocpp, entities: withConfigEntities(base, c, w, services, nil)}, nil
+}
+
+func (c *cliCharger) close() {
+	c.w.StopOCPPJournalWatcher()
+	c.w.StopRedisSubscriptions()
+}
+
+type statusEntity struct {
+	Value      string                 `json:"value"`
+	Unit       string                 `json:"unit,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// entityStatus returns the current value of every entity.
+func entityStatus(entities map[string]Entity) map[string]statusEntity {
+	status := make(map[string]statusEntity, len(entities))
+	for key, entity := range entities {
+		s := statusEntity{Value: entity.Getter(), Unit: entity.Config["unit_of_measurement"]}
+		if entity.Attributes != nil {
+			s.Attributes = entity.Attributes()
+		}
+		status[key] = s
+	}
+	return status
+}
+
+// printStatus prints the current value of every entity, sorted by key.
+func printStatus(out io.Writer, entities map[string]Entity, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entityStatus(entities))
+	}
+
+	keys := make([]string, 0, len(entities))
+	for key := range entities {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ENTITY\tNAME\tVALUE")
+	for _, key := range keys {
+		entity := entities[key]
+		value := entity.Getter()
+		if unit := entity.Config["unit_of_measurement"]; unit != "" {
+			value += " " + unit
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", key, entity.Config["name"], value)
+	}
+	return table.Flush()
+}
+
+// setEntity calls the setter of the entity key, as a message on its MQTT
+// command topic would.
+func setEntity(entities map[string]Entity, key, value string) error {
+	entity, ok := entities[key]
+	if !ok {
+		return fmt.Errorf("unknown entity %q", key)
+	}
+	if entity.Setter == nil {
+		return fmt.Errorf("entity %q cannot be set", key)
+	}
+	entity.Setter(value)
+	return nil
+}
+
+// dumpDiscovery prints the discovery topic and config of every entity,
+// sorted by key.
+func dumpDiscovery(out io.Writer, device discoveryDevice, entities map[string]Entity) {
+	keys := make([]string, 0, len(entities))
+	for key := range entities {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s %s\n", discoveryTopic(device, key, entities[key]), discoveryConfig(device, key, entities[key]))
+	}
+}
+
+// dumpDeviceTriggers prints the discovery topic and config of every device
+// trigger, sorted by topic.
+func dumpDeviceTriggers(out io.Writer, device discoveryDevice) {
+	configs := deviceTriggerDiscovery(device)
+	topics := make([]string, 0, len(configs))
+	for topic := range configs {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		fmt.Fprintf(out, "%s %s\n", topic, configs[topic])
+	}
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRunCLIUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"frobnicate", "x"},
+		{"run", "--log-lvl", "debug"},
+		{"set", "lock"},
+		{"discovery", "list"},
+		{"check-config", "a.ini", "b.ini"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := RunCLI(args, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("%q: exit %d, stderr %q", args, code, stderr.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := RunCLI([]string{"version"}, &stdout, &stderr); code != 0 || strings.TrimSpace(stdout.String()) != bridgeVersion() {
+		t.Fatalf("version: exit %d, %q", code, stdout.String())
+	}
+}
+
+func TestRunCLICheckConfig(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := RunCLI([]string{"check-config", writeConfig(t, "[mqtt]\nhost = broker.lan\n")}, &stdout, &stderr); code != 0 {
+		t.Fatalf("valid config: exit %d\n%s%s", code, stdout.String(), stderr.String())
+	}
+	if code := RunCLI([]string{"check-config", writeConfig(t, "[mqtt]\nport = 1883\n")}, &stdout, &stderr); code != 1 {
+		t.Fatalf("invalid config: exit %d", code)
+	}
+}
+
+func testCLIEntities(set map[string]string) map[string]Entity {
+	return map[string]Entity{
+		"charging_power": {
+			Component: "sensor",
+			Getter:    func() string { return "7200" },
+			Config:    map[string]string{"name": "Charging power", "unit_of_measurement": "W"},
+		},
+		"lock": {
+			Component:  "lock",
+			Getter:     func() string { return "1" },
+			Setter:     func(v string) { set["lock"] = v },
+			Attributes: func() map[string]interface{} { return map[string]interface{}{"user": "Alice"} },
+			Config:     map[string]string{"name": "Lock"},
+		},
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	entities := testCLIEntities(nil)
+
+	var table bytes.Buffer
+	if err := printStatus(&table, entities, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ENTITY") ||
+		strings.Join(strings.Fields(lines[1]), " ") != "charging_power Charging power 7200 W" {
+		t.Fatalf("table:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := printStatus(&out, entities, true); err != nil {
+		t.Fatal(err)
+	}
+	var status map[string]statusEntity
+	if err := json.Unmarshal(out.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status["charging_power"].Unit != "W" || status["lock"].Value != "1" || status["lock"].Attributes["user"] != "Alice" {
+		t.Fatalf("json: %s", out.String())
+	}
+}
+
+func TestSetEntity(t *testing.T) {
+	set := make(map[string]string)
+	entities := testCLIEntities(set)
+	if err := setEntity(entities, "lock", "0"); err != nil || set["lock"] != "0" {
+		t.Fatalf("set lock: %v, %v", err, set)
+	}
+	if err := setEntity(entities, "charging_power", "1"); err == nil {
+		t.Fatal("expected an error for a read-only entity")
+	}
+	if err := setEntity(entities, "nope", "1"); err == nil {
+		t.Fatal("expected an error for an unknown entity")
+	}
+}
+
+func TestDumpDiscovery(t *testing.T) {
+	var out bytes.Buffer
+	dumpDiscovery(&out, discoveryDevice{Serial: "12345", Name: "Garage"}, testCLIEntities(nil))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "homeassistant/lock/12345_lock/config {") {
+		t.Fatalf("dump:\n%s", out.String())
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.SplitN(lines[1], " ", 2)[1]), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["command_topic"] != "~/set" || config["name"] != "Lock" {
+		t.Fatalf("config: %v", config)
+	}
+}
@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// commandQueueSize is how many set commands may wait for the publish loop.
+const commandQueueSize = 32
+
+var (
+	errNotSettable      = errors.New("not a settable entity")
+	errCommandQueueFull = errors.New("too many pending commands")
+)
+
+// queuedCommand is a value to set on an entity, received over MQTT or the
+// REST API.
+type queuedCommand struct {
+	key   string
+	value string
+}
+
+// commandQueue hands set commands from the MQTT client and HTTP server
+// goroutines to the publish loop, so that setters run one at a time on the
+// loop and never concurrently with each other or with publishing.
+type commandQueue struct {
+	// setters must not change once the queue is in use. Only entities that
+	// are always present have setters, so reloads keep them.
+	setters map[string]func(string)
+	pending chan queuedCommand
+}
+
+func newCommandQueue(setters map[string]func(string)) *commandQueue {
+	return &commandQueue{setters: setters, pending: make(chan queuedCommand, commandQueueSize)}
+}
+
+// settable reports whether key has a setter.
+func (q *commandQueue) settable(key string) bool {
+	_, ok := q.setters[key]
+	return ok
+}
+
+// submit queues value for key without blocking.
+func (q *commandQueue) submit(key, value string) error {
+	if !q.settable(key) {
+		return errNotSettable
+	}
+	select {
+	case q.pending <- queuedCommand{key: key, value: value}:
+		return nil
+	default:
+		return errCommandQueueFull
+	}
+}
+
+// commands returns the queued commands. Only the publish loop receives them.
+func (q *commandQueue) commands() <-chan queuedCommand {
+	return q.pending
+}
+
+// apply runs the setter of cmd.
+func (q *commandQueue) apply(cmd queuedCommand) {
+	q.setters[cmd.key](cmd.value)
+}
+
+// mqttCommandHandler queues the values published to <prefix>/<key>/set.
+func mqttCommandHandler(queue *commandQueue) mqtt.MessageHandler {
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		field := strings.Split(msg.Topic(), "/")[1]
+		payload := string(msg.Payload())
+		if !queue.settable(field) {
+			return
+		}
+		mqttLog.Infof("Setting %s %s", field, payload)
+		if err := queue.submit(field, payload); err != nil {
+			mqttLog.Warnf("Dropping %s %s: %v", field, payload, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// testMessage is an MQTT message as the client hands it to a handler.
+type testMessage struct {
+	topic   string
+	payload string
+}
+
+func (m testMessage) Duplicate() bool   { return false }
+func (m testMessage) Qos() byte         { return 1 }
+func (m testMessage) Retained() bool    { return false }
+func (m testMessage) Topic() string     { return m.topic }
+func (m testMessage) MessageID() uint16 { return 0 }
+func (m testMessage) Payload() []byte   { return []byte(m.payload) }
+func (m testMessage) Ack()              {}
+
+var _ mqtt.Message = testMessage{}
+
+// TestAPIAndMQTTCommandsAreSerialized sets values over the API and over MQTT
+// at the same time. The setters share unsynchronized state, so running them
+// anywhere but on the loop fails under -race.
+func TestAPIAndMQTTCommandsAreSerialized(t *testing.T) {
+	var applied []string
+	setter := func(v string) { applied = append(applied, v) }
+	commands := newCommandQueue(map[string]func(string){"lock": setter, "max_charging_current": setter})
+	api := apiHandler("secret", newStateStore(), commands)
+	handler := mqttCommandHandler(commands)
+
+	const n = 10
+	done := make(chan struct{})
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		for {
+			select {
+			case cmd := <-commands.commands():
+				commands.apply(cmd)
+			case <-done:
+				applyQueued(commands)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			if rec := serveAPI(api, "POST", "/api/entities/lock", "secret", "text/plain", fmt.Sprint(i)); rec.Code != http.StatusAccepted {
+				t.Errorf("API status %d: %s", rec.Code, rec.Body)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			handler(nil, testMessage{topic: "wallbox_1/max_charging_current/set", payload: fmt.Sprint(i)})
+		}
+	}()
+	wg.Wait()
+	close(done)
+
+	select {
+	case <-loopDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop did not finish")
+	}
+	if len(applied) != 2*n {
+		t.Fatalf("applied %d commands, want %d", len(applied), 2*n)
+	}
+}
+
+func TestCommandQueueRejectsUnknownAndFull(t *testing.T) {
+	commands := newCommandQueue(map[string]func(string){"lock": func(string) {}})
+	if err := commands.submit("charging_power", "1"); err != errNotSettable {
+		t.Fatalf("unknown key: %v", err)
+	}
+	for i := 0; i < commandQueueSize; i++ {
+		if err := commands.submit("lock", "1"); err != nil {
+			t.Fatalf("submit %d: %v", i, err)
+		}
+	}
+	if err := commands.submit("lock", "1"); err != errCommandQueueFull {
+		t.Fatalf("full queue: %v", err)
+	}
+}
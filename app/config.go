@@ -1,9 +1,28 @@
 package bridge
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
 	"gopkg.in/ini.v1"
 )
 
+// healRuleSectionPrefix prefixes INI sections that define or override a
+// self-heal rule, e.g. [heal_rule.ocpp_mismatch].
+const healRuleSectionPrefix = "heal_rule."
+
+// publishPolicySectionPrefix prefixes INI sections that tune when an entity
+// is published, e.g. [publish.charging_power].
+const publishPolicySectionPrefix = "publish."
+
+// chargerSectionPrefix prefixes INI sections that add a charger reached
+// over the network.
+const chargerSectionPrefix = "charger."
+
 type WallboxConfig struct {
 	MQTT struct {
 		Host     string `ini:"host"`
@@ -13,33 +32,297 @@ type WallboxConfig struct {
 	} `ini:"mqtt"`
 
 	Settings struct {
-		PollingIntervalSeconds int    `ini:"polling_interval_seconds"`
-		DeviceName             string `ini:"device_name"`
-		DebugSensors           bool   `ini:"debug_sensors"`
-		PowerBoostEnabled      bool   `ini:"power_boost_enabled"`
-		AutoRestartOCPP        bool   `ini:"auto_restart_ocpp"`
-		OCPPMismatchSeconds    int    `ini:"ocpp_mismatch_seconds"`
-		OCPPRestartCooldown    int    `ini:"ocpp_restart_cooldown_seconds"`
-		OCPPMaxRestarts        int    `ini:"ocpp_max_restarts"`
-		OCPPFullReboot         bool   `ini:"ocpp_full_reboot"`
-		PilotErrorReboot       bool   `ini:"pilot_error_reboot"`
-		PilotErrorSeconds      int    `ini:"pilot_error_seconds"`
+		PollingIntervalSeconds    int    `ini:"polling_interval_seconds"`
+		DeviceName                string `ini:"device_name"`
+		DebugSensors              bool   `ini:"debug_sensors"`
+		PowerBoostEnabled         bool   `ini:"power_boost_enabled"`
+		AutoRestartOCPP           bool   `ini:"auto_restart_ocpp"`
+		OCPPMismatchSeconds       int    `ini:"ocpp_mismatch_seconds"`
+		OCPPRestartCooldown       int    `ini:"ocpp_restart_cooldown_seconds"`
+		OCPPMaxRestarts           int    `ini:"ocpp_max_restarts"`
+		OCPPFullReboot            bool   `ini:"ocpp_full_reboot"`
+		PilotErrorReboot          bool   `ini:"pilot_error_reboot"`
+		PilotErrorSeconds         int    `ini:"pilot_error_seconds"`
+		HealStateFile             string `ini:"heal_state_file"`
+		MaxRebootsPerDay          int    `ini:"max_reboots_per_day"`
+		HealDryRun                bool   `ini:"heal_dry_run"`
+		ServiceHealth             bool   `ini:"service_health"`
+		ServiceHealthHeal         bool   `ini:"service_health_heal"`
+		ServiceUnhealthySeconds   int    `ini:"service_unhealthy_seconds"`
+		ServiceLeakWindowMinutes  int    `ini:"service_leak_window_minutes"`
+		ServiceLeakGrowthPercent  int    `ini:"service_leak_growth_percent"`
+		UncataloguedTelemetry     bool   `ini:"uncatalogued_telemetry"`
+		EventDebounceMilliseconds int    `ini:"event_debounce_ms"`
+		SiteName                  string `ini:"site_name"`
 	} `ini:"settings"`
+
+	HTTP struct {
+		// Listen is the address of the HTTP server, e.g. ":9101". Empty
+		// disables it.
+		Listen  string `ini:"listen"`
+		Metrics bool   `ini:"metrics"`
+		// API enables the REST API, which requires Token.
+		API   bool   `ini:"api"`
+		Token string `ini:"token"`
+		// Dashboard serves the web dashboard; its controls use the API.
+		Dashboard bool `ini:"dashboard"`
+		// ConfigEditor serves the config editor under /config/.
+		ConfigEditor bool `ini:"config_editor"`
+	} `ini:"http"`
+
+	Log struct {
+		Level  string `ini:"level"`
+		Format string `ini:"format"`
+		// Subsystems sets levels per subsystem, e.g. "heal=debug".
+		Subsystems string `ini:"subsystems"`
+		// MQTTLevel forwards entries at or above it to MQTT; "off" disables.
+		MQTTLevel string `ini:"mqtt_level"`
+	} `ini:"log"`
+
+	HealRules       []HealRuleConfig      `ini:"-"`
+	PublishPolicies []PublishPolicyConfig `ini:"-"`
+	Chargers        []ChargerConfig       `ini:"-"`
+
+	// given holds the names of the configFields set by the file, the
+	// environment or the config editor, so that defaults only fill in the
+	// others and an explicit zero is kept.
+	given map[string]bool `ini:"-"`
+}
+
+// HealRuleConfig is a [heal_rule.<name>] section. For the built-in rules
+// (ocpp_mismatch, pilot_error) empty or zero keys keep the built-in value.
+type HealRuleConfig struct {
+	Name            string `ini:"-"`
+	Enabled         bool   `ini:"enabled"`
+	Condition       string `ini:"condition"`
+	PersistSeconds  int    `ini:"persist_seconds"`
+	CooldownSeconds int    `ini:"cooldown_seconds"`
+	Ladder          string `ini:"ladder"`
+	MaxAttempts     int    `ini:"max_attempts"`
+	Service         string `ini:"service"`
 }
 
-func (w *WallboxConfig) SaveTo(path string) {
+// PublishPolicyConfig is a [publish.<entity>] section. [publish.default]
+// applies to every entity without a section of its own. Setting a deadband
+// replaces the entity's built-in rate limit.
+type PublishPolicyConfig struct {
+	Name               string  `ini:"-"`
+	MinIntervalSeconds float64 `ini:"min_interval_seconds"`
+	HeartbeatSeconds   float64 `ini:"heartbeat_seconds"`
+	Deadband           float64 `ini:"deadband"`
+	DeadbandPercent    float64 `ini:"deadband_percent"`
+	// Precision is the number of decimals numeric states are rounded to;
+	// -1 (the default) keeps them as they are.
+	Precision int `ini:"precision"`
+}
+
+// ChargerConfig is a [charger.<name>] section: another Wallbox the bridge
+// publishes, reached through its forwarded MySQL and Redis ports.
+type ChargerConfig struct {
+	Name  string `ini:"-"`
+	MySQL string `ini:"mysql"`
+	Redis string `ini:"redis"`
+	// DeviceName defaults to "Wallbox <name>".
+	DeviceName string `ini:"device_name"`
+}
+
+func (w *WallboxConfig) SaveTo(path string) error {
 	cfg := ini.Empty()
 	cfg.ReflectFrom(w)
-	cfg.SaveTo(path)
+	for _, rule := range w.HealRules {
+		rule := rule
+		cfg.Section(healRuleSectionPrefix + rule.Name).ReflectFrom(&rule)
+	}
+	for _, policy := range w.PublishPolicies {
+		policy := policy
+		cfg.Section(publishPolicySectionPrefix + policy.Name).ReflectFrom(&policy)
+	}
+	for _, charger := range w.Chargers {
+		charger := charger
+		cfg.Section(chargerSectionPrefix + charger.Name).ReflectFrom(&charger)
+	}
+	return cfg.SaveTo(path)
+}
+
+// configSections are the sections whose keys are listed in configFields.
+var configSections = map[string]bool{"mqtt": true, "settings": true, "http": true, "log": true}
+
+// configError lists every problem found in a configuration.
+type configError struct {
+	path     string
+	problems []string
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("invalid configuration %s:\n  %s", e.path, strings.Join(e.problems, "\n  "))
+}
+
+// LoadConfig reads the configuration at path, applies the WALLBOX_*
+// environment overrides and the defaults, and validates the result. The
+// warnings, such as unknown keys, do not make the configuration invalid.
+func LoadConfig(path string) (*WallboxConfig, []string, error) {
+	config, warnings, err := readConfigFile(path)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	var problems []string
+	for _, f := range configFields {
+		text, ok := os.LookupEnv(f.EnvName())
+		if !ok {
+			continue
+		}
+		if err := f.parse(config, text); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.EnvName(), err))
+		}
+	}
+	applyConfigDefaults(config, path)
+	problems = append(problems, validateConfig(config)...)
+	if len(problems) > 0 {
+		return nil, warnings, &configError{path: path, problems: problems}
+	}
+
+	if config.HTTP.Listen == "" && (config.HTTP.Metrics || config.HTTP.API || config.HTTP.Dashboard || config.HTTP.ConfigEditor) {
+		warnings = append(warnings, "[http] metrics, api, dashboard and config_editor have no effect without listen")
+	}
+	return config, warnings, nil
 }
 
-func LoadConfig(path string) *WallboxConfig {
-	cfg, _ := ini.Load(path)
+// readConfigFile parses the file at path as it is, without environment
+// overrides or defaults, which is what the config editor shows and saves.
+func readConfigFile(path string) (*WallboxConfig, []string, error) {
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", path, err)
+	}
 
-	var config WallboxConfig
-	if err := cfg.MapTo(&config); err != nil {
-		return nil
+	config := &WallboxConfig{}
+	var warnings, problems []string
+	for _, section := range cfg.Sections() {
+		name := section.Name()
+		switch {
+		case configSections[name]:
+			for _, key := range section.Keys() {
+				field, ok := findConfigField(name, key.Name())
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("[%s] %s: unknown key", name, key.Name()))
+					continue
+				}
+				if err := field.parse(config, key.String()); err != nil {
+					problems = append(problems, fmt.Sprintf("[%s] %s: %v", name, key.Name(), err))
+				}
+			}
+		case strings.HasPrefix(name, healRuleSectionPrefix):
+			rule := HealRuleConfig{Enabled: true}
+			warnings = append(warnings, unknownKeys(section, &rule)...)
+			if err := section.StrictMapTo(&rule); err != nil {
+				problems = append(problems, fmt.Sprintf("[%s] %v", name, err))
+				continue
+			}
+			rule.Name = strings.TrimPrefix(name, healRuleSectionPrefix)
+			config.HealRules = append(config.HealRules, rule)
+		case strings.HasPrefix(name, publishPolicySectionPrefix):
+			policy := PublishPolicyConfig{Precision: -1}
+			warnings = append(warnings, unknownKeys(section, &policy)...)
+			if err := section.StrictMapTo(&policy); err != nil {
+				problems = append(problems, fmt.Sprintf("[%s] %v", name, err))
+				continue
+			}
+			policy.Name = strings.TrimPrefix(name, publishPolicySectionPrefix)
+			config.PublishPolicies = append(config.PublishPolicies, policy)
+		case strings.HasPrefix(name, chargerSectionPrefix):
+			charger := ChargerConfig{}
+			warnings = append(warnings, unknownKeys(section, &charger)...)
+			if err := section.StrictMapTo(&charger); err != nil {
+				problems = append(problems, fmt.Sprintf("[%s] %v", name, err))
+				continue
+			}
+			charger.Name = strings.TrimPrefix(name, chargerSectionPrefix)
+			config.Chargers = append(config.Chargers, charger)
+		case name == ini.DefaultSection:
+			for _, key := range section.Keys() {
+				warnings = append(warnings, fmt.Sprintf("%s: key outside of a section", key.Name()))
+			}
+		default:
+			warnings = append(warnings, fmt.Sprintf("[%s]: unknown section", name))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, warnings, &configError{path: path, problems: problems}
 	}
+	return config, warnings, nil
+}
+
+// unknownKeys warns about the keys of section that v has no field for.
+func unknownKeys(section *ini.Section, v interface{}) []string {
+	var warnings []string
+	for _, key := range section.Keys() {
+		if _, ok := iniField(reflect.ValueOf(v).Elem(), key.Name()); !ok {
+			warnings = append(warnings, fmt.Sprintf("[%s] %s: unknown key", section.Name(), key.Name()))
+		}
+	}
+	return warnings
+}
 
-	return &config
+// applyConfigDefaults fills in the defaults from configFields for keys that
+// were not given; a key given as 0 or false keeps that value unless the field
+// treats 0 as its default. heal_state_file defaults to heal_state.json next
+// to the configuration file.
+func applyConfigDefaults(c *WallboxConfig, configPath string) {
+	for _, f := range configFields {
+		if !f.Required && f.usesDefault(c) {
+			f.setDefault(c)
+		}
+	}
+	if c.Settings.HealStateFile == "" {
+		c.Settings.HealStateFile = filepath.Join(filepath.Dir(configPath), "heal_state.json")
+	}
+	for i := range c.Chargers {
+		if c.Chargers[i].DeviceName == "" {
+			c.Chargers[i].DeviceName = "Wallbox " + c.Chargers[i].Name
+		}
+	}
+}
+
+func validateConfig(c *WallboxConfig) []string {
+	var problems []string
+	for _, f := range configFields {
+		if err := f.validate(c); err != nil {
+			problems = append(problems, fmt.Sprintf("[%s] %s: %v", f.Section, f.Key, err))
+		}
+	}
+	if (c.HTTP.API || c.HTTP.Dashboard || c.HTTP.ConfigEditor) && c.HTTP.Token == "" {
+		problems = append(problems, "[http] token: required for api, dashboard and config_editor")
+	}
+	if _, err := buildHealRules(c); err != nil {
+		problems = append(problems, err.Error())
+	}
+	_, _, logProblems := logConfig(c)
+	problems = append(problems, logProblems...)
+	for _, policy := range c.PublishPolicies {
+		if err := policy.validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, charger := range c.Chargers {
+		if err := charger.validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// CheckConfig loads the configuration at path as the bridge would and
+// prints its warnings and problems. It reports whether the file is valid.
+func CheckConfig(path string, out io.Writer) bool {
+	_, warnings, err := LoadConfig(path)
+	for _, warning := range warnings {
+		fmt.Fprintf(out, "warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	fmt.Fprintf(out, "%s is valid\n", path)
+	return true
 }
@@ -0,0 +1,218 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+//go:embed config_editor.html
+var configEditorPage string
+
+var configEditorTemplate = template.Must(template.New("config").Parse(configEditorPage))
+
+// mqttTestTimeout bounds the connection test before saving.
+const mqttTestTimeout = 5 * time.Second
+
+type configEditorField struct {
+	configField
+	Value string
+	Error string
+}
+
+func (f configEditorField) Bounded() bool {
+	return f.Min != 0 || f.Max != 0
+}
+
+type configEditorSection struct {
+	Name   string
+	Fields []configEditorField
+}
+
+type configEditorPageData struct {
+	Path      string
+	Token     string
+	Sections  []configEditorSection
+	Saved     bool
+	SavedHint string
+	Error     string
+}
+
+// configEditor edits the configuration file at path through a web form.
+type configEditor struct {
+	path  string
+	token string
+	// testMQTT connects to the broker of the submitted configuration.
+	testMQTT func(c *WallboxConfig) error
+	// savedHint is shown after saving, e.g. how to apply the change.
+	savedHint string
+	// onSave is called after the file has been written.
+	onSave func()
+}
+
+// loadEditableConfig returns the configuration at path, or the defaults if
+// the file does not exist yet.
+func loadEditableConfig(path string) (*WallboxConfig, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return defaultConfig(), nil
+	}
+	c, _, err := readConfigFile(path)
+	return c, err
+}
+
+func (e *configEditor) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	c, err := loadEditableConfig(e.path)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		e.render(rw, http.StatusOK, c, nil, configEditorPageData{})
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.save(rw, r, c)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// save applies the submitted form to c, which keeps the sections the form
+// does not cover, and writes it once every field is valid.
+func (e *configEditor) save(rw http.ResponseWriter, r *http.Request, c *WallboxConfig) {
+	fieldErrors := make(map[string]string)
+	for _, f := range configFields {
+		text := r.PostForm.Get(f.Name())
+		if f.Secret && text == "" {
+			// Secrets are never sent to the browser; empty keeps them.
+			continue
+		}
+		if err := f.Set(c, text); err != nil {
+			fieldErrors[f.Name()] = err.Error()
+		}
+	}
+	if len(fieldErrors) > 0 {
+		e.render(rw, http.StatusBadRequest, c, fieldErrors, configEditorPageData{Error: "Please correct the marked fields."})
+		return
+	}
+	// Check what the bridge checks on loading, such as the token the API
+	// needs, on the configuration as the bridge would see it.
+	effective := *c
+	applyConfigDefaults(&effective, e.path)
+	if problems := validateConfig(&effective); len(problems) > 0 {
+		e.render(rw, http.StatusBadRequest, c, nil, configEditorPageData{Error: strings.Join(problems, "; ")})
+		return
+	}
+
+	if r.PostForm.Get("skip_mqtt_test") == "" && e.testMQTT != nil {
+		if err := e.testMQTT(c); err != nil {
+			e.render(rw, http.StatusBadRequest, c, nil, configEditorPageData{
+				Error: fmt.Sprintf("Could not connect to the MQTT broker at %s:%d: %v", c.MQTT.Host, c.MQTT.Port, err),
+			})
+			return
+		}
+	}
+
+	if err := c.SaveTo(e.path); err != nil {
+		e.render(rw, http.StatusInternalServerError, c, nil, configEditorPageData{Error: fmt.Sprintf("Saving failed: %v", err)})
+		return
+	}
+	configLog.Infof("Configuration saved to %s", e.path)
+	e.render(rw, http.StatusOK, c, nil, configEditorPageData{Saved: true, SavedHint: e.savedHint})
+	if e.onSave != nil {
+		e.onSave()
+	}
+}
+
+func (e *configEditor) render(rw http.ResponseWriter, status int, c *WallboxConfig, fieldErrors map[string]string, data configEditorPageData) {
+	data.Path = e.path
+	data.Token = e.token
+	for _, f := range configFields {
+		if n := len(data.Sections); n == 0 || data.Sections[n-1].Name != f.Section {
+			data.Sections = append(data.Sections, configEditorSection{Name: f.Section})
+		}
+		section := &data.Sections[len(data.Sections)-1]
+		value := f.Get(c)
+		if f.Default != "" && f.usesDefault(c) {
+			// Saving the form writes every field, so a key missing from
+			// the file is shown, and saved, with the value it has.
+			value = f.Default
+		}
+		if f.Secret && value != "" {
+			value = "set"
+		}
+		section.Fields = append(section.Fields, configEditorField{configField: f, Value: value, Error: fieldErrors[f.Name()]})
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	if err := configEditorTemplate.Execute(rw, data); err != nil {
+		httpLog.Errorf("Rendering config editor failed: %v", err)
+	}
+}
+
+// testMQTTConnection connects to the broker of c and disconnects again.
+func testMQTTConnection(c *WallboxConfig) error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", c.MQTT.Host, c.MQTT.Port))
+	opts.SetUsername(c.MQTT.Username)
+	opts.SetPassword(c.MQTT.Password)
+	opts.SetConnectTimeout(mqttTestTimeout)
+	opts.SetAutoReconnect(false)
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTestTimeout) {
+		return errors.New("timed out")
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	client.Disconnect(250)
+	return nil
+}
+
+// RunConfigEditor serves the config editor for path on listen until the
+// configuration has been saved. The URL includes a random key that is
+// printed to stdout.
+func RunConfigEditor(path, listen string) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	token := hex.EncodeToString(key)
+
+	saved := make(chan struct{})
+	editor := &configEditor{
+		path:      path,
+		token:     token,
+		testMQTT:  testMQTTConnection,
+		savedHint: "The editor has stopped; start the bridge with this file.",
+		onSave:    func() { close(saved) },
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", requireToken(token, true, editor))
+
+	server := startHTTPServer(listen, mux)
+	fmt.Printf("Open http://<wallbox-ip>%s/?token=%s to edit %s\n", listen, token, path)
+
+	<-saved
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFieldsCoverConfig(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, f := range configFields {
+		f.value(&WallboxConfig{}) // panics on an unknown key
+		covered[f.Name()] = true
+	}
+
+	c := reflect.TypeOf(WallboxConfig{})
+	for i := 0; i < c.NumField(); i++ {
+		section := c.Field(i)
+		if section.Tag.Get("ini") == "-" {
+			continue
+		}
+		for j := 0; j < section.Type.NumField(); j++ {
+			name := section.Tag.Get("ini") + "." + section.Type.Field(j).Tag.Get("ini")
+			if !covered[name] {
+				t.Errorf("%s is missing from configFields", name)
+			}
+		}
+	}
+}
+
+func TestConfigFieldSet(t *testing.T) {
+	field := func(name string) configField {
+		for _, f := range configFields {
+			if f.Name() == name {
+				return f
+			}
+		}
+		t.Fatalf("no field %s", name)
+		return configField{}
+	}
+
+	c := defaultConfig()
+	if c.MQTT.Port != 1883 || c.Settings.DeviceName != "Wallbox" || c.Settings.EventDebounceMilliseconds != 250 {
+		t.Fatalf("defaults = %+v", c)
+	}
+	for name, text := range map[string]string{
+		"mqtt.port":                         "70000",
+		"mqtt.host":                         " ",
+		"settings.polling_interval_seconds": "fast",
+		"settings.debug_sensors":            "maybe",
+	} {
+		if err := field(name).Set(c, text); err == nil {
+			t.Errorf("%s = %q: expected an error", name, text)
+		}
+	}
+	if err := field("settings.ocpp_full_reboot").Set(c, "on"); err != nil || !c.Settings.OCPPFullReboot {
+		t.Fatalf("checkbox: %v, %v", err, c.Settings.OCPPFullReboot)
+	}
+}
+
+func TestConfigEditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.ini")
+	existing := `[mqtt]
+host = broker.lan
+port = 1883
+password = secret
+
+[settings]
+polling_interval_seconds = 5
+device_name = Garage
+
+[heal_rule.pilot_error]
+enabled = false
+`
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mqttErr := errors.New("connection refused")
+	editor := &configEditor{path: path, token: "key", testMQTT: func(*WallboxConfig) error { return mqttErr }}
+	server := httptest.NewServer(requireToken("key", true, editor))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?token=key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := readBody(t, resp)
+	if !strings.Contains(page, `value="broker.lan"`) || !strings.Contains(page, `value="Garage"`) || strings.Contains(page, "secret") {
+		t.Fatalf("form does not show the existing config:\n%s", page)
+	}
+
+	form := url.Values{
+		"mqtt.host":                         {"broker.lan"},
+		"mqtt.port":                         {"1884"},
+		"settings.polling_interval_seconds": {"0"},
+		"settings.device_name":              {"Garage"},
+	}
+	post := func(form url.Values) (int, string) {
+		resp, err := http.PostForm(server.URL+"/?token=key", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, readBody(t, resp)
+	}
+
+	if status, page := post(form); status != http.StatusBadRequest || !strings.Contains(page, "Polling interval (s) must be between 1 and 3600") {
+		t.Fatalf("invalid field: %d\n%s", status, page)
+	}
+
+	form.Set("settings.polling_interval_seconds", "2")
+	form.Set("settings.pilot_error_reboot", "on")
+	if status, page := post(form); status != http.StatusBadRequest || !strings.Contains(page, "connection refused") {
+		t.Fatalf("failed MQTT test: %d\n%s", status, page)
+	}
+	if c, _, _ := LoadConfig(path); c.MQTT.Port != 1883 {
+		t.Fatal("config saved although the MQTT test failed")
+	}
+
+	mqttErr = nil
+	if status, page := post(form); status != http.StatusOK || !strings.Contains(page, "Saved.") {
+		t.Fatalf("save: %d\n%s", status, page)
+	}
+	c, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MQTT.Port != 1884 || c.MQTT.Password != "secret" || c.Settings.PollingIntervalSeconds != 2 || !c.Settings.PilotErrorReboot {
+		t.Fatalf("saved config = %+v", c)
+	}
+	if len(c.HealRules) != 1 || c.HealRules[0].Name != "pilot_error" {
+		t.Fatalf("heal rules not kept: %+v", c.HealRules)
+	}
+}
+
+func TestConfigEditorNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.ini")
+	rec := httptest.NewRecorder()
+	(&configEditor{path: path}).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="127.0.0.1"`) {
+		t.Fatalf("new config form: %d\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,242 @@
+package bridge
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// configField describes a key of WallboxConfig: how LoadConfig parses,
+// defaults and validates it and how the config editor shows it.
+type configField struct {
+	Section string
+	Key     string
+	Label   string
+	Help    string
+	// Default replaces a value that was not given. For required fields it
+	// only fills in a new configuration.
+	Default string
+	// ZeroIsDefault makes 0 take the default as well. Configurations
+	// written by the old setup contain 0 for keys it never asked for.
+	ZeroIsDefault bool
+	// Min and Max bound numeric values unless both are zero.
+	Min, Max float64
+	Required bool
+	Secret   bool
+}
+
+// configFields lists every key of the [mqtt], [settings], [http] and [log]
+// sections, in the order the editor shows them. It is the only place
+// defaults are defined.
+var configFields = []configField{
+	{Section: "mqtt", Key: "host", Label: "MQTT host", Help: "Host name or IP address of the MQTT broker.", Default: "127.0.0.1", Required: true},
+	{Section: "mqtt", Key: "port", Label: "MQTT port", Help: "Port of the MQTT broker.", Default: "1883", Min: 1, Max: 65535},
+	{Section: "mqtt", Key: "username", Label: "MQTT username", Help: "Leave empty if the broker allows anonymous clients."},
+	{Section: "mqtt", Key: "password", Label: "MQTT password", Secret: true},
+
+	{Section: "settings", Key: "polling_interval_seconds", Label: "Polling interval (s)", Help: "How often MySQL and the Redis hashes are read. Telemetry is published as it arrives, and commands are read back right away.", Default: "10", Min: 1, Max: 3600},
+	{Section: "settings", Key: "device_name", Label: "Device name", Help: "Name of the device in Home Assistant.", Default: "Wallbox"},
+	{Section: "settings", Key: "debug_sensors", Label: "Debug sensors", Help: "Expose the diagnostic telemetry sensors."},
+	{Section: "settings", Key: "power_boost_enabled", Label: "Power Boost sensors", Help: "Expose the Power Boost power and current sensors."},
+	{Section: "settings", Key: "auto_restart_ocpp", Label: "Auto-restart OCPP", Help: "Restart the OCPP service when the cable is connected but OCPP reports a disconnect."},
+	{Section: "settings", Key: "ocpp_mismatch_seconds", Label: "OCPP mismatch (s)", Help: "How long the OCPP mismatch must persist before healing.", Default: "60", Min: 0, Max: 86400},
+	{Section: "settings", Key: "ocpp_restart_cooldown_seconds", Label: "OCPP restart cooldown (s)", Help: "Minimum time between OCPP heal actions.", Default: "600", Min: 0, Max: 86400},
+	{Section: "settings", Key: "ocpp_max_restarts", Label: "OCPP max restarts", Help: "Service restarts before giving up or escalating to a reboot. 0 uses the default.", Default: "3", ZeroIsDefault: true, Min: 0, Max: 100},
+	{Section: "settings", Key: "ocpp_full_reboot", Label: "OCPP full reboot", Help: "Allow a full Wallbox reboot once the OCPP restarts are exhausted."},
+	{Section: "settings", Key: "pilot_error_reboot", Label: "Pilot error reboot", Help: "Reboot when the control pilot stays in an error state."},
+	{Section: "settings", Key: "pilot_error_seconds", Label: "Pilot error (s)", Help: "How long the control pilot must be in error before rebooting. 0 uses the default.", Default: "300", ZeroIsDefault: true, Min: 0, Max: 86400},
+	{Section: "settings", Key: "heal_state_file", Label: "Heal state file", Help: "Where heal progress is kept. Empty: heal_state.json next to this file."},
+	{Section: "settings", Key: "max_reboots_per_day", Label: "Max reboots per day", Help: "Reboot guard across bridge restarts; -1 is unlimited.", Default: "3", Min: -1, Max: 100},
+	{Section: "settings", Key: "heal_dry_run", Label: "Heal dry run", Help: "Only log and publish what the heal rules would do."},
+	{Section: "settings", Key: "service_health", Label: "Service health", Help: "Publish a sensor per Wallbox service and detect memory leaks."},
+	{Section: "settings", Key: "service_health_heal", Label: "Service health heal", Help: "Restart critical services that stop running."},
+	{Section: "settings", Key: "service_unhealthy_seconds", Label: "Service down (s)", Help: "How long a critical service must be down before healing.", Default: "120", Min: 0, Max: 86400},
+	{Section: "settings", Key: "service_leak_window_minutes", Label: "Leak window (min)", Help: "How far back memory growth is judged.", Default: "360", Min: 0, Max: 10080},
+	{Section: "settings", Key: "service_leak_growth_percent", Label: "Leak growth (%)", Help: "Memory growth over the window that counts as a leak.", Default: "20", Min: 0, Max: 1000},
+	{Section: "settings", Key: "uncatalogued_telemetry", Label: "Uncatalogued telemetry", Help: "Expose telemetry sensors the bridge does not know as generic sensors."},
+	{Section: "settings", Key: "event_debounce_ms", Label: "Event debounce (ms)", Help: "How long telemetry and session events are collected before publishing.", Default: "250", Min: 0, Max: 10000},
+	{Section: "settings", Key: "site_name", Label: "Site name", Help: "Name of the site device that totals all chargers, if [charger.*] sections add any.", Default: "Wallbox site"},
+
+	{Section: "http", Key: "listen", Label: "HTTP listen address", Help: `Address of the HTTP server, e.g. ":9101". Empty disables it.`},
+	{Section: "http", Key: "metrics", Label: "Prometheus metrics", Help: "Serve /metrics."},
+	{Section: "http", Key: "api", Label: "REST API", Help: "Serve the REST API under /api/. Requires a token."},
+	{Section: "http", Key: "token", Label: "API token", Help: "Bearer token for the API, dashboard and config editor.", Secret: true},
+	{Section: "http", Key: "dashboard", Label: "Dashboard", Help: "Serve the web dashboard. Requires a token."},
+	{Section: "http", Key: "config_editor", Label: "Config editor", Help: "Serve this editor under /config/. Requires a token."},
+
+	{Section: "log", Key: "level", Label: "Log level", Help: "debug, info, warn or error. debug also logs every published state.", Default: "info"},
+	{Section: "log", Key: "format", Label: "Log format", Help: "text or json.", Default: "text"},
+	{Section: "log", Key: "subsystems", Label: "Subsystem levels", Help: `Levels of single subsystems, e.g. "heal=debug, wallbox=warn". Subsystems: bridge, mqtt, config, http, api, heal, ocpp, services, wallbox.`},
+	{Section: "log", Key: "mqtt_level", Label: "MQTT log level", Help: "Publish log entries at or above this level to MQTT and Home Assistant; off disables it.", Default: "off"},
+}
+
+// Name is the form field name, e.g. "mqtt.host".
+func (f configField) Name() string {
+	return f.Section + "." + f.Key
+}
+
+// value returns the WallboxConfig field for f.
+func (f configField) value(c *WallboxConfig) reflect.Value {
+	section, ok := iniField(reflect.ValueOf(c).Elem(), f.Section)
+	if !ok {
+		panic(fmt.Sprintf("config has no section %s", f.Section))
+	}
+	field, ok := iniField(section, f.Key)
+	if !ok {
+		panic(fmt.Sprintf("config has no key %s", f.Name()))
+	}
+	return field
+}
+
+func iniField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("ini"), ",")[0] == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Get formats the current value.
+func (f configField) Get(c *WallboxConfig) string {
+	return fmt.Sprint(f.value(c).Interface())
+}
+
+// EnvName is the environment variable that overrides the field, e.g.
+// WALLBOX_MQTT_HOST.
+func (f configField) EnvName() string {
+	return "WALLBOX_" + strings.ToUpper(f.Section+"_"+f.Key)
+}
+
+// Set parses and validates text and stores it in c.
+func (f configField) Set(c *WallboxConfig, text string) error {
+	if err := f.parse(c, text); err != nil {
+		return err
+	}
+	return f.validate(c)
+}
+
+// parse stores text in c, checking only its type, and records the field as
+// given unless text is empty. A checkbox is always given: unchecked means
+// false.
+func (f configField) parse(c *WallboxConfig, text string) error {
+	if err := f.store(c, text); err != nil {
+		return err
+	}
+	if strings.TrimSpace(text) != "" || f.IsBool() {
+		if c.given == nil {
+			c.given = make(map[string]bool)
+		}
+		c.given[f.Name()] = true
+	}
+	return nil
+}
+
+// store stores text in c, checking only its type.
+func (f configField) store(c *WallboxConfig, text string) error {
+	text = strings.TrimSpace(text)
+	v := f.value(c)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		if text == "" || text == "on" {
+			v.SetBool(text == "on")
+			return nil
+		}
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", f.Label)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		if text == "" {
+			text = "0"
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number", f.Label)
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("%s has unsupported type %s", f.Label, v.Kind())
+	}
+	return nil
+}
+
+// validate checks the value in c against the field's constraints.
+func (f configField) validate(c *WallboxConfig) error {
+	v := f.value(c)
+	switch v.Kind() {
+	case reflect.String:
+		if f.Required && v.String() == "" {
+			return fmt.Errorf("%s is required", f.Label)
+		}
+	case reflect.Int:
+		if f.Min == 0 && f.Max == 0 {
+			return nil
+		}
+		if n := float64(v.Int()); n < f.Min || n > f.Max {
+			return fmt.Errorf("%s must be between %g and %g", f.Label, f.Min, f.Max)
+		}
+	}
+	return nil
+}
+
+// isZero reports whether the field is zero in c.
+func (f configField) isZero(c *WallboxConfig) bool {
+	return f.value(c).IsZero()
+}
+
+// isGiven reports whether the field was set rather than left to its
+// default.
+func (f configField) isGiven(c *WallboxConfig) bool {
+	return c.given[f.Name()]
+}
+
+// usesDefault reports whether the field takes its default in c: it was not
+// given, or it is 0 and ZeroIsDefault is set.
+func (f configField) usesDefault(c *WallboxConfig) bool {
+	return f.isZero(c) && (!f.isGiven(c) || f.ZeroIsDefault)
+}
+
+// IsBool reports whether the field is a checkbox.
+func (f configField) IsBool() bool {
+	return f.value(&WallboxConfig{}).Kind() == reflect.Bool
+}
+
+// IsNumber reports whether the field takes a number.
+func (f configField) IsNumber() bool {
+	return f.value(&WallboxConfig{}).Kind() == reflect.Int
+}
+
+// findConfigField returns the field for key in section.
+func findConfigField(section, key string) (configField, bool) {
+	for _, f := range configFields {
+		if f.Section == section && f.Key == key {
+			return f, true
+		}
+	}
+	return configField{}, false
+}
+
+func (f configField) setDefault(c *WallboxConfig) {
+	if f.Default == "" {
+		return
+	}
+	if err := f.store(c, f.Default); err != nil {
+		panic(fmt.Sprintf("invalid default for %s: %v", f.Name(), err))
+	}
+}
+
+// defaultConfig returns a new configuration with every field at its
+// default.
+func defaultConfig() *WallboxConfig {
+	c := &WallboxConfig{}
+	for _, f := range configFields {
+		f.setDefault(c)
+	}
+	return c
+}
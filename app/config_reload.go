@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"wallbox-mqtt-bridge/app/logging"
+	"wallbox-mqtt-bridge/app/servicehealth"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// configWatchInterval is how often the config file is checked for changes.
+const configWatchInterval = 2 * time.Second
+
+// loadBridgeConfig loads the configuration at path and logs its warnings.
+func loadBridgeConfig(path string) (*WallboxConfig, error) {
+	c, warnings, err := LoadConfig(path)
+	for _, warning := range warnings {
+		configLog.Warnf("%s", warning)
+	}
+	return c, err
+}
+
+// newServiceMonitor returns the service health monitor for c, or nil if
+// service health is disabled.
+func newServiceMonitor(c *WallboxConfig) *servicehealth.Monitor {
+	if !c.Settings.ServiceHealth {
+		return nil
+	}
+	return servicehealth.New(servicehealth.Config{
+		Window:           time.Duration(c.Settings.ServiceLeakWindowMinutes) * time.Minute,
+		MinGrowthPercent: float64(c.Settings.ServiceLeakGrowthPercent),
+	})
+}
+
+// withConfigEntities returns base plus the entities c switches on. logs may
+// be nil if nothing is forwarded.
+func withConfigEntities(base map[string]Entity, c *WallboxConfig, w *wallbox.Wallbox, services *servicehealth.Monitor, logs *logForwarder) map[string]Entity {
+	entities := make(map[string]Entity, len(base))
+	for k, v := range base {
+		entities[k] = v
+	}
+	if c.Settings.DebugSensors {
+		for k, v := range getDebugEntities(w) {
+			entities[k] = v
+		}
+		for k, v := range getTelemetryEventEntities(w) {
+			entities[k] = v
+		}
+	}
+	if c.Settings.PowerBoostEnabled {
+		for k, v := range getPowerBoostEntities(w, c) {
+			entities[k] = v
+		}
+	}
+	if services != nil {
+		for k, v := range getServiceHealthEntities(w, services) {
+			entities[k] = v
+		}
+	}
+	if _, mqttLevel, problems := logConfig(c); len(problems) == 0 && logs != nil && mqttLevel != logging.LevelOff {
+		for k, v := range getLogEntities(logs) {
+			entities[k] = v
+		}
+	}
+	return entities
+}
+
+// diffEntities returns the sorted keys that are only in next (added) and
+// only in current (removed).
+func diffEntities(current, next map[string]Entity) (added, removed []string) {
+	for key := range next {
+		if _, ok := current[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	for key := range current {
+		if _, ok := next[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// watchConfigFile polls path every interval and signals once a change has
+// settled, i.e. the file has not changed again for one interval, so that a
+// file being written is not read half way. It stops when done is closed.
+func watchConfigFile(path string, interval time.Duration, done <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	stat := func() string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprint(info.ModTime().UnixNano(), info.Size())
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := stat()
+		pending := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if current := stat(); current != last {
+				last = current
+				pending = true
+				continue
+			}
+			if pending {
+				pending = false
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
@@ -0,0 +1,59 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func TestWithConfigEntities(t *testing.T) {
+	w := &wallbox.Wallbox{}
+	base := map[string]Entity{"status": {Component: "sensor"}}
+
+	c := &WallboxConfig{}
+	plain := withConfigEntities(base, c, w, nil, nil)
+	c.Settings.DebugSensors = true
+	debug := withConfigEntities(base, c, w, nil, nil)
+
+	added, removed := diffEntities(plain, debug)
+	if len(added) == 0 || len(removed) != 0 || len(base) != 1 {
+		t.Fatalf("enabling debug sensors: added %v, removed %v, base %d", added, removed, len(base))
+	}
+	added, removed = diffEntities(debug, plain)
+	if len(added) != 0 || len(removed) != len(debug)-len(plain) {
+		t.Fatalf("disabling debug sensors: added %v, removed %v", added, removed)
+	}
+	for _, key := range removed {
+		if _, ok := plain[key]; ok {
+			t.Fatalf("%s removed although it is still enabled", key)
+		}
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.ini")
+	if err := os.WriteFile(path, []byte("[mqtt]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	changed := watchConfigFile(path, 10*time.Millisecond, done)
+
+	select {
+	case <-changed:
+		t.Fatal("change signalled for an untouched file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("[mqtt]\nhost = broker\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change not signalled")
+	}
+}
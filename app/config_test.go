@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bridge.ini")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	path := writeConfig(t, `[mqtt]
+host = broker.lan
+
+[settings]
+polling_interval_seconds =
+ocpp_mismatch_seconds = 90
+colour = blue
+
+[extra]
+`)
+	c, warnings, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MQTT.Port != 1883 || c.Settings.PollingIntervalSeconds != 10 || c.Settings.DeviceName != "Wallbox" ||
+		c.Settings.OCPPMismatchSeconds != 90 || c.Settings.EventDebounceMilliseconds != 250 {
+		t.Fatalf("defaults not applied: %+v", c)
+	}
+	if c.Settings.HealStateFile != filepath.Join(filepath.Dir(path), "heal_state.json") {
+		t.Fatalf("heal_state_file = %q", c.Settings.HealStateFile)
+	}
+	want := []string{"[settings] colour: unknown key", "[extra]: unknown section"}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("warnings = %q, want %q", warnings, want)
+	}
+}
+
+func TestLoadConfigKeepsExplicitZero(t *testing.T) {
+	path := writeConfig(t, `[mqtt]
+host = broker.lan
+
+[settings]
+max_reboots_per_day = 0
+ocpp_max_restarts = 0
+ocpp_mismatch_seconds = 0
+ocpp_restart_cooldown_seconds = 0
+pilot_error_seconds = 0
+`)
+	t.Setenv("WALLBOX_SETTINGS_EVENT_DEBOUNCE_MS", "0")
+	c, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.Settings
+	if s.MaxRebootsPerDay != 0 || s.OCPPMismatchSeconds != 0 || s.OCPPRestartCooldown != 0 || s.EventDebounceMilliseconds != 0 {
+		t.Fatalf("explicit zeros replaced by defaults: %+v", s)
+	}
+	// The old setup wrote 0 for these without asking.
+	if s.OCPPMaxRestarts != 3 || s.PilotErrorSeconds != 300 {
+		t.Fatalf("legacy zeros not replaced by defaults: %+v", s)
+	}
+	if s.PollingIntervalSeconds != 10 || s.ServiceUnhealthySeconds == 0 {
+		t.Fatalf("defaults not applied to missing keys: %+v", s)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	if _, _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.ini")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	path := writeConfig(t, `[mqtt]
+port = 70000
+
+[settings]
+polling_interval_seconds = often
+debug_sensors = maybe
+
+[http]
+api = true
+`)
+	_, _, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected an invalid configuration")
+	}
+	// Type errors are reported before the values are validated.
+	for _, want := range []string{"[settings] polling_interval_seconds: Polling interval (s) must be a whole number", "[settings] debug_sensors"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+
+	path = writeConfig(t, `[mqtt]
+port = 70000
+
+[http]
+api = true
+
+[publish.charging_power]
+deadband = -1
+
+[heal_rule.custom]
+condition = nonsense >
+`)
+	_, _, err = LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected an invalid configuration")
+	}
+	for _, want := range []string{
+		"[mqtt] host: MQTT host is required",
+		"[mqtt] port: MQTT port must be between 1 and 65535",
+		"[http] token: required",
+		"publish policy charging_power",
+		"heal rule custom",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigEnvironmentOverrides(t *testing.T) {
+	path := writeConfig(t, "[mqtt]\nhost = broker.lan\n")
+	t.Setenv("WALLBOX_MQTT_HOST", "other.lan")
+	t.Setenv("WALLBOX_SETTINGS_DEBUG_SENSORS", "true")
+
+	c, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MQTT.Host != "other.lan" || !c.Settings.DebugSensors {
+		t.Fatalf("overrides not applied: %+v", c)
+	}
+
+	t.Setenv("WALLBOX_MQTT_PORT", "mqtt")
+	if _, _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "WALLBOX_MQTT_PORT") {
+		t.Fatalf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	var out bytes.Buffer
+	if !CheckConfig(writeConfig(t, "[mqtt]\nhost = broker.lan\nqos = 1\n"), &out) {
+		t.Fatalf("valid config rejected:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "warning: [mqtt] qos: unknown key") || !strings.Contains(out.String(), "is valid") {
+		t.Fatalf("output = %q", out.String())
+	}
+
+	out.Reset()
+	if CheckConfig(writeConfig(t, "[mqtt]\nport = 0x\n"), &out) {
+		t.Fatalf("invalid config accepted:\n%s", out.String())
+	}
+}
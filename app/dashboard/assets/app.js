@@ -0,0 +1,136 @@
+"use strict";
+
+const tokenKey = "wallbox-bridge-token";
+let token = localStorage.getItem(tokenKey) || "";
+let events = null;
+
+const $ = (selector) => document.querySelector(selector);
+
+function formatValue(el, value) {
+  if (value === undefined || value === null || value === "" || value === "None") {
+    return "–";
+  }
+  if (el.dataset.map) {
+    const map = JSON.parse(el.dataset.map);
+    if (value in map) {
+      return map[value];
+    }
+  }
+  const number = Number(value);
+  if (el.dataset.unit && !Number.isNaN(number)) {
+    return `${Math.round(number * 10) / 10} ${el.dataset.unit}`;
+  }
+  return value;
+}
+
+function renderHealHistory(entity) {
+  const body = $("#heal-history");
+  const history = entity && entity.attributes && entity.attributes.history;
+  if (!history || history.length === 0) {
+    return;
+  }
+  body.replaceChildren(...history.slice().reverse().slice(0, 10).map((entry) => {
+    const row = document.createElement("tr");
+    for (const text of [new Date(entry.at).toLocaleString(), entry.rule, entry.label || entry.action, entry.error || entry.detail]) {
+      const cell = document.createElement("td");
+      cell.textContent = text;
+      row.append(cell);
+    }
+    return row;
+  }));
+}
+
+function render(state) {
+  $("#serial").textContent = state.serial;
+  const entities = state.entities || {};
+  document.querySelectorAll("[data-entity]").forEach((el) => {
+    const entity = entities[el.dataset.entity];
+    el.textContent = formatValue(el, entity && entity.value);
+  });
+  document.querySelectorAll("[data-charger]").forEach((el) => {
+    el.textContent = formatValue(el, (state.charger || {})[el.dataset.charger]);
+  });
+
+  const maxCurrent = entities.max_charging_current;
+  const input = $("#max-current-value");
+  if (maxCurrent && document.activeElement !== input) {
+    input.value = maxCurrent.value;
+  }
+  renderHealHistory(entities.ocpp_last_heal_action);
+}
+
+function setConnected(connected) {
+  const badge = $("#connection");
+  badge.textContent = connected ? "live" : "offline";
+  badge.className = `badge ${connected ? "online" : "offline"}`;
+}
+
+function showLogin() {
+  if (events) {
+    events.close();
+    events = null;
+  }
+  $("#dashboard").hidden = true;
+  $("#login").hidden = false;
+}
+
+function connect() {
+  $("#login").hidden = true;
+  $("#dashboard").hidden = false;
+
+  events = new EventSource(`api/events?token=${encodeURIComponent(token)}`);
+  events.addEventListener("state", (event) => {
+    setConnected(true);
+    render(JSON.parse(event.data));
+  });
+  events.onerror = () => {
+    setConnected(false);
+    // A rejected token closes the stream; ask for it again.
+    fetch("api/state", { headers: { Authorization: `Bearer ${token}` } }).then((response) => {
+      if (response.status === 401) {
+        showLogin();
+      }
+    });
+  };
+}
+
+async function setEntity(key, value) {
+  const error = $("#control-error");
+  error.hidden = true;
+  try {
+    const response = await fetch(`api/entities/${key}`, {
+      method: "POST",
+      headers: { Authorization: `Bearer ${token}`, "Content-Type": "text/plain" },
+      body: String(value),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => ({}));
+      throw new Error(body.error || response.statusText);
+    }
+  } catch (err) {
+    error.textContent = `Setting ${key} failed: ${err.message}`;
+    error.hidden = false;
+  }
+}
+
+document.querySelectorAll("[data-set]").forEach((button) => {
+  button.addEventListener("click", () => setEntity(button.dataset.set, button.dataset.value));
+});
+
+$("#max-current").addEventListener("submit", (event) => {
+  event.preventDefault();
+  setEntity("max_charging_current", $("#max-current-value").value);
+});
+
+$("#login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  token = $("#token").value;
+  localStorage.setItem(tokenKey, token);
+  connect();
+});
+
+if (token) {
+  connect();
+} else {
+  showLogin();
+}
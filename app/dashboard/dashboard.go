@@ -0,0 +1,21 @@
+// Package dashboard embeds the local web dashboard.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Handler serves the dashboard assets. The page talks to the bridge through
+// /api/events (Server-Sent Events) and the REST API.
+func Handler() http.Handler {
+	sub, err := fs.Sub(assets, "assets")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}
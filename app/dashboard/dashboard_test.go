@@ -0,0 +1,21 @@
+package dashboard
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerServesAssets(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":          "<title>Wallbox</title>",
+		"/app.js":    "EventSource",
+		"/style.css": ".card",
+	} {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: status %d, body does not contain %q", path, rec.Code, want)
+		}
+	}
+}
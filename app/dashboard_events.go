@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// dashboardEventInterval limits how often the dashboard receives a state.
+const dashboardEventInterval = time.Second
+
+// dashboardKeepAlive keeps idle event streams open through proxies.
+const dashboardKeepAlive = 30 * time.Second
+
+type dashboardEntity struct {
+	Value      string          `json:"value"`
+	Attributes json.RawMessage `json:"attributes,omitempty"`
+}
+
+// dashboardState is the payload of a dashboard "state" event.
+type dashboardState struct {
+	Serial   string                     `json:"serial"`
+	Entities map[string]dashboardEntity `json:"entities"`
+	// Charger holds values that are not necessarily entities, such as the
+	// line voltages, which are only entities with debug_sensors.
+	Charger map[string]interface{} `json:"charger"`
+}
+
+func newDashboardState(serial string, w *wallbox.Wallbox, states *stateStore) dashboardState {
+	state := dashboardState{
+		Serial:   serial,
+		Entities: make(map[string]dashboardEntity),
+		Charger: map[string]interface{}{
+			"ocpp_status": w.OCPPStatusDescription(),
+		},
+	}
+	for _, s := range states.all() {
+		state.Entities[s.Key] = dashboardEntity{Value: s.Value, Attributes: s.Attributes}
+	}
+	for line, sensor := range map[string]string{
+		"voltage_l1": "SENSOR_INTERNAL_METER_VOLTAGE_L1",
+		"voltage_l2": "SENSOR_INTERNAL_METER_VOLTAGE_L2",
+		"voltage_l3": "SENSOR_INTERNAL_METER_VOLTAGE_L3",
+	} {
+		if value, ok := w.TelemetryValue(sensor); ok {
+			state.Charger[line] = value
+		}
+	}
+	return state
+}
+
+// dashboardEventsHandler streams the dashboard state as Server-Sent Events:
+// once on connect and then on every change, at most once per
+// dashboardEventInterval.
+func dashboardEventsHandler(serial string, w *wallbox.Wallbox, states *stateStore) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			apiError(rw, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+
+		keepAlive := time.NewTicker(dashboardKeepAlive)
+		defer keepAlive.Stop()
+
+		var lastSent time.Time
+		for {
+			// Take the channel before reading, so no change is missed.
+			changed := states.changes()
+			payload, _ := json.Marshal(newDashboardState(serial, w, states))
+			if _, err := fmt.Fprintf(rw, "event: state\ndata: %s\n\n", payload); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastSent = time.Now()
+
+		wait:
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-keepAlive.C:
+					if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+						return
+					}
+					flusher.Flush()
+				case <-changed:
+					break wait
+				}
+			}
+
+			if wait := dashboardEventInterval - time.Since(lastSent); wait > 0 {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// readEvent returns the data of the next "state" event.
+func readEvent(t *testing.T, r *bufio.Reader) dashboardState {
+	t.Helper()
+	var event string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "state":
+			var state dashboardState
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &state); err != nil {
+				t.Fatal(err)
+			}
+			return state
+		}
+	}
+}
+
+func TestDashboardEvents(t *testing.T) {
+	w := &wallbox.Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_INTERNAL_METER_VOLTAGE_L1","value":231}]}}`)
+	states := newStateStore()
+	states.update("charging_power", Entity{}, "0", nil, time.Now())
+
+	server := httptest.NewServer(requireToken("secret", true, dashboardEventsHandler("WB123", w, states)))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "?token=wrong"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %v, %v", resp, err)
+	}
+
+	resp, err := http.Get(server.URL + "?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+
+	first := readEvent(t, events)
+	if first.Serial != "WB123" || first.Entities["charging_power"].Value != "0" || first.Charger["voltage_l1"] != 231.0 {
+		t.Fatalf("first event = %+v", first)
+	}
+
+	states.update("charging_power", Entity{}, "7200", json.RawMessage(`{"phases":3}`), time.Now())
+	second := readEvent(t, events)
+	power := second.Entities["charging_power"]
+	if power.Value != "7200" || string(power.Attributes) != `{"phases":3}` {
+		t.Fatalf("second event charging_power = %+v", power)
+	}
+}
@@ -0,0 +1,224 @@
+package bridge
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wallbox-mqtt-bridge/app/heal"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// maxDiagnosticEvents bounds the Redis events a report keeps.
+const maxDiagnosticEvents = 200
+
+// redacted replaces secrets, and the serial if asked to, in a report.
+const redacted = "REDACTED"
+
+// diagnosticReport is what `bridge diagnose` collects for a support request.
+type diagnosticReport struct {
+	GeneratedAt     time.Time                           `json:"generated_at"`
+	BridgeVersion   string                              `json:"bridge_version"`
+	Firmware        string                              `json:"firmware"`
+	ChargerType     string                              `json:"charger_type"`
+	Serial          string                              `json:"serial"`
+	Config          diagnosticConfig                    `json:"config"`
+	DataCache       *wallbox.DataCache                  `json:"data_cache"`
+	Events          []diagnosticEvent                   `json:"events"`
+	OCPPJournal     wallbox.OCPPJournalState            `json:"ocpp_journal"`
+	OCPPJournalTail []string                            `json:"ocpp_journal_tail,omitempty"`
+	Services        map[string]wallbox.ServiceTelemetry `json:"services"`
+	HealHistory     []heal.HistoryEntry                 `json:"heal_history"`
+	Entities        map[string]statusEntity             `json:"entities"`
+	// Errors lists what could not be collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// diagnosticConfig is the effective configuration without secrets.
+type diagnosticConfig struct {
+	Fields          map[string]string     `json:"fields"`
+	HealRules       []HealRuleConfig      `json:"heal_rules,omitempty"`
+	PublishPolicies []PublishPolicyConfig `json:"publish_policies,omitempty"`
+}
+
+// diagnosticEvent is a Redis event received while the report was collected.
+type diagnosticEvent struct {
+	At      time.Time   `json:"at"`
+	Channel string      `json:"channel"`
+	Payload interface{} `json:"payload"`
+}
+
+// eventRecorder keeps the first maxDiagnosticEvents Redis events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []diagnosticEvent
+}
+
+func (r *eventRecorder) record(channel, message string) {
+	var payload interface{} = message
+	if json.Valid([]byte(message)) {
+		payload = json.RawMessage(message)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < maxDiagnosticEvents {
+		r.events = append(r.events, diagnosticEvent{At: time.Now(), Channel: channel, Payload: payload})
+	}
+}
+
+func (r *eventRecorder) take() []diagnosticEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]diagnosticEvent(nil), r.events...)
+}
+
+// redactConfig returns c with every secret that is set replaced.
+func redactConfig(c *WallboxConfig) diagnosticConfig {
+	config := diagnosticConfig{
+		Fields:          make(map[string]string, len(configFields)),
+		HealRules:       c.HealRules,
+		PublishPolicies: c.PublishPolicies,
+	}
+	for _, f := range configFields {
+		value := f.Get(c)
+		if f.Secret && value != "" {
+			value = redacted
+		}
+		config.Fields[f.Name()] = value
+	}
+	return config
+}
+
+func diagnoseCommand(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("diagnose", "[bridge.ini]", stderr)
+	output := flags.String("output", "-", `file to write, a gzipped tarball if it ends in .tar.gz or .tgz ("-" writes JSON to stdout)`)
+	redactSerial := flags.Bool("redact-serial", false, "replace the serial number everywhere in the report")
+	sample := flags.Duration("sample", 10*time.Second, "how long to record Redis events")
+	journalLines := flags.Int("journal-lines", 200, "lines of the ocppwallbox journal to include")
+	args, err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	events := &eventRecorder{}
+	charger, err := openCharger(configPathArg(args, 0), *sample, events.record)
+	if err != nil {
+		return err
+	}
+	defer charger.close()
+	time.Sleep(*sample - time.Since(started))
+
+	report := collectDiagnostics(charger, *journalLines)
+	report.Events = events.take()
+	if err := writeDiagnostics(stdout, report, *output, *redactSerial); err != nil {
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(stderr, "Diagnostics written to %s\n", *output)
+	}
+	return nil
+}
+
+// writeDiagnostics writes report as JSON to stdout if output is "-", and to
+// the file output otherwise. A file ending in .tar.gz or .tgz becomes a
+// gzipped tarball with the journal tail as a file of its own.
+func writeDiagnostics(stdout io.Writer, report diagnosticReport, output string, redactSerial bool) error {
+	var journal string
+	tarball := strings.HasSuffix(output, ".tar.gz") || strings.HasSuffix(output, ".tgz")
+	if tarball {
+		journal = strings.Join(report.OCPPJournalTail, "\n") + "\n"
+		report.OCPPJournalTail = nil
+	}
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	reportJSON = append(reportJSON, '\n')
+	if redactSerial && report.Serial != "" {
+		reportJSON = bytes.ReplaceAll(reportJSON, []byte(report.Serial), []byte(redacted))
+		journal = strings.ReplaceAll(journal, report.Serial, redacted)
+	}
+
+	if output == "-" {
+		_, err := stdout.Write(reportJSON)
+		return err
+	}
+	data := reportJSON
+	if tarball {
+		data, err = diagnosticTarball(report.GeneratedAt, map[string][]byte{
+			"report.json":     reportJSON,
+			"ocppwallbox.log": []byte(journal),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(output, data, 0o600)
+}
+
+// collectDiagnostics reports everything but the Redis events about charger.
+func collectDiagnostics(charger *cliCharger, journalLines int) diagnosticReport {
+	w := charger.w
+	report := diagnosticReport{
+		GeneratedAt:   time.Now().UTC(),
+		BridgeVersion: bridgeVersion(),
+		Firmware:      w.FirmwareVersion(),
+		ChargerType:   w.ChargerType,
+		Serial:        w.SerialNumber(),
+		Config:        redactConfig(charger.config),
+		DataCache:     w.Snapshot(),
+		OCPPJournal:   w.OCPPJournal(),
+		Services:      make(map[string]wallbox.ServiceTelemetry),
+		HealHistory:   charger.ocpp.heal.History(),
+		Entities:      entityStatus(charger.entities),
+	}
+	for _, service := range wallbox.WallboxServices {
+		if telemetry := w.ServiceTelemetry(service.Sensor); telemetry.Reported() {
+			report.Services[service.Name] = telemetry
+		}
+	}
+	if tail, err := w.System().JournalTail("ocppwallbox.service", journalLines); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("ocppwallbox journal: %v", err))
+	} else if tail = strings.TrimRight(tail, "\n"); tail != "" {
+		report.OCPPJournalTail = strings.Split(tail, "\n")
+	}
+	return report
+}
+
+// diagnosticTarball returns a gzipped tarball of files, sorted by name.
+func diagnosticTarball(modTime time.Time, files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(files[name])), ModTime: modTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactConfig(t *testing.T) {
+	c := defaultConfig()
+	c.MQTT.Password = "secret"
+	c.HTTP.Token = ""
+	c.HealRules = []HealRuleConfig{{Name: "pilot_error", Enabled: true}}
+
+	config := redactConfig(c)
+	if config.Fields["mqtt.password"] != redacted || config.Fields["http.token"] != "" || config.Fields["mqtt.host"] != c.MQTT.Host {
+		t.Fatalf("fields = %v", config.Fields)
+	}
+	if len(config.HealRules) != 1 {
+		t.Fatalf("heal rules = %v", config.HealRules)
+	}
+}
+
+func TestEventRecorder(t *testing.T) {
+	var r eventRecorder
+	r.record("/wbx/telemetry/events", `{"sensor_id":1}`)
+	r.record("/wbx/charger_state_machine/events", "not json")
+	for i := 0; i < maxDiagnosticEvents; i++ {
+		r.record("/wbx/telemetry/events", "{}")
+	}
+
+	events := r.take()
+	if len(events) != maxDiagnosticEvents {
+		t.Fatalf("%d events kept", len(events))
+	}
+	payload, _ := json.Marshal(events[:2])
+	if !strings.Contains(string(payload), `"payload":{"sensor_id":1}`) || !strings.Contains(string(payload), `"payload":"not json"`) {
+		t.Fatalf("events = %s", payload)
+	}
+}
+
+func testDiagnosticReport() diagnosticReport {
+	return diagnosticReport{
+		GeneratedAt:     time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Serial:          "123456",
+		Entities:        map[string]statusEntity{"serial": {Value: "123456"}},
+		OCPPJournalTail: []string{"BootNotification from 123456", "Heartbeat"},
+	}
+}
+
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeDiagnostics(&out, testDiagnosticReport(), "-", true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "123456") {
+		t.Fatalf("serial not redacted:\n%s", out.String())
+	}
+	var report diagnosticReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Serial != redacted || len(report.OCPPJournalTail) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestWriteDiagnosticsTarball(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "diagnostics.tar.gz")
+	if err := writeDiagnostics(io.Discard, testDiagnosticReport(), path, false); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+
+	if files["ocppwallbox.log"] != "BootNotification from 123456\nHeartbeat\n" {
+		t.Fatalf("journal = %q", files["ocppwallbox.log"])
+	}
+	if !strings.Contains(files["report.json"], `"serial": "123456"`) || strings.Contains(files["report.json"], "ocpp_journal_tail") {
+		t.Fatalf("report.json = %s", files["report.json"])
+	}
+}
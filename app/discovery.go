@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// discoveryDevice is the charger as Home Assistant MQTT discovery shows it.
+type discoveryDevice struct {
+	Serial   string
+	Name     string
+	Firmware string
+}
+
+func (d discoveryDevice) topicPrefix() string {
+	return "wallbox_" + d.Serial
+}
+
+func (d discoveryDevice) availabilityTopic() string {
+	return d.topicPrefix() + "/availability"
+}
+
+// discoveryTopic is the retained topic holding the discovery config of an
+// entity.
+func discoveryTopic(d discoveryDevice, key string, val Entity) string {
+	return "homeassistant/" + val.Component + "/" + d.Serial + "_" + key + "/config"
+}
+
+// discoveryConfig returns the discovery config of an entity.
+func discoveryConfig(d discoveryDevice, key string, val Entity) []byte {
+	config := map[string]interface{}{
+		"~":                  d.topicPrefix() + "/" + key,
+		"availability_topic": d.availabilityTopic(),
+		"state_topic":        "~/state",
+		"unique_id":          d.Serial + "_" + key,
+		"device":             discoveryDeviceConfig(d),
+	}
+	if val.Setter != nil {
+		config["command_topic"] = "~/set"
+	}
+	if val.Attributes != nil {
+		config["json_attributes_topic"] = "~/attributes"
+	}
+	if val.Component == "select" {
+		// Home Assistant MQTT discovery requires an "options" field for select entities.
+		// Always include it, even if empty, to ensure the entity is created.
+		if val.Options != nil {
+			config["options"] = val.Options
+		} else {
+			config["options"] = []string{}
+		}
+	}
+	if val.Component == "event" {
+		// Event entities have no state, only the events on ~/event. The key
+		// may be shared with an entity of another component.
+		config["state_topic"] = "~/event"
+		config["event_types"] = val.Options
+		config["unique_id"] = d.Serial + "_" + key + "_event"
+	}
+	for k, v := range val.Config {
+		config[k] = v
+	}
+	payload, _ := json.Marshal(config)
+	return payload
+}
+
+// discoveryDeviceConfig returns the device block of the discovery configs.
+func discoveryDeviceConfig(d discoveryDevice) map[string]string {
+	return map[string]string{
+		"identifiers": d.Serial,
+		"name":        d.Name,
+		"sw_version":  fmt.Sprintf("%s (FW %s)", bridgeVersion(), d.Firmware),
+	}
+}
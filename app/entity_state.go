@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// entityState is the last value read from an entity by the publish loop,
+// before any publish policy was applied.
+type entityState struct {
+	Key        string
+	Component  string
+	Value      string
+	Attributes json.RawMessage
+	Config     map[string]string
+	Options    []string
+	Settable   bool
+	UpdatedAt  time.Time
+}
+
+// stateStore shares the entity values read by the publish loop with the
+// HTTP server, so that requests never call getters concurrently with it.
+type stateStore struct {
+	mux     sync.RWMutex
+	states  map[string]entityState
+	changed chan struct{}
+}
+
+func newStateStore() *stateStore {
+	return &stateStore{states: make(map[string]entityState), changed: make(chan struct{})}
+}
+
+// update records the value and, for entities with attributes, their JSON.
+func (s *stateStore) update(key string, entity Entity, value string, attributes json.RawMessage, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	old, seen := s.states[key]
+	s.states[key] = entityState{
+		Key:        key,
+		Component:  entity.Component,
+		Value:      value,
+		Attributes: attributes,
+		Config:     entity.Config,
+		Options:    entity.Options,
+		Settable:   entity.Setter != nil,
+		UpdatedAt:  now,
+	}
+	if !seen || old.Value != value || string(old.Attributes) != string(attributes) {
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+}
+
+// remove forgets an entity that is no longer published.
+func (s *stateStore) remove(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.states[key]; !ok {
+		return
+	}
+	delete(s.states, key)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// changes returns a channel that is closed on the next change of a value or
+// its attributes.
+func (s *stateStore) changes() <-chan struct{} {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.changed
+}
+
+// all returns the states sorted by key.
+func (s *stateStore) all() []entityState {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	states := make([]entityState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"encoding/json"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// eventGroup is a Home Assistant event entity. Its events are published as
+// JSON on <prefix>/<key>/event, with the event type under "event_type", and
+// every event type is also offered as a device trigger.
+type eventGroup struct {
+	Key   string
+	Name  string
+	Icon  string
+	Types []string
+}
+
+// eventGroups are the event entities of a charger. The heal group uses the
+// topic heal outcomes have always been published on.
+var eventGroups = []eventGroup{
+	{Key: "cable", Name: "Cable", Icon: "mdi:ev-plug-type2", Types: []string{"plugged", "unplugged"}},
+	{Key: "charging", Name: "Charging", Icon: "mdi:ev-station", Types: []string{"started", "stopped", "session_finished"}},
+	{Key: "lock", Name: "Lock", Icon: "mdi:lock-clock", Types: []string{"locked", "unlocked"}},
+	{Key: "ocpp_mismatch", Name: "OCPP mismatch", Icon: "mdi:lan-disconnect", Types: []string{"raised", "cleared"}},
+	{Key: "heal", Name: "Heal action", Icon: "mdi:medical-bag", Types: []string{"action_executed"}},
+	{Key: "fault", Name: "Fault", Icon: "mdi:alert-circle", Types: []string{"firmware_error", "welding_detected"}},
+}
+
+// chargerEvent is a discrete occurrence of an event group.
+type chargerEvent struct {
+	Group      string
+	Type       string
+	Attributes map[string]interface{}
+}
+
+func (e chargerEvent) topic(d discoveryDevice) string {
+	return eventTopic(d, e.Group)
+}
+
+// payload returns the event as Home Assistant event entities expect it.
+func (e chargerEvent) payload() []byte {
+	payload := map[string]interface{}{"event_type": e.Type}
+	for k, v := range e.Attributes {
+		payload[k] = v
+	}
+	encoded, _ := json.Marshal(payload)
+	return encoded
+}
+
+func eventTopic(d discoveryDevice, group string) string {
+	return d.topicPrefix() + "/" + group + "/event"
+}
+
+// eventEntities returns the event entities, keyed like other entities.
+func eventEntities() map[string]Entity {
+	entities := make(map[string]Entity, len(eventGroups))
+	for _, g := range eventGroups {
+		entities[g.Key] = Entity{
+			Component: "event",
+			Options:   g.Types,
+			Config: map[string]string{
+				"name": g.Name,
+				"icon": g.Icon,
+			},
+		}
+	}
+	return entities
+}
+
+// deviceTriggerDiscovery returns the discovery topics and configs of the
+// device triggers, one per event type.
+func deviceTriggerDiscovery(d discoveryDevice) map[string][]byte {
+	configs := make(map[string][]byte)
+	for _, g := range eventGroups {
+		for _, eventType := range g.Types {
+			id := d.Serial + "_" + g.Key + "_" + eventType
+			config, _ := json.Marshal(map[string]interface{}{
+				"automation_type": "trigger",
+				"topic":           eventTopic(d, g.Key),
+				"type":            g.Key,
+				"subtype":         eventType,
+				"payload":         eventType,
+				"value_template":  "{{ value_json.event_type }}",
+				"device":          discoveryDeviceConfig(d),
+			})
+			configs["homeassistant/device_automation/"+id+"/config"] = config
+		}
+	}
+	return configs
+}
+
+// eventSample holds the readings charger events are derived from.
+type eventSample struct {
+	CableConnected bool
+	Charging       bool
+	AddedEnergy    float64
+	Locked         bool
+	OCPPMismatch   bool
+	FirmwareError  int
+	Welding        bool
+}
+
+func sampleEvents(w *wallbox.Wallbox, ocppMismatch bool) eventSample {
+	d := w.Snapshot()
+	return eventSample{
+		CableConnected: w.CableConnected() == 1,
+		Charging:       w.EffectiveStatus() == "Charging",
+		AddedEnergy:    w.AddedEnergy(),
+		Locked:         d.SQL.Lock == 1,
+		OCPPMismatch:   ocppMismatch,
+		FirmwareError:  int(d.Telemetry.Get("SENSOR_FIRMWARE_ERROR")),
+		Welding:        d.Telemetry.Get("SENSOR_WELDING") != 0,
+	}
+}
+
+// eventDetector turns the changes between samples into charger events. The
+// first sample only sets the baseline.
+type eventDetector struct {
+	// user, if set, returns the user a lock change is attributed to.
+	user func() string
+
+	last          *eventSample
+	sessionEnergy float64
+}
+
+func (d *eventDetector) detect(s eventSample) []chargerEvent {
+	last := d.last
+	d.last = &s
+	if s.CableConnected && s.AddedEnergy > d.sessionEnergy {
+		d.sessionEnergy = s.AddedEnergy
+	}
+	if last == nil {
+		return nil
+	}
+
+	var events []chargerEvent
+	add := func(group, eventType string, attributes map[string]interface{}) {
+		events = append(events, chargerEvent{Group: group, Type: eventType, Attributes: attributes})
+	}
+	if s.CableConnected != last.CableConnected {
+		if s.CableConnected {
+			add("cable", "plugged", nil)
+		} else {
+			add("cable", "unplugged", nil)
+		}
+	}
+	if s.Charging != last.Charging {
+		if s.Charging {
+			add("charging", "started", nil)
+		} else {
+			add("charging", "stopped", map[string]interface{}{"added_energy_wh": s.AddedEnergy})
+		}
+	}
+	if last.CableConnected && !s.CableConnected {
+		if d.sessionEnergy > 0 {
+			add("charging", "session_finished", map[string]interface{}{"added_energy_wh": d.sessionEnergy})
+		}
+		d.sessionEnergy = 0
+	}
+	if s.Locked != last.Locked {
+		var attributes map[string]interface{}
+		if d.user != nil {
+			attributes = map[string]interface{}{"user_id": d.user()}
+		}
+		if s.Locked {
+			add("lock", "locked", attributes)
+		} else {
+			add("lock", "unlocked", attributes)
+		}
+	}
+	if s.OCPPMismatch != last.OCPPMismatch {
+		if s.OCPPMismatch {
+			add("ocpp_mismatch", "raised", nil)
+		} else {
+			add("ocpp_mismatch", "cleared", nil)
+		}
+	}
+	if s.FirmwareError != 0 && s.FirmwareError != last.FirmwareError {
+		add("fault", "firmware_error", map[string]interface{}{"code": s.FirmwareError})
+	}
+	if s.Welding && !last.Welding {
+		add("fault", "welding_detected", nil)
+	}
+	return events
+}
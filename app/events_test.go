@@ -0,0 +1,83 @@
+package bridge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEventDetector(t *testing.T) {
+	d := &eventDetector{user: func() string { return "42" }}
+	if events := d.detect(eventSample{Locked: true}); events != nil {
+		t.Fatalf("baseline produced %v", events)
+	}
+
+	steps := []struct {
+		sample eventSample
+		want   []string
+	}{
+		{eventSample{Locked: false}, []string{"lock unlocked"}},
+		{eventSample{CableConnected: true}, []string{"cable plugged"}},
+		{eventSample{CableConnected: true, Charging: true, AddedEnergy: 500}, []string{"charging started"}},
+		{eventSample{CableConnected: true, Charging: true, AddedEnergy: 7000, OCPPMismatch: true}, []string{"ocpp_mismatch raised"}},
+		{eventSample{CableConnected: true, AddedEnergy: 7200}, []string{"charging stopped", "ocpp_mismatch cleared"}},
+		{eventSample{FirmwareError: 3, Welding: true}, []string{"cable unplugged", "charging session_finished", "fault firmware_error", "fault welding_detected"}},
+		{eventSample{FirmwareError: 3, Welding: true}, nil},
+	}
+	for i, step := range steps {
+		var got []string
+		for _, event := range d.detect(step.sample) {
+			got = append(got, event.Group+" "+event.Type)
+			switch event.Type {
+			case "unlocked":
+				if event.Attributes["user_id"] != "42" {
+					t.Errorf("step %d: lock attributes = %v", i, event.Attributes)
+				}
+			case "session_finished":
+				if event.Attributes["added_energy_wh"] != 7200.0 {
+					t.Errorf("step %d: session attributes = %v", i, event.Attributes)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: events = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestEventDiscovery(t *testing.T) {
+	device := discoveryDevice{Serial: "12345", Name: "Garage"}
+
+	entity := eventEntities()["lock"]
+	if topic := discoveryTopic(device, "lock", entity); topic != "homeassistant/event/12345_lock/config" {
+		t.Fatalf("topic = %s", topic)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(discoveryConfig(device, "lock", entity), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["unique_id"] != "12345_lock_event" || config["state_topic"] != "~/event" || config["~"] != "wallbox_12345/lock" {
+		t.Fatalf("config = %v", config)
+	}
+	if types, _ := config["event_types"].([]interface{}); len(types) != 2 || types[1] != "unlocked" {
+		t.Fatalf("event_types = %v", config["event_types"])
+	}
+
+	triggers := deviceTriggerDiscovery(device)
+	payload, ok := triggers["homeassistant/device_automation/12345_cable_plugged/config"]
+	if !ok {
+		t.Fatalf("no trigger for plugging the cable in %v", triggers)
+	}
+	config = nil
+	if err := json.Unmarshal(payload, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["topic"] != "wallbox_12345/cable/event" || config["payload"] != "plugged" || config["automation_type"] != "trigger" {
+		t.Fatalf("trigger = %v", config)
+	}
+
+	event := chargerEvent{Group: "cable", Type: "plugged"}
+	if string(event.payload()) != `{"event_type":"plugged"}` || event.topic(device) != "wallbox_12345/cable/event" {
+		t.Fatalf("event %s on %s", event.payload(), event.topic(device))
+	}
+}
@@ -0,0 +1,63 @@
+package heal
+
+import "time"
+
+// Names of the built-in rules. An INI rule section with the same name
+// overrides the built-in definition.
+const (
+	OCPPMismatchRuleName = "ocpp_mismatch"
+	PilotErrorRuleName   = "pilot_error"
+)
+
+// OCPPMismatchRule restarts the OCPP service while the control pilot reports
+// a connected car but OCPP reports a problem state, optionally escalating to a
+// full Wallbox reboot once maxRestarts restarts did not help.
+func OCPPMismatchRule(persist, cooldown time.Duration, maxRestarts int, fullReboot bool) Rule {
+	ladder := []Step{{Action: RestartService, Attempts: maxRestarts}}
+	if fullReboot {
+		ladder = append(ladder, Step{Action: VendorReboot, Attempts: 1})
+	}
+	return Rule{
+		Name:      OCPPMismatchRuleName,
+		Condition: MustParseCondition("ocpp_mismatch == 1"),
+		Persist:   persist,
+		Cooldown:  cooldown,
+		Ladder:    ladder,
+		Service:   "ocppwallbox.service",
+	}
+}
+
+// PilotErrorRule reboots the Wallbox when the control pilot stays in error
+// state 14 for the given duration.
+func PilotErrorRule(persist time.Duration) Rule {
+	return Rule{
+		Name:      PilotErrorRuleName,
+		Condition: MustParseCondition("control_pilot_code == 14"),
+		Persist:   persist,
+		Cooldown:  persist,
+		Ladder:    []Step{{Action: VendorReboot, Attempts: 3}},
+	}
+}
+
+// ServiceRuleName is the name of the built-in rule healing the named Wallbox
+// service, e.g. "service_redis".
+func ServiceRuleName(service string) string {
+	return "service_" + service
+}
+
+// ServiceHealthRule restarts a Wallbox service that telemetry reports as not
+// running for the given duration, rebooting the Wallbox if restarts do not
+// bring it back.
+func ServiceHealthRule(service, unit string, persist time.Duration) Rule {
+	return Rule{
+		Name:      ServiceRuleName(service),
+		Condition: MustParseCondition(ServiceRuleName(service) + "_unhealthy == 1"),
+		Persist:   persist,
+		Cooldown:  10 * time.Minute,
+		Ladder: []Step{
+			{Action: RestartService, Attempts: 2},
+			{Action: VendorReboot, Attempts: 1},
+		},
+		Service: unit,
+	}
+}
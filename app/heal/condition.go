@@ -0,0 +1,110 @@
+package heal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Readings are the named Wallbox values a rule condition is evaluated
+// against. Booleans are represented as 0/1; missing readings evaluate as 0.
+type Readings map[string]float64
+
+// Condition is a parsed rule condition such as
+// "pilot_connected == 1 && ocpp_disconnect == 1". Comparisons are joined by
+// "&&", which binds tighter than "||". A bare reading name is true when the
+// reading is non-zero.
+type Condition struct {
+	source string
+	anyOf  [][]comparison
+}
+
+type comparison struct {
+	reading string
+	op      string
+	value   float64
+}
+
+var comparisonRe = regexp.MustCompile(`^([a-z][a-z0-9_]*)\s*(?:(==|!=|>=|<=|>|<)\s*(-?[0-9]+(?:\.[0-9]+)?))?$`)
+
+// ParseCondition parses a rule condition expression.
+func ParseCondition(expr string) (Condition, error) {
+	cond := Condition{source: strings.TrimSpace(expr)}
+	if cond.source == "" {
+		return Condition{}, fmt.Errorf("empty condition")
+	}
+
+	for _, alternative := range strings.Split(cond.source, "||") {
+		var all []comparison
+		for _, part := range strings.Split(alternative, "&&") {
+			part = strings.TrimSpace(part)
+			matches := comparisonRe.FindStringSubmatch(part)
+			if matches == nil {
+				return Condition{}, fmt.Errorf("invalid comparison %q in condition %q", part, cond.source)
+			}
+			cmp := comparison{reading: matches[1], op: "!=", value: 0}
+			if matches[2] != "" {
+				value, err := strconv.ParseFloat(matches[3], 64)
+				if err != nil {
+					return Condition{}, fmt.Errorf("invalid value in %q: %w", part, err)
+				}
+				cmp.op = matches[2]
+				cmp.value = value
+			}
+			all = append(all, cmp)
+		}
+		cond.anyOf = append(cond.anyOf, all)
+	}
+
+	return cond, nil
+}
+
+// MustParseCondition is like ParseCondition but panics on error. It is meant
+// for the built-in rules.
+func MustParseCondition(expr string) Condition {
+	cond, err := ParseCondition(expr)
+	if err != nil {
+		panic(err)
+	}
+	return cond
+}
+
+// Eval reports whether the condition holds for the given readings.
+func (c Condition) Eval(r Readings) bool {
+	for _, all := range c.anyOf {
+		matched := true
+		for _, cmp := range all {
+			if !cmp.eval(r[cmp.reading]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) String() string {
+	return c.source
+}
+
+func (c comparison) eval(v float64) bool {
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case ">":
+		return v > c.value
+	case "<":
+		return v < c.value
+	case ">=":
+		return v >= c.value
+	case "<=":
+		return v <= c.value
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+package heal
+
+import (
+	"fmt"
+	"time"
+
+	"wallbox-mqtt-bridge/app/logging"
+)
+
+var logger = logging.New("heal")
+
+// Clock abstracts time so rules can be tested deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock returns the wall clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// Executor carries out heal actions. It returns a short action label and a
+// human readable detail describing what was actually done, which may differ
+// from the requested action when a fallback was used.
+type Executor interface {
+	Execute(rule Rule, action Action) (label string, detail string, err error)
+}
+
+// Outcome describes one executed heal action.
+type Outcome struct {
+	Rule    string
+	Service string
+	Action  Action
+	Label   string
+	Detail  string
+	Err     error
+	Attempt int
+	At      time.Time
+	// Held is how long the condition had persisted when the action ran.
+	Held time.Duration
+}
+
+type ruleState struct {
+	rule       Rule
+	active     bool
+	since      time.Time
+	attempts   int
+	lastAction time.Time
+	exhausted  bool
+	// clearSince is when the condition was first seen clear without having
+	// been met since the engine started.
+	clearSince time.Time
+}
+
+// clearResetAfter is how long a condition that has not been met since the
+// engine started must stay clear before the ladder progress restored for it
+// is reset. Readings are often missing for a while after a reboot, which
+// must not restart the ladder.
+const clearResetAfter = 10 * time.Minute
+
+// Engine evaluates heal rules against Wallbox readings and runs their
+// escalation ladders.
+type Engine struct {
+	clock    Clock
+	executor Executor
+	rules    []*ruleState
+	history  []HistoryEntry
+	reboots  []time.Time
+
+	// OnOutcome, if set, is called for every executed action.
+	OnOutcome func(Outcome)
+	// Store, if set, receives the engine state before and after every
+	// action, so ladder progress survives the reboots the engine triggers.
+	Store Store
+	// MaxRebootsPerDay caps reboot actions within any 24 hours, across
+	// bridge restarts when a Store is set. Negative, the default, means
+	// unlimited; zero allows none.
+	MaxRebootsPerDay int
+}
+
+// NewEngine creates an engine for the given rules. Rules are evaluated in
+// order on every call to Evaluate.
+func NewEngine(rules []Rule, executor Executor, clock Clock) *Engine {
+	e := &Engine{clock: clock, executor: executor, MaxRebootsPerDay: -1}
+	for _, rule := range rules {
+		e.rules = append(e.rules, &ruleState{rule: rule})
+	}
+	return e
+}
+
+// Rules returns the configured rules.
+func (e *Engine) Rules() []Rule {
+	rules := make([]Rule, 0, len(e.rules))
+	for _, state := range e.rules {
+		rules = append(rules, state.rule)
+	}
+	return rules
+}
+
+// SetRules replaces the rules, e.g. after a configuration reload. Rules that
+// keep their name keep their condition timer and ladder progress; the
+// progress of removed rules is dropped.
+func (e *Engine) SetRules(rules []Rule) {
+	previous := make(map[string]*ruleState, len(e.rules))
+	for _, state := range e.rules {
+		previous[state.rule.Name] = state
+	}
+	e.rules = e.rules[:0:0]
+	for _, rule := range rules {
+		state := &ruleState{rule: rule}
+		if old, ok := previous[rule.Name]; ok {
+			*state = *old
+			state.rule = rule
+		}
+		e.rules = append(e.rules, state)
+	}
+	e.save()
+}
+
+// Active reports whether the named rule's condition currently holds.
+func (e *Engine) Active(name string) bool {
+	for _, state := range e.rules {
+		if state.rule.Name == name {
+			return state.active
+		}
+	}
+	return false
+}
+
+// Restore loads ladder progress, history and reboot times from a previous
+// run. Conditions are re-evaluated from scratch, so persistence timers start
+// again, but attempts and cooldowns carry over.
+func (e *Engine) Restore(state State) {
+	for _, rs := range e.rules {
+		saved, ok := state.Rules[rs.rule.Name]
+		if !ok {
+			continue
+		}
+		rs.attempts = saved.Attempts
+		rs.lastAction = saved.LastAction
+		rs.exhausted = saved.Exhausted
+	}
+	e.history = append([]HistoryEntry(nil), state.History...)
+	e.reboots = append([]time.Time(nil), state.Reboots...)
+}
+
+// State returns the persistent engine state.
+func (e *Engine) State() State {
+	state := State{
+		Rules:   make(map[string]RuleState, len(e.rules)),
+		History: append([]HistoryEntry(nil), e.history...),
+		Reboots: append([]time.Time(nil), e.reboots...),
+	}
+	for _, rs := range e.rules {
+		state.Rules[rs.rule.Name] = RuleState{
+			Attempts:   rs.attempts,
+			LastAction: rs.lastAction,
+			Exhausted:  rs.exhausted,
+		}
+	}
+	return state
+}
+
+// History returns the executed actions, oldest first.
+func (e *Engine) History() []HistoryEntry {
+	return append([]HistoryEntry(nil), e.history...)
+}
+
+// Evaluate checks every rule against the readings and executes at most one
+// ladder action per rule. It returns the outcomes of the executed actions.
+func (e *Engine) Evaluate(r Readings) []Outcome {
+	now := e.clock.Now()
+	var outcomes []Outcome
+
+	for _, state := range e.rules {
+		rule := state.rule
+
+		if !rule.Condition.Eval(r) {
+			reset := state.active
+			if state.active {
+				logger.Infof("%s cleared after %d attempt(s)", rule.Name, state.attempts)
+			} else if state.clearSince.IsZero() {
+				state.clearSince = now
+			} else {
+				reset = now.Sub(state.clearSince) >= clearResetAfter
+			}
+			state.active = false
+			state.since = time.Time{}
+			if reset && (state.attempts != 0 || state.exhausted) {
+				state.attempts = 0
+				state.exhausted = false
+				e.save()
+			}
+			continue
+		}
+		state.clearSince = time.Time{}
+
+		if !state.active {
+			state.active = true
+			state.since = now
+			logger.Infof("%s condition met (%s)", rule.Name, rule.Condition)
+		}
+
+		if state.exhausted || now.Sub(state.since) < rule.Persist {
+			continue
+		}
+		if !state.lastAction.IsZero() && now.Sub(state.lastAction) < rule.Cooldown {
+			continue
+		}
+		if state.attempts >= rule.maxAttempts() {
+			logger.Warnf("%s still active after %d attempt(s); giving up until it clears", rule.Name, state.attempts)
+			state.exhausted = true
+			e.save()
+			continue
+		}
+
+		outcomes = append(outcomes, e.run(state, now))
+	}
+
+	return outcomes
+}
+
+func (e *Engine) run(state *ruleState, now time.Time) Outcome {
+	rule := state.rule
+	action := rule.actionFor(state.attempts)
+	held := now.Sub(state.since)
+
+	state.attempts++
+	state.lastAction = now
+	// Give the action a full persistence period to take effect before the
+	// next rung is considered.
+	state.since = now
+
+	outcome := Outcome{
+		Rule:    rule.Name,
+		Service: rule.Service,
+		Action:  action,
+		Attempt: state.attempts,
+		At:      now,
+		Held:    held,
+	}
+
+	if isReboot(action) && !e.allowReboot(now) {
+		outcome.Label = "reboot_suppressed"
+		outcome.Detail = fmt.Sprintf("%s skipped: %d reboots in the last 24h", action, e.MaxRebootsPerDay)
+		outcome.Err = fmt.Errorf("daily reboot limit of %d reached", e.MaxRebootsPerDay)
+		logger.Warnf("%s %s", rule.Name, outcome.Detail)
+		e.record(outcome)
+		return outcome
+	}
+
+	logger.Infof("%s held for %s, running %s [attempt %d/%d]",
+		rule.Name, held.Round(time.Second), action, state.attempts, rule.maxAttempts())
+
+	if isReboot(action) {
+		e.reboots = append(e.reboots, now)
+		// Persist before rebooting; the bridge may not get another chance.
+		e.recordPending(outcome)
+	}
+
+	outcome.Label, outcome.Detail, outcome.Err = e.executor.Execute(rule, action)
+	if outcome.Err != nil {
+		// Only actions that ran count towards the ladder: a failed one is
+		// tried again on the same rung once the cooldown has passed.
+		state.attempts--
+		if isReboot(action) {
+			e.reboots = e.reboots[:len(e.reboots)-1]
+		}
+		logger.Errorf("%s %s failed, retrying after cooldown: %v", rule.Name, action, outcome.Err)
+	}
+	e.record(outcome)
+	return outcome
+}
+
+func isReboot(action Action) bool {
+	return action == VendorReboot || action == SystemReboot
+}
+
+// allowReboot applies the daily reboot guard and drops reboots older than a
+// day from the bookkeeping.
+func (e *Engine) allowReboot(now time.Time) bool {
+	recent := e.reboots[:0]
+	for _, at := range e.reboots {
+		if now.Sub(at) < 24*time.Hour {
+			recent = append(recent, at)
+		}
+	}
+	e.reboots = recent
+	return e.MaxRebootsPerDay < 0 || len(e.reboots) < e.MaxRebootsPerDay
+}
+
+func (e *Engine) recordPending(o Outcome) {
+	o.Label = string(o.Action)
+	o.Detail = "pending"
+	e.appendHistory(o)
+	e.save()
+	e.history = e.history[:len(e.history)-1]
+}
+
+func (e *Engine) record(o Outcome) {
+	e.appendHistory(o)
+	e.save()
+	if e.OnOutcome != nil {
+		e.OnOutcome(o)
+	}
+}
+
+func (e *Engine) appendHistory(o Outcome) {
+	entry := HistoryEntry{
+		Rule:    o.Rule,
+		Service: o.Service,
+		Action:  o.Action,
+		Label:   o.Label,
+		Detail:  o.Detail,
+		Attempt: o.Attempt,
+		At:      o.At,
+	}
+	if o.Err != nil {
+		entry.Error = o.Err.Error()
+	}
+	e.history = append(e.history, entry)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+func (e *Engine) save() {
+	if e.Store == nil {
+		return
+	}
+	if err := e.Store.Save(e.State()); err != nil {
+		logger.Errorf("failed to persist state: %v", err)
+	}
+}
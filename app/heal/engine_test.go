@@ -0,0 +1,254 @@
+package heal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+type fakeExecutor struct {
+	actions []Action
+	err     error
+}
+
+func (f *fakeExecutor) Execute(rule Rule, action Action) (string, string, error) {
+	f.actions = append(f.actions, action)
+	return string(action), rule.Name + " " + string(action), f.err
+}
+
+func newTestEngine(rules ...Rule) (*Engine, *fakeClock, *fakeExecutor) {
+	clock := &fakeClock{now: time.Date(2025, 11, 23, 12, 0, 0, 0, time.UTC)}
+	executor := &fakeExecutor{}
+	return NewEngine(rules, executor, clock), clock, executor
+}
+
+func TestOCPPMismatchRuleEscalates(t *testing.T) {
+	engine, clock, executor := newTestEngine(OCPPMismatchRule(60*time.Second, 300*time.Second, 2, true))
+	mismatch := Readings{"ocpp_mismatch": 1}
+
+	// Not yet persisted long enough.
+	engine.Evaluate(mismatch)
+	clock.Advance(59 * time.Second)
+	if outcomes := engine.Evaluate(mismatch); len(outcomes) != 0 {
+		t.Fatalf("expected no action before persistence elapsed, got %+v", outcomes)
+	}
+
+	clock.Advance(time.Second)
+	outcomes := engine.Evaluate(mismatch)
+	if len(outcomes) != 1 || outcomes[0].Action != RestartService || outcomes[0].Attempt != 1 {
+		t.Fatalf("expected first restart, got %+v", outcomes)
+	}
+
+	// Cooldown blocks the next attempt even though persistence elapsed.
+	clock.Advance(120 * time.Second)
+	if outcomes := engine.Evaluate(mismatch); len(outcomes) != 0 {
+		t.Fatalf("expected cooldown to suppress action, got %+v", outcomes)
+	}
+
+	clock.Advance(180 * time.Second)
+	engine.Evaluate(mismatch)
+	clock.Advance(300 * time.Second)
+	engine.Evaluate(mismatch)
+	clock.Advance(300 * time.Second)
+	engine.Evaluate(mismatch)
+
+	want := []Action{RestartService, RestartService, VendorReboot}
+	if len(executor.actions) != len(want) {
+		t.Fatalf("expected actions %v, got %v", want, executor.actions)
+	}
+	for i := range want {
+		if executor.actions[i] != want[i] {
+			t.Fatalf("expected actions %v, got %v", want, executor.actions)
+		}
+	}
+}
+
+func TestOCPPMismatchRuleResetsWhenCleared(t *testing.T) {
+	engine, clock, executor := newTestEngine(OCPPMismatchRule(60*time.Second, 60*time.Second, 1, false))
+
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(60 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+
+	// Ladder exhausted: nothing else happens while the mismatch persists.
+	clock.Advance(10 * time.Minute)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	if len(executor.actions) != 1 {
+		t.Fatalf("expected a single restart before giving up, got %v", executor.actions)
+	}
+	if !engine.Active(OCPPMismatchRuleName) {
+		t.Fatalf("expected rule to still be active")
+	}
+
+	// Clearing the condition resets the ladder.
+	engine.Evaluate(Readings{"ocpp_mismatch": 0})
+	if engine.Active(OCPPMismatchRuleName) {
+		t.Fatalf("expected rule to be inactive after clearing")
+	}
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(60 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	if len(executor.actions) != 2 {
+		t.Fatalf("expected a new restart after the mismatch re-appeared, got %v", executor.actions)
+	}
+}
+
+func TestSetRulesKeepsProgress(t *testing.T) {
+	engine, clock, executor := newTestEngine(OCPPMismatchRule(60*time.Second, 300*time.Second, 3, false))
+	mismatch := Readings{"ocpp_mismatch": 1}
+
+	engine.Evaluate(mismatch)
+	clock.Advance(30 * time.Second)
+	engine.Evaluate(mismatch)
+
+	// A shorter persistence applies to the condition that is already held.
+	engine.SetRules([]Rule{
+		OCPPMismatchRule(45*time.Second, 300*time.Second, 3, false),
+		PilotErrorRule(5 * time.Minute),
+	})
+	if len(engine.Rules()) != 2 || !engine.Active(OCPPMismatchRuleName) {
+		t.Fatalf("rules after SetRules = %+v", engine.Rules())
+	}
+	clock.Advance(15 * time.Second)
+	if outcomes := engine.Evaluate(mismatch); len(outcomes) != 1 || len(executor.actions) != 1 {
+		t.Fatalf("expected a restart once the new persistence elapsed, got %+v", outcomes)
+	}
+
+	engine.SetRules([]Rule{PilotErrorRule(5 * time.Minute)})
+	if engine.Active(OCPPMismatchRuleName) || len(engine.Rules()) != 1 {
+		t.Fatalf("removed rule still present: %+v", engine.Rules())
+	}
+}
+
+func TestPilotErrorRule(t *testing.T) {
+	engine, clock, executor := newTestEngine(PilotErrorRule(300 * time.Second))
+
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	clock.Advance(299 * time.Second)
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(executor.actions) != 0 {
+		t.Fatalf("expected no reboot before 300s, got %v", executor.actions)
+	}
+
+	clock.Advance(time.Second)
+	outcomes := engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(outcomes) != 1 || outcomes[0].Action != VendorReboot || outcomes[0].Held != 300*time.Second {
+		t.Fatalf("expected reboot after 300s, got %+v", outcomes)
+	}
+
+	// A pilot leaving the error state never triggers.
+	engine, clock, executor = newTestEngine(PilotErrorRule(300 * time.Second))
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	clock.Advance(200 * time.Second)
+	engine.Evaluate(Readings{"control_pilot_code": 193})
+	clock.Advance(200 * time.Second)
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(executor.actions) != 0 {
+		t.Fatalf("expected timer to reset when pilot left error state, got %v", executor.actions)
+	}
+}
+
+func TestFailedActionDoesNotUseUpRung(t *testing.T) {
+	engine, clock, executor := newTestEngine(OCPPMismatchRule(0, 30*time.Second, 1, true))
+	executor.err = errors.New("systemctl failed")
+
+	var reported []Outcome
+	engine.OnOutcome = func(o Outcome) { reported = append(reported, o) }
+
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(30 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+
+	if len(reported) != 2 || reported[0].Err == nil {
+		t.Fatalf("expected two failed attempts respecting cooldown, got %+v", reported)
+	}
+	for _, o := range reported {
+		if o.Action != RestartService || o.Attempt != 1 {
+			t.Fatalf("failed restart should be retried on the same rung, got %+v", o)
+		}
+	}
+
+	executor.err = nil
+	clock.Advance(30 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(30 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+
+	if len(reported) != 4 || reported[2].Action != RestartService || reported[3].Action != VendorReboot || reported[3].Attempt != 2 {
+		t.Fatalf("expected the ladder to advance after a successful restart, got %+v", reported[2:])
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		expr     string
+		readings Readings
+		want     bool
+	}{
+		{"ocpp_mismatch == 1", Readings{"ocpp_mismatch": 1}, true},
+		{"ocpp_mismatch == 1", Readings{}, false},
+		{"pilot_connected && ocpp_disconnect", Readings{"pilot_connected": 1, "ocpp_disconnect": 1}, true},
+		{"pilot_connected && ocpp_disconnect", Readings{"pilot_connected": 1}, false},
+		{"control_pilot_code == 14 || control_pilot_code == 15", Readings{"control_pilot_code": 15}, true},
+		{"temp_l1 >= 70.5", Readings{"temp_l1": 70.4}, false},
+		{"ocpp_status != 3 && charging_power > 100", Readings{"ocpp_status": 1, "charging_power": 7000}, true},
+	}
+
+	for _, tt := range tests {
+		cond, err := ParseCondition(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCondition(%q): %v", tt.expr, err)
+		}
+		if got := cond.Eval(tt.readings); got != tt.want {
+			t.Fatalf("%q with %v: got %v, want %v", tt.expr, tt.readings, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "ocpp_mismatch = 1", "ocpp_mismatch == yes", "a && "} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Fatalf("expected ParseCondition(%q) to fail", expr)
+		}
+	}
+}
+
+func TestParseLadder(t *testing.T) {
+	ladder, err := ParseLadder("restart_service:3, restart_dependencies, vendor_reboot:1,system_reboot")
+	if err != nil {
+		t.Fatalf("ParseLadder: %v", err)
+	}
+	rule := Rule{Ladder: ladder}
+	if got := rule.maxAttempts(); got != 6 {
+		t.Fatalf("expected 6 attempts, got %d", got)
+	}
+	if got := rule.actionFor(3); got != RestartDependencies {
+		t.Fatalf("expected fourth attempt to restart dependencies, got %s", got)
+	}
+	if got := FormatLadder(ladder); got != "restart_service:3, restart_dependencies:1, vendor_reboot:1, system_reboot:1" {
+		t.Fatalf("unexpected formatted ladder %q", got)
+	}
+
+	for _, spec := range []string{"", "restart_everything", "restart_service:0", "restart_service:x"} {
+		if _, err := ParseLadder(spec); err == nil {
+			t.Fatalf("expected ParseLadder(%q) to fail", spec)
+		}
+	}
+}
+
+func TestValidateRejectsStepWithoutAttempts(t *testing.T) {
+	rule := OCPPMismatchRule(time.Minute, time.Minute, 0, true)
+	if err := rule.Validate(); err == nil {
+		t.Fatal("expected a ladder step with 0 attempts to be rejected")
+	}
+	if err := OCPPMismatchRule(time.Minute, time.Minute, 3, true).Validate(); err != nil {
+		t.Fatalf("valid rule rejected: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package heal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action is a single self-heal measure, ordered from least to most invasive.
+type Action string
+
+const (
+	RestartService      Action = "restart_service"
+	RestartDependencies Action = "restart_dependencies"
+	VendorReboot        Action = "vendor_reboot"
+	SystemReboot        Action = "system_reboot"
+)
+
+var knownActions = map[Action]bool{
+	RestartService:      true,
+	RestartDependencies: true,
+	VendorReboot:        true,
+	SystemReboot:        true,
+}
+
+// Step is one rung of an escalation ladder: the action and how many times it
+// is tried before escalating to the next step.
+type Step struct {
+	Action   Action
+	Attempts int
+}
+
+// Rule describes when and how the bridge heals the Wallbox. Once Condition
+// has held for Persist, the next ladder action is executed, at most once per
+// Cooldown and at most MaxAttempts times until the condition clears.
+type Rule struct {
+	Name        string
+	Condition   Condition
+	Persist     time.Duration
+	Cooldown    time.Duration
+	Ladder      []Step
+	MaxAttempts int
+	// Service is the systemd unit restarted by RestartService.
+	Service string
+}
+
+// ParseLadder parses an escalation ladder such as
+// "restart_service:3, vendor_reboot:1". A step without a count is tried once.
+func ParseLadder(spec string) ([]Step, error) {
+	var ladder []Step
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, count, hasCount := strings.Cut(part, ":")
+		step := Step{Action: Action(strings.TrimSpace(name)), Attempts: 1}
+		if !knownActions[step.Action] {
+			return nil, fmt.Errorf("unknown heal action %q", name)
+		}
+		if hasCount {
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid attempt count %q for %s", count, name)
+			}
+			step.Attempts = n
+		}
+		ladder = append(ladder, step)
+	}
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("empty escalation ladder")
+	}
+	return ladder, nil
+}
+
+// FormatLadder is the inverse of ParseLadder.
+func FormatLadder(ladder []Step) string {
+	parts := make([]string, 0, len(ladder))
+	for _, step := range ladder {
+		parts = append(parts, fmt.Sprintf("%s:%d", step.Action, step.Attempts))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Validate checks that the rule can be executed by the engine.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("heal rule without name")
+	}
+	if len(r.Condition.anyOf) == 0 {
+		return fmt.Errorf("heal rule %s: missing condition", r.Name)
+	}
+	if len(r.Ladder) == 0 {
+		return fmt.Errorf("heal rule %s: empty escalation ladder", r.Name)
+	}
+	if r.Persist < 0 || r.Cooldown < 0 || r.MaxAttempts < 0 {
+		return fmt.Errorf("heal rule %s: durations and max attempts must not be negative", r.Name)
+	}
+	// A step without attempts would silently move on to the next, usually
+	// more drastic, action.
+	for _, step := range r.Ladder {
+		if step.Attempts <= 0 {
+			return fmt.Errorf("heal rule %s: ladder step %s needs at least one attempt", r.Name, step.Action)
+		}
+	}
+	return nil
+}
+
+// maxAttempts returns the configured cap, defaulting to the ladder length.
+func (r Rule) maxAttempts() int {
+	total := 0
+	for _, step := range r.Ladder {
+		total += step.Attempts
+	}
+	if r.MaxAttempts > 0 && r.MaxAttempts < total {
+		return r.MaxAttempts
+	}
+	return total
+}
+
+// actionFor returns the ladder action for the given zero-based attempt.
+func (r Rule) actionFor(attempt int) Action {
+	for _, step := range r.Ladder {
+		if attempt < step.Attempts {
+			return step.Action
+		}
+		attempt -= step.Attempts
+	}
+	return r.Ladder[len(r.Ladder)-1].Action
+}
@@ -0,0 +1,95 @@
+package heal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxHistory bounds the number of executed actions kept in State.History.
+const maxHistory = 50
+
+// State is the persistent part of the engine: per-rule ladder progress, the
+// recent action history and the reboots used for the daily reboot guard.
+type State struct {
+	Rules   map[string]RuleState `json:"rules"`
+	History []HistoryEntry       `json:"history"`
+	Reboots []time.Time          `json:"reboots"`
+}
+
+// RuleState is the ladder progress of a single rule.
+type RuleState struct {
+	Attempts   int       `json:"attempts"`
+	LastAction time.Time `json:"last_action"`
+	Exhausted  bool      `json:"exhausted"`
+}
+
+// HistoryEntry records one executed (or suppressed) heal action.
+type HistoryEntry struct {
+	Rule    string    `json:"rule"`
+	Service string    `json:"service,omitempty"`
+	Action  Action    `json:"action"`
+	Label   string    `json:"label"`
+	Detail  string    `json:"detail"`
+	Error   string    `json:"error,omitempty"`
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+}
+
+// Store persists engine state between bridge restarts.
+type Store interface {
+	Load() (State, error)
+	Save(State) error
+}
+
+// FileStore keeps the state as JSON in a single file.
+type FileStore struct {
+	Path string
+}
+
+// Load reads the state file. A missing file yields an empty state.
+func (f FileStore) Load() (State, error) {
+	var state State
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("decode %s: %w", f.Path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state atomically, so a reboot mid-write cannot leave a
+// truncated file behind.
+func (f FileStore) Save(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,160 @@
+package heal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	saved []State
+}
+
+func (m *memoryStore) Load() (State, error) {
+	if len(m.saved) == 0 {
+		return State{}, nil
+	}
+	return m.saved[len(m.saved)-1], nil
+}
+
+func (m *memoryStore) Save(s State) error {
+	m.saved = append(m.saved, s)
+	return nil
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store := FileStore{Path: filepath.Join(t.TempDir(), "heal_state.json")}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load on missing file: %v", err)
+	}
+	if len(state.Rules) != 0 || len(state.History) != 0 {
+		t.Fatalf("expected empty state, got %+v", state)
+	}
+
+	at := time.Date(2025, 11, 23, 12, 0, 0, 0, time.UTC)
+	state = State{
+		Rules:   map[string]RuleState{OCPPMismatchRuleName: {Attempts: 2, LastAction: at}},
+		History: []HistoryEntry{{Rule: OCPPMismatchRuleName, Action: RestartService, Label: "stop_start", At: at}},
+		Reboots: []time.Time{at},
+	}
+	if err := store.Save(state); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Rules[OCPPMismatchRuleName].Attempts != 2 || !loaded.Reboots[0].Equal(at) || loaded.History[0].Label != "stop_start" {
+		t.Fatalf("unexpected loaded state %+v", loaded)
+	}
+}
+
+func TestEngineRestoreKeepsLadderProgress(t *testing.T) {
+	store := &memoryStore{}
+	engine, clock, executor := newTestEngine(OCPPMismatchRule(60*time.Second, 300*time.Second, 1, true))
+	engine.Store = store
+
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(60 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	clock.Advance(300 * time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 1})
+	if len(executor.actions) != 2 || executor.actions[1] != VendorReboot {
+		t.Fatalf("expected restart then reboot, got %v", executor.actions)
+	}
+
+	// The bridge comes back after the reboot with the mismatch still present.
+	saved, _ := store.Load()
+	restarted, clock2, executor2 := newTestEngine(OCPPMismatchRule(60*time.Second, 300*time.Second, 1, true))
+	clock2.now = clock.now.Add(2 * time.Minute)
+	restarted.Restore(saved)
+
+	// Telemetry has not arrived yet, so the mismatch reads 0 at first.
+	restarted.Evaluate(Readings{"ocpp_mismatch": 0})
+	clock2.Advance(30 * time.Second)
+	restarted.Evaluate(Readings{"ocpp_mismatch": 0})
+	if got := restarted.State().Rules[OCPPMismatchRuleName]; got.Attempts != 2 {
+		t.Fatalf("expected restored progress to survive missing readings, got %+v", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		restarted.Evaluate(Readings{"ocpp_mismatch": 1})
+		clock2.Advance(5 * time.Minute)
+	}
+	if len(executor2.actions) != 0 {
+		t.Fatalf("expected exhausted ladder to survive the restart, got %v", executor2.actions)
+	}
+	if got := restarted.History(); len(got) != 2 || got[1].Action != VendorReboot {
+		t.Fatalf("expected restored history with the reboot, got %+v", got)
+	}
+}
+
+func TestEngineRestoredProgressResetsAfterStayingClear(t *testing.T) {
+	engine, clock, _ := newTestEngine(OCPPMismatchRule(60*time.Second, 300*time.Second, 1, true))
+	engine.Restore(State{Rules: map[string]RuleState{OCPPMismatchRuleName: {Attempts: 2, Exhausted: true}}})
+
+	engine.Evaluate(Readings{"ocpp_mismatch": 0})
+	clock.Advance(clearResetAfter - time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 0})
+	if got := engine.State().Rules[OCPPMismatchRuleName]; got.Attempts != 2 {
+		t.Fatalf("progress reset too early: %+v", got)
+	}
+	clock.Advance(time.Second)
+	engine.Evaluate(Readings{"ocpp_mismatch": 0})
+	if got := engine.State().Rules[OCPPMismatchRuleName]; got.Attempts != 0 || got.Exhausted {
+		t.Fatalf("progress kept although the condition stayed clear: %+v", got)
+	}
+}
+
+func TestEngineSavesBeforeReboot(t *testing.T) {
+	store := &memoryStore{}
+	engine, clock, _ := newTestEngine(PilotErrorRule(time.Minute))
+	engine.Store = store
+
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	clock.Advance(time.Minute)
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+
+	if len(store.saved) < 2 {
+		t.Fatalf("expected state saved before and after the reboot, got %d saves", len(store.saved))
+	}
+	before := store.saved[len(store.saved)-2]
+	if len(before.Reboots) != 1 || before.Rules[PilotErrorRuleName].Attempts != 1 {
+		t.Fatalf("expected reboot recorded before executing it, got %+v", before)
+	}
+}
+
+func TestEngineDailyRebootGuard(t *testing.T) {
+	engine, clock, executor := newTestEngine(PilotErrorRule(time.Minute))
+	engine.MaxRebootsPerDay = 2
+	engine.Restore(State{Reboots: []time.Time{clock.now.Add(-23 * time.Hour), clock.now.Add(-2 * time.Hour)}})
+
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	clock.Advance(time.Minute)
+	outcomes := engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(outcomes) != 1 || outcomes[0].Label != "reboot_suppressed" || len(executor.actions) != 0 {
+		t.Fatalf("expected reboot to be suppressed, got %+v (executed %v)", outcomes, executor.actions)
+	}
+
+	// An hour later the oldest reboot has left the 24h window.
+	clock.Advance(time.Hour)
+	outcomes = engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(outcomes) != 1 || outcomes[0].Label != string(VendorReboot) || len(executor.actions) != 1 {
+		t.Fatalf("expected reboot once the window moved on, got %+v (executed %v)", outcomes, executor.actions)
+	}
+}
+
+func TestEngineZeroRebootsPerDayAllowsNone(t *testing.T) {
+	engine, clock, executor := newTestEngine(PilotErrorRule(time.Minute))
+	engine.MaxRebootsPerDay = 0
+
+	engine.Evaluate(Readings{"control_pilot_code": 14})
+	clock.Advance(time.Minute)
+	outcomes := engine.Evaluate(Readings{"control_pilot_code": 14})
+	if len(outcomes) != 1 || outcomes[0].Label != "reboot_suppressed" || len(executor.actions) != 0 {
+		t.Fatalf("expected no reboot with a limit of 0, got %+v (executed %v)", outcomes, executor.actions)
+	}
+}
@@ -0,0 +1,111 @@
+package bridge
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"wallbox-mqtt-bridge/app/heal"
+	"wallbox-mqtt-bridge/app/system"
+)
+
+const testService = "ocppwallbox.service"
+
+func testHealRule() heal.Rule {
+	return heal.Rule{Name: "test", Service: testService}
+}
+
+func TestRestartCriticalServicesStopStart(t *testing.T) {
+	fake := system.NewFake()
+
+	label, _, err := restartCriticalServices(fake, testService)
+	if err != nil || label != "stop_start" {
+		t.Fatalf("expected stop_start without error, got %q, %v", label, err)
+	}
+
+	want := []string{
+		"is-active redis.service",
+		"is-active mysqld.service",
+		"stop " + testService,
+		"start " + testService,
+	}
+	if got := fake.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestRestartCriticalServicesFallsBackToRestart(t *testing.T) {
+	for _, failing := range []string{"stop " + testService, "start " + testService} {
+		fake := system.NewFake()
+		fake.Errors[failing] = errors.New("failed")
+
+		label, _, err := restartCriticalServices(fake, testService)
+		if err != nil || label != "restart" {
+			t.Fatalf("%s failing: expected restart, got %q, %v", failing, label, err)
+		}
+		calls := fake.Calls()
+		if calls[len(calls)-1] != "restart "+testService {
+			t.Fatalf("%s failing: expected a restart last, got %v", failing, calls)
+		}
+	}
+}
+
+func TestRestartCriticalServicesEscalatesToReboot(t *testing.T) {
+	fake := system.NewFake()
+	fake.Errors["stop "+testService] = errors.New("failed")
+	fake.Errors["restart "+testService] = errors.New("failed")
+	fake.Errors["vendor_reboot"] = errors.New("no such file")
+
+	label, _, err := restartCriticalServices(fake, testService)
+	if err != nil || label != "reboot" {
+		t.Fatalf("expected reboot without error, got %q, %v", label, err)
+	}
+	calls := fake.Calls()
+	tail := calls[len(calls)-2:]
+	if !reflect.DeepEqual(tail, []string{"vendor_reboot", "reboot"}) {
+		t.Fatalf("expected vendor reboot then systemd reboot, got %v", calls)
+	}
+
+	fake.Errors["reboot"] = errors.New("denied")
+	if _, _, err := restartCriticalServices(fake, testService); err == nil {
+		t.Fatalf("expected an error once every reboot path fails")
+	}
+}
+
+func TestRebootSystemPrefersVendorScript(t *testing.T) {
+	fake := system.NewFake()
+	if err := rebootSystem(fake); err != nil {
+		t.Fatalf("rebootSystem: %v", err)
+	}
+	if got := fake.Calls(); !reflect.DeepEqual(got, []string{"vendor_reboot"}) {
+		t.Fatalf("calls = %v, want only the vendor reboot", got)
+	}
+}
+
+func TestRestartDependenciesStopsAtFirstFailure(t *testing.T) {
+	fake := system.NewFake()
+	fake.Errors["restart mysqld.service"] = errors.New("failed")
+
+	if _, _, err := restartDependencies(fake, testService); err == nil {
+		t.Fatalf("expected the mysqld failure to be reported")
+	}
+	want := []string{"restart redis.service", "restart mysqld.service"}
+	if got := fake.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestHealExecutorDryRunMakesNoCalls(t *testing.T) {
+	fake := system.NewFake()
+	exec := healExecutor{sys: fake, dryRun: true}
+
+	for _, action := range []heal.Action{heal.RestartService, heal.RestartDependencies, heal.VendorReboot, heal.SystemReboot} {
+		label, _, err := exec.Execute(testHealRule(), action)
+		if err != nil || label != "dry_run_"+string(action) {
+			t.Fatalf("%s: got %q, %v", action, label, err)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("dry run touched the system: %v", calls)
+	}
+}
@@ -0,0 +1,155 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"wallbox-mqtt-bridge/app/heal"
+	"wallbox-mqtt-bridge/app/servicehealth"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// buildHealRules returns the self-heal rules for the configuration: the
+// built-in OCPP mismatch, pilot error and critical service rules (when
+// enabled in [settings]), with any [heal_rule.<name>] sections applied on top.
+func buildHealRules(c *WallboxConfig) ([]heal.Rule, error) {
+	builtins := map[string]heal.Rule{
+		heal.OCPPMismatchRuleName: heal.OCPPMismatchRule(
+			time.Duration(c.Settings.OCPPMismatchSeconds)*time.Second,
+			time.Duration(c.Settings.OCPPRestartCooldown)*time.Second,
+			c.Settings.OCPPMaxRestarts,
+			c.Settings.OCPPFullReboot,
+		),
+		heal.PilotErrorRuleName: heal.PilotErrorRule(time.Duration(c.Settings.PilotErrorSeconds) * time.Second),
+	}
+	enabled := map[string]bool{
+		heal.OCPPMismatchRuleName: c.Settings.AutoRestartOCPP,
+		heal.PilotErrorRuleName:   c.Settings.PilotErrorReboot,
+	}
+	order := []string{heal.OCPPMismatchRuleName, heal.PilotErrorRuleName}
+
+	for _, svc := range wallbox.WallboxServices {
+		if !svc.Critical || svc.Unit == "" {
+			continue
+		}
+		name := heal.ServiceRuleName(svc.Name)
+		builtins[name] = heal.ServiceHealthRule(svc.Name, svc.Unit, time.Duration(c.Settings.ServiceUnhealthySeconds)*time.Second)
+		enabled[name] = c.Settings.ServiceHealth && c.Settings.ServiceHealthHeal
+		order = append(order, name)
+	}
+
+	rules := make(map[string]heal.Rule)
+	for name, rule := range builtins {
+		rules[name] = rule
+	}
+
+	for _, rc := range c.HealRules {
+		rule, ok := rules[rc.Name]
+		if !ok {
+			rule = heal.Rule{Name: rc.Name, Service: "ocppwallbox.service"}
+			order = append(order, rc.Name)
+		}
+		enabled[rc.Name] = rc.Enabled
+
+		if rc.Condition != "" {
+			cond, err := heal.ParseCondition(rc.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("heal rule %s: %w", rc.Name, err)
+			}
+			rule.Condition = cond
+		}
+		if rc.PersistSeconds > 0 {
+			rule.Persist = time.Duration(rc.PersistSeconds) * time.Second
+		}
+		if rc.CooldownSeconds > 0 {
+			rule.Cooldown = time.Duration(rc.CooldownSeconds) * time.Second
+		}
+		if rc.Ladder != "" {
+			ladder, err := heal.ParseLadder(rc.Ladder)
+			if err != nil {
+				return nil, fmt.Errorf("heal rule %s: %w", rc.Name, err)
+			}
+			rule.Ladder = ladder
+		}
+		if rc.MaxAttempts > 0 {
+			rule.MaxAttempts = rc.MaxAttempts
+		}
+		if rc.Service != "" {
+			rule.Service = rc.Service
+		}
+		rules[rc.Name] = rule
+	}
+
+	var result []heal.Rule
+	for _, name := range order {
+		if !enabled[name] {
+			continue
+		}
+		rule := rules[name]
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// healReadings collects the Wallbox values heal rule conditions can refer to.
+// services may be nil when service health is disabled.
+func healReadings(w *wallbox.Wallbox, ocppMismatch bool, services *servicehealth.Monitor) heal.Readings {
+	readings := heal.Readings{
+		"ocpp_mismatch":      boolReading(ocppMismatch),
+		"pilot_connected":    boolReading(w.HasTelemetry() && (w.CableConnected() == 1 || w.IsChargingPilot())),
+		"ocpp_disconnect":    boolReading(w.OCPPIndicatesDisconnect()),
+		"ocpp_status":        float64(w.OCPPStatusCode()),
+		"ocpp_online":        float64(w.OCPPOnlineCode()),
+		"control_pilot_code": float64(w.ControlPilotCode()),
+		"cable_connected":    float64(w.CableConnected()),
+		"charging_power":     w.ChargingPower(),
+		"temp_l1":            w.TemperatureL1(),
+		"temp_l2":            w.TemperatureL2(),
+		"temp_l3":            w.TemperatureL3(),
+	}
+	if services != nil {
+		for _, svc := range wallbox.WallboxServices {
+			status, ok := services.Status(svc.Name)
+			if !ok {
+				continue
+			}
+			prefix := "service_" + svc.Name
+			readings[prefix+"_unhealthy"] = boolReading(!status.Healthy)
+			readings[prefix+"_leak"] = boolReading(status.LeakSuspected)
+			readings[prefix+"_memory"] = status.Memory
+			readings[prefix+"_cpu"] = status.CPUUsage
+		}
+	}
+	return readings
+}
+
+func boolReading(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// newHealEngine creates the heal engine for c. Unless c is a dry run, it
+// restores and persists its state in the heal state file.
+func newHealEngine(c *WallboxConfig, w *wallbox.Wallbox, rules []heal.Rule) *heal.Engine {
+	engine := heal.NewEngine(rules, healExecutor{sys: w.System(), dryRun: c.Settings.HealDryRun}, heal.SystemClock())
+	if c.Settings.HealDryRun {
+		// Simulated actions must not count against the real ladder or the
+		// reboot guard once dry run is switched off, so keep them in memory.
+		healLog.Infof("dry run enabled, actions are only logged and published")
+	} else {
+		healStore := heal.FileStore{Path: c.Settings.HealStateFile}
+		if state, err := healStore.Load(); err != nil {
+			healLog.Warnf("ignoring unreadable state: %v", err)
+		} else {
+			engine.Restore(state)
+		}
+		engine.Store = healStore
+	}
+	engine.MaxRebootsPerDay = c.Settings.MaxRebootsPerDay
+	return engine
+}
@@ -0,0 +1,24 @@
+package bridge
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// startHTTPServer serves mux on listen in the background. Errors after
+// startup are logged; the bridge keeps running without the listener.
+func startHTTPServer(listen string, mux *http.ServeMux) *http.Server {
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		httpLog.Infof("Listening on %s", listen)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			httpLog.Errorf("Server on %s failed: %v", listen, err)
+		}
+	}()
+	return server
+}
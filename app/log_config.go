@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"fmt"
+	"sync"
+
+	"wallbox-mqtt-bridge/app/logging"
+)
+
+// The loggers of the bridge's subsystems, whose levels [log] subsystems
+// sets. The heal and wallbox packages have their own.
+var (
+	bridgeLog  = logging.New("bridge")
+	mqttLog    = logging.New("mqtt")
+	configLog  = logging.New("config")
+	httpLog    = logging.New("http")
+	apiLog     = logging.New("api")
+	healLog    = logging.New("heal")
+	ocppLog    = logging.New("ocpp")
+	serviceLog = logging.New("services")
+)
+
+// logForwardBuffer is how many entries may wait to be published to MQTT;
+// more are dropped.
+const logForwardBuffer = 64
+
+// maxLogStateLength is the longest state Home Assistant accepts.
+const maxLogStateLength = 255
+
+// logConfig returns the logging configuration of c and the level from
+// which entries are forwarded to MQTT, or the problems of the [log] section.
+func logConfig(c *WallboxConfig) (logging.Config, logging.Level, []string) {
+	var problems []string
+	level, err := logging.ParseLevel(c.Log.Level)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("[log] level: %v", err))
+	}
+	subsystems, err := logging.ParseSubsystemLevels(c.Log.Subsystems)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("[log] subsystems: %v", err))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		problems = append(problems, fmt.Sprintf("[log] format: %q is neither text nor json", c.Log.Format))
+	}
+	mqttLevel, err := logging.ParseLevel(c.Log.MQTTLevel)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("[log] mqtt_level: %v", err))
+	}
+	return logging.Config{Level: level, Subsystems: subsystems, JSON: c.Log.Format == "json"}, mqttLevel, problems
+}
+
+// configureLogging applies the logging configuration of c, with the level
+// overridden unless override is empty, and returns the MQTT level. c must
+// have been validated.
+func configureLogging(c *WallboxConfig, override string) logging.Level {
+	config, mqttLevel, _ := logConfig(c)
+	if level, err := logging.ParseLevel(override); override != "" && err == nil {
+		config.Level = level
+	}
+	logging.Configure(config)
+	return mqttLevel
+}
+
+// logForwarder passes log entries to the publish loop and keeps the last
+// one for the last_log entity.
+type logForwarder struct {
+	entries chan logging.Entry
+	mu      sync.Mutex
+	last    logging.Entry
+}
+
+func newLogForwarder() *logForwarder {
+	return &logForwarder{entries: make(chan logging.Entry, logForwardBuffer)}
+}
+
+// forward is the logging forwarder. It never blocks; entries the publish
+// loop has no room for are only shown by last_log.
+func (f *logForwarder) forward(entry logging.Entry) {
+	f.mu.Lock()
+	f.last = entry
+	f.mu.Unlock()
+	select {
+	case f.entries <- entry:
+	default:
+	}
+}
+
+func (f *logForwarder) lastEntry() logging.Entry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+// getLogEntities returns the sensor showing the last forwarded log entry.
+func getLogEntities(logs *logForwarder) map[string]Entity {
+	return map[string]Entity{
+		"last_log": {
+			Component: "sensor",
+			Getter: func() string {
+				entry := logs.lastEntry()
+				if entry.Message == "" {
+					return noValue
+				}
+				message := []rune(entry.Message)
+				if len(message) > maxLogStateLength {
+					message = message[:maxLogStateLength]
+				}
+				return string(message)
+			},
+			Attributes: func() map[string]interface{} {
+				entry := logs.lastEntry()
+				if entry.Message == "" {
+					return map[string]interface{}{}
+				}
+				return map[string]interface{}{
+					"level":     entry.Level.String(),
+					"subsystem": entry.Subsystem,
+					"time":      entry.Time,
+					"message":   entry.Message,
+				}
+			},
+			Config: map[string]string{
+				"name":            "Last log message",
+				"icon":            "mdi:text-box-outline",
+				"entity_category": "diagnostic",
+			},
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package bridge
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"wallbox-mqtt-bridge/app/logging"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func TestLoadConfigLog(t *testing.T) {
+	c, _, err := LoadConfig(writeConfig(t, "[mqtt]\nhost = broker.lan\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, mqttLevel, problems := logConfig(c)
+	if len(problems) > 0 || config.Level != logging.LevelInfo || config.JSON || mqttLevel != logging.LevelOff {
+		t.Fatalf("defaults: %+v, %v, %v", config, mqttLevel, problems)
+	}
+
+	_, _, err = LoadConfig(writeConfig(t, `[mqtt]
+host = broker.lan
+
+[log]
+level = loud
+format = xml
+subsystems = heal
+mqtt_level = warn
+`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"[log] level", "[log] format", "[log] subsystems"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q missing from %v", want, err)
+		}
+	}
+}
+
+func TestLogEntities(t *testing.T) {
+	c := defaultConfig()
+	logs := newLogForwarder()
+	base := map[string]Entity{}
+	if _, ok := withConfigEntities(base, c, &wallbox.Wallbox{}, nil, logs)["last_log"]; ok {
+		t.Fatal("last_log exposed although forwarding is off")
+	}
+
+	c.Log.MQTTLevel = "warn"
+	entity, ok := withConfigEntities(base, c, &wallbox.Wallbox{}, nil, logs)["last_log"]
+	if !ok || entity.Getter() != noValue {
+		t.Fatal("last_log missing or not empty")
+	}
+	logs.forward(logging.Entry{Time: time.Now(), Level: logging.LevelWarn, Subsystem: "ocpp", Message: strings.Repeat("x", 300)})
+	if state := entity.Getter(); len(state) != maxLogStateLength {
+		t.Fatalf("state has %d characters", len(state))
+	}
+	if attributes := entity.Attributes(); attributes["level"] != "warn" || attributes["subsystem"] != "ocpp" {
+		t.Fatalf("attributes = %v", attributes)
+	}
+	if entry := <-logs.entries; entry.Subsystem != "ocpp" {
+		t.Fatalf("published entry = %+v", entry)
+	}
+}
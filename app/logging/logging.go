@@ -0,0 +1,195 @@
+// Package logging is the bridge's leveled logger. Every subsystem logs
+// through its own Logger, whose level can be set apart from the others.
+// Lines are written as text or JSON, and entries at or above a level can be
+// forwarded, e.g. to MQTT.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelOff disables logging or forwarding.
+	LevelOff
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelOff:   "off",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses "debug", "info", "warn", "error" or "off".
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	for level, name := range levelNames {
+		if name == s {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, use debug, info, warn, error or off", s)
+}
+
+// ParseSubsystemLevels parses a comma separated list of subsystem=level
+// pairs, e.g. "heal=debug, wallbox=warn".
+func ParseSubsystemLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		subsystem, name, ok := strings.Cut(pair, "=")
+		subsystem = strings.TrimSpace(subsystem)
+		if !ok || subsystem == "" {
+			return nil, fmt.Errorf("%q is not subsystem=level", strings.TrimSpace(pair))
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", subsystem, err)
+		}
+		levels[subsystem] = level
+	}
+	return levels, nil
+}
+
+// Entry is a single log line.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Level     Level     `json:"-"`
+	Subsystem string    `json:"subsystem"`
+	Message   string    `json:"message"`
+}
+
+// MarshalJSON writes the level by name.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	return json.Marshal(struct {
+		Level string `json:"level"`
+		entry
+	}{e.Level.String(), entry(e)})
+}
+
+// Config is how entries are filtered and written.
+type Config struct {
+	// Level applies to subsystems without a level of their own.
+	Level      Level
+	Subsystems map[string]Level
+	// JSON writes one JSON object per line instead of text.
+	JSON   bool
+	Output io.Writer
+}
+
+var (
+	mu     sync.RWMutex
+	config = Config{Level: LevelInfo, Output: os.Stderr}
+	// forward receives the entries at or above forwardLevel.
+	forward      func(Entry)
+	forwardLevel = LevelOff
+	// writeMu keeps lines from interleaving.
+	writeMu sync.Mutex
+)
+
+// Configure replaces the configuration. A nil Output keeps the current one.
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c.Output == nil {
+		c.Output = config.Output
+	}
+	config = c
+}
+
+// SetForwarder passes every entry at or above level to fn, whether or not it
+// is written. fn is called on the logging goroutine and must not block or
+// log itself. A nil fn or LevelOff stops forwarding.
+func SetForwarder(level Level, fn func(Entry)) {
+	mu.Lock()
+	defer mu.Unlock()
+	forward = fn
+	forwardLevel = level
+}
+
+// Logger logs for one subsystem.
+type Logger struct {
+	subsystem string
+}
+
+// New returns the logger of subsystem.
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// Enabled reports whether entries at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level >= l.level()
+}
+
+// level returns the subsystem's level; mu must be held.
+func (l *Logger) level() Level {
+	if level, ok := config.Subsystems[l.subsystem]; ok {
+		return level
+	}
+	return config.Level
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.log(LevelDebug, format, args) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.log(LevelInfo, format, args) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.log(LevelWarn, format, args) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.log(LevelError, format, args) }
+
+func (l *Logger) log(level Level, format string, args []interface{}) {
+	mu.RLock()
+	write := level >= l.level()
+	out, asJSON := config.Output, config.JSON
+	fn := forward
+	if level < forwardLevel {
+		fn = nil
+	}
+	mu.RUnlock()
+	if !write && fn == nil {
+		return
+	}
+
+	entry := Entry{Time: time.Now(), Level: level, Subsystem: l.subsystem, Message: fmt.Sprintf(format, args...)}
+	if write {
+		var line []byte
+		if asJSON {
+			line, _ = json.Marshal(entry)
+		} else {
+			line = []byte(fmt.Sprintf("%s %-5s %s: %s", entry.Time.Format("2006/01/02 15:04:05"), strings.ToUpper(level.String()), l.subsystem, entry.Message))
+		}
+		writeMu.Lock()
+		out.Write(append(line, '\n'))
+		writeMu.Unlock()
+	}
+	if fn != nil {
+		fn(entry)
+	}
+}
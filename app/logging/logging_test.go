@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseSubsystemLevels(t *testing.T) {
+	levels, err := ParseSubsystemLevels(" heal=debug, wallbox = WARN ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || levels["heal"] != LevelDebug || levels["wallbox"] != LevelWarn {
+		t.Fatalf("levels = %v", levels)
+	}
+	for _, s := range []string{"heal", "=debug", "heal=loud"} {
+		if _, err := ParseSubsystemLevels(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	var out bytes.Buffer
+	Configure(Config{Level: LevelWarn, Subsystems: map[string]Level{"heal": LevelDebug}, Output: &out})
+	defer Configure(Config{Level: LevelInfo, Output: os.Stderr})
+
+	var forwarded []Entry
+	SetForwarder(LevelError, func(e Entry) { forwarded = append(forwarded, e) })
+	defer SetForwarder(LevelOff, nil)
+
+	New("heal").Debugf("condition met")
+	New("wallbox").Infof("ignored")
+	New("wallbox").Errorf("query failed: %v", "timeout")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "DEBUG heal: condition met") ||
+		!strings.HasSuffix(lines[1], "ERROR wallbox: query failed: timeout") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	if len(forwarded) != 1 || forwarded[0].Subsystem != "wallbox" || forwarded[0].Level != LevelError {
+		t.Fatalf("forwarded = %+v", forwarded)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	Configure(Config{Level: LevelInfo, JSON: true, Output: &out})
+	defer Configure(Config{Level: LevelInfo, Output: os.Stderr})
+
+	New("mqtt").Warnf("connection lost")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "warn" || entry["subsystem"] != "mqtt" || entry["message"] != "connection lost" || entry["time"] == nil {
+		t.Fatalf("entry = %v", entry)
+	}
+}
@@ -0,0 +1,205 @@
+// Package metrics keeps counters and gauges and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// Sample is one value of a family, identified by its label values.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Vec is a counter or gauge with a fixed set of label names. It is safe for
+// concurrent use.
+type Vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mux    sync.Mutex
+	values map[string]*vecValue
+}
+
+type vecValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounter returns a counter with the given label names.
+func NewCounter(name, help string, labelNames ...string) *Vec {
+	return &Vec{name: name, help: help, typ: Counter, labelNames: labelNames, values: make(map[string]*vecValue)}
+}
+
+// NewGauge returns a gauge with the given label names.
+func NewGauge(name, help string, labelNames ...string) *Vec {
+	return &Vec{name: name, help: help, typ: Gauge, labelNames: labelNames, values: make(map[string]*vecValue)}
+}
+
+func (v *Vec) value(labelValues []string) *vecValue {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s: got %d label values for %d labels", v.name, len(labelValues), len(v.labelNames)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	value, ok := v.values[key]
+	if !ok {
+		value = &vecValue{labels: append([]string(nil), labelValues...)}
+		v.values[key] = value
+	}
+	return value
+}
+
+// Add adds delta to the sample with the given label values.
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.value(labelValues).value += delta
+}
+
+// Inc adds one to the sample with the given label values.
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Set sets the sample with the given label values.
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.value(labelValues).value = value
+}
+
+// Family returns the current samples.
+func (v *Vec) Family() Family {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	family := Family{Name: v.name, Help: v.help, Type: v.typ}
+	for _, value := range v.values {
+		labels := make(map[string]string, len(v.labelNames))
+		for i, name := range v.labelNames {
+			labels[name] = value.labels[i]
+		}
+		family.Samples = append(family.Samples, Sample{Labels: labels, Value: value.value})
+	}
+	return family
+}
+
+// SanitizeName turns s into a valid metric name, replacing invalid
+// characters with underscores.
+func SanitizeName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// WriteText writes families in the Prometheus text format, sorted by name.
+// Families with the same name are merged.
+func WriteText(w io.Writer, families []Family) error {
+	merged := make(map[string]*Family)
+	var names []string
+	for _, f := range families {
+		if existing, ok := merged[f.Name]; ok {
+			existing.Samples = append(existing.Samples, f.Samples...)
+			continue
+		}
+		f := f
+		merged[f.Name] = &f
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := merged[name]
+		if len(f.Samples) == 0 {
+			continue
+		}
+		if f.Help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		if f.Type != "" {
+			fmt.Fprintf(&b, "# TYPE %s %s\n", f.Name, f.Type)
+		}
+
+		lines := make([]string, 0, len(f.Samples))
+		for _, s := range f.Samples {
+			lines = append(lines, f.Name+formatLabels(s.Labels)+" "+formatValue(s.Value))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabelValue(labels[name]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
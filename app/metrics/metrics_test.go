@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	publishes := NewCounter("bridge_publishes_total", "MQTT state publishes.", "serial")
+	publishes.Inc("123")
+	publishes.Add(2, "123")
+
+	power := NewGauge("charging_power", "Charging power in W.\nLine two", "serial", "line")
+	power.Set(2300, "123", "l2")
+	power.Set(1150.5, "123", "l1")
+
+	quoted := Family{Name: "info", Type: Gauge, Samples: []Sample{{Labels: map[string]string{"name": `a "b" \ c`}, Value: 1}}}
+	empty := NewGauge("empty", "Never set.")
+
+	var b strings.Builder
+	if err := WriteText(&b, []Family{publishes.Family(), power.Family(), quoted, empty.Family()}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP bridge_publishes_total MQTT state publishes.
+# TYPE bridge_publishes_total counter
+bridge_publishes_total{serial="123"} 3
+# HELP charging_power Charging power in W.\nLine two
+# TYPE charging_power gauge
+charging_power{line="l1",serial="123"} 1150.5
+charging_power{line="l2",serial="123"} 2300
+# TYPE info gauge
+info{name="a \"b\" \\ c"} 1
+`
+	if got := b.String(); got != want {
+		t.Fatalf("WriteText =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"charging_power":  "charging_power",
+		"temp-l1":         "temp_l1",
+		"1st":             "_st",
+		"wallbox_ünicode": "wallbox__nicode",
+	} {
+		if got := SanitizeName(in); got != want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	NewCounter("c", "", "a", "b").Inc("only one")
+}
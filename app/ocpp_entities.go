@@ -0,0 +1,319 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"wallbox-mqtt-bridge/app/heal"
+	"wallbox-mqtt-bridge/app/ocpphealth"
+	"wallbox-mqtt-bridge/app/ratelimit"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// ocppRuntime is the state behind the OCPP and heal entities, which the
+// publish loop keeps up to date.
+type ocppRuntime struct {
+	health *ocpphealth.Tracker
+	heal   *heal.Engine
+
+	mismatch       string
+	lastRestart    string
+	lastHealAction string
+	lastHealAt     string
+	lastHealDetail string
+}
+
+func newOCPPRuntime() *ocppRuntime {
+	return &ocppRuntime{
+		health:         ocpphealth.New(24*time.Hour, 20),
+		mismatch:       "0",
+		lastRestart:    "never",
+		lastHealAction: "idle",
+		lastHealAt:     "never",
+	}
+}
+
+// recordHeal shows a heal action on the ocpp_last_* entities.
+func (r *ocppRuntime) recordHeal(entry heal.HistoryEntry) {
+	r.lastHealAction = entry.Label
+	r.lastHealDetail = entry.Detail
+	r.lastHealAt = entry.At.Format(time.RFC3339)
+	if entry.Error == "" && entry.Service == "ocppwallbox.service" &&
+		(entry.Action == heal.RestartService || entry.Action == heal.RestartDependencies) {
+		r.lastRestart = entry.At.Format(time.RFC3339)
+	}
+}
+
+// updateMismatch flags a cable that is connected while OCPP reports a
+// disconnect.
+func (r *ocppRuntime) updateMismatch(w *wallbox.Wallbox) {
+	pilotConnected := w.HasTelemetry() && (w.CableConnected() == 1 || w.IsChargingPilot())
+	ocppIndicatesDisconnect := w.OCPPIndicatesDisconnect()
+
+	if pilotConnected && ocppIndicatesDisconnect {
+		if r.mismatch != "1" {
+			ocppLog.Warnf("OCPP mismatch detected: pilot=%d (%s), OCPP=%d (%s)", w.ControlPilotCode(), w.ControlPilotStatus(), w.OCPPStatusCode(), w.OCPPStatusDescription())
+		}
+		r.mismatch = "1"
+	} else {
+		if r.mismatch != "0" {
+			ocppLog.Infof("OCPP mismatch cleared")
+		}
+		r.mismatch = "0"
+	}
+}
+
+func getOCPPEntities(w *wallbox.Wallbox, r *ocppRuntime) map[string]Entity {
+	entities := make(map[string]Entity)
+
+	entities["ocpp_mismatch"] = Entity{
+		Component: "binary_sensor",
+		Getter:    func() string { return r.mismatch },
+		Config: map[string]string{
+			"name":            "OCPP mismatch",
+			"payload_on":      "1",
+			"payload_off":     "0",
+			"device_class":    "problem",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_status"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			code := w.OCPPStatusCode()
+			return fmt.Sprintf("%d: %s", code, w.OCPPStatusDescription())
+		},
+		Attributes: func() map[string]interface{} {
+			detail := w.OCPPStatusDetail()
+			attributes := map[string]interface{}{"source": detail.Source, "code": detail.Code}
+			if !detail.Updated.IsZero() {
+				// The age is left to Home Assistant: it would change the
+				// retained attributes on every evaluation.
+				attributes["updated"] = detail.Updated.Format(time.RFC3339)
+			}
+			return attributes
+		},
+		Config: map[string]string{
+			"name": "OCPP status",
+		},
+	}
+
+	entities["ocpp_last_restart"] = Entity{
+		Component: "sensor",
+		Getter:    func() string { return r.lastRestart },
+		Config: map[string]string{
+			"name":            "OCPP last restart",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_enabled"] = Entity{
+		Component: "binary_sensor",
+		Getter:    w.OCPPEnabled,
+		Config: map[string]string{
+			"name":         "OCPP enabled",
+			"payload_on":   "1",
+			"payload_off":  "0",
+			"device_class": "power",
+		},
+	}
+
+	entities["ocpp_connected"] = Entity{
+		Component: "binary_sensor",
+		Getter:    w.OCPPConnected,
+		Config: map[string]string{
+			"name":         "OCPP connected",
+			"payload_on":   "1",
+			"payload_off":  "0",
+			"device_class": "connectivity",
+		},
+	}
+
+	entities["ocpp_transaction_id"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			state := w.OCPPJournal()
+			if !state.TransactionActive {
+				return noValue
+			}
+			return fmt.Sprint(state.TransactionID)
+		},
+		Config: map[string]string{
+			"name": "OCPP transaction ID",
+			"icon": "mdi:identifier",
+		},
+	}
+
+	entities["ocpp_last_heartbeat_age"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			state := w.OCPPJournal()
+			if state.LastHeartbeat.IsZero() {
+				return noValue
+			}
+			return fmt.Sprint(int(time.Since(state.LastHeartbeat).Seconds()))
+		},
+		RateLimit: ratelimit.NewDeltaRateLimit(30, 60),
+		Config: map[string]string{
+			"name":                "OCPP last heartbeat age",
+			"device_class":        "duration",
+			"unit_of_measurement": "s",
+			"state_class":         "measurement",
+			"entity_category":     "diagnostic",
+		},
+	}
+
+	entities["ocpp_last_error_code"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			state := w.OCPPJournal()
+			if state.LastErrorCode == "" {
+				return noValue
+			}
+			return state.LastErrorCode
+		},
+		Config: map[string]string{
+			"name":            "OCPP last error code",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_backend_latency"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			state := w.OCPPJournal()
+			if state.LastLatencyAction == "" {
+				return noValue
+			}
+			return fmt.Sprint(state.LastLatency.Milliseconds())
+		},
+		Config: map[string]string{
+			"name":                "OCPP backend latency",
+			"device_class":        "duration",
+			"unit_of_measurement": "ms",
+			"state_class":         "measurement",
+			"entity_category":     "diagnostic",
+		},
+	}
+
+	entities["ocpp_uptime"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			if _, known := r.health.Connected(); !known {
+				return noValue
+			}
+			return fmt.Sprintf("%.2f", r.health.Uptime(time.Now()))
+		},
+		RateLimit: ratelimit.NewDeltaRateLimit(60, 0.1),
+		Config: map[string]string{
+			"name":                        "OCPP uptime (24h)",
+			"unit_of_measurement":         "%",
+			"state_class":                 "measurement",
+			"suggested_display_precision": "1",
+			"icon":                        "mdi:cloud-check-outline",
+			"entity_category":             "diagnostic",
+		},
+	}
+
+	entities["ocpp_reconnects_last_hour"] = Entity{
+		Component: "sensor",
+		Getter:    func() string { return fmt.Sprint(r.health.Reconnects(time.Now(), time.Hour)) },
+		Config: map[string]string{
+			"name":            "OCPP reconnects (last hour)",
+			"state_class":     "measurement",
+			"icon":            "mdi:connection",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_last_disconnect_reason"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			if reason := r.health.LastDisconnectReason(); reason != "" {
+				return reason
+			}
+			return noValue
+		},
+		Config: map[string]string{
+			"name":            "OCPP last disconnect reason",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_heartbeat_interval"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			state := w.OCPPJournal()
+			if state.HeartbeatInterval == 0 {
+				return noValue
+			}
+			return fmt.Sprint(int(state.HeartbeatInterval.Seconds()))
+		},
+		Config: map[string]string{
+			"name":                "OCPP heartbeat interval",
+			"device_class":        "duration",
+			"unit_of_measurement": "s",
+			"state_class":         "measurement",
+			"entity_category":     "diagnostic",
+		},
+	}
+
+	entities["ocpp_connection_history"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			history := r.health.History()
+			if len(history) == 0 {
+				return noValue
+			}
+			return history[len(history)-1].At.Format(time.RFC3339)
+		},
+		Attributes: func() map[string]interface{} {
+			return map[string]interface{}{"history": r.health.History()}
+		},
+		Config: map[string]string{
+			"name":            "OCPP connection history",
+			"device_class":    "timestamp",
+			"icon":            "mdi:history",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_last_heal_action"] = Entity{
+		Component: "sensor",
+		Getter:    func() string { return r.lastHealAction },
+		Attributes: func() map[string]interface{} {
+			return map[string]interface{}{"history": r.heal.History()}
+		},
+		Config: map[string]string{
+			"name":            "OCPP last heal action",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_last_heal_at"] = Entity{
+		Component: "sensor",
+		Getter:    func() string { return r.lastHealAt },
+		Config: map[string]string{
+			"name":            "OCPP last heal at",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["ocpp_last_heal_detail"] = Entity{
+		Component: "sensor",
+		Getter: func() string {
+			if r.lastHealDetail == "" {
+				// Kept lowercase: automations compare against the old state.
+				return "none"
+			}
+			return r.lastHealDetail
+		},
+		Config: map[string]string{
+			"name":            "OCPP last heal detail",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	return entities
+}
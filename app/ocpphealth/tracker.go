@@ -0,0 +1,174 @@
+package ocpphealth
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a single OCPP backend connection transition.
+type Event struct {
+	At        time.Time `json:"at"`
+	Connected bool      `json:"connected"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Tracker follows the OCPP backend connection state over time so uptime,
+// reconnect rate and the reason of the last outage can be reported.
+type Tracker struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxHistory int
+
+	started   time.Time
+	connected bool
+
+	// events holds every transition inside the uptime window plus the last
+	// one before it, which anchors the state at the start of the window.
+	events  []Event
+	history []Event
+
+	lastDisconnectReason string
+}
+
+// New creates a tracker computing uptime over the given rolling window and
+// keeping the last maxHistory transitions for reporting.
+func New(window time.Duration, maxHistory int) *Tracker {
+	return &Tracker{
+		window:     window,
+		maxHistory: maxHistory,
+	}
+}
+
+// Observe records the connection state seen at now. reason describes why the
+// backend is considered down and is only kept for disconnect transitions. It
+// returns true when the state changed.
+func (t *Tracker) Observe(now time.Time, connected bool, reason string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started.IsZero() {
+		t.started = now
+		t.connected = connected
+		event := Event{At: now, Connected: connected}
+		if !connected {
+			event.Reason = reason
+			t.lastDisconnectReason = reason
+		}
+		t.record(event)
+		return true
+	}
+
+	if connected == t.connected {
+		return false
+	}
+
+	t.connected = connected
+	event := Event{At: now, Connected: connected}
+	if !connected {
+		event.Reason = reason
+		t.lastDisconnectReason = reason
+	}
+	t.record(event)
+	t.prune(now)
+	return true
+}
+
+func (t *Tracker) record(event Event) {
+	t.events = append(t.events, event)
+	t.history = append(t.history, event)
+	if len(t.history) > t.maxHistory {
+		t.history = t.history[len(t.history)-t.maxHistory:]
+	}
+}
+
+func (t *Tracker) prune(now time.Time) {
+	windowStart := now.Add(-t.window)
+	keep := 0
+	for i, event := range t.events {
+		if event.At.After(windowStart) {
+			break
+		}
+		keep = i
+	}
+	t.events = t.events[keep:]
+}
+
+// Connected returns the last observed state and whether any state has been
+// observed at all.
+func (t *Tracker) Connected() (connected bool, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected, !t.started.IsZero()
+}
+
+// Uptime returns the percentage of the rolling window (or of the time since
+// the first observation, if shorter) during which the backend was connected.
+func (t *Tracker) Uptime(now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started.IsZero() {
+		return 0
+	}
+
+	windowStart := now.Add(-t.window)
+	if windowStart.Before(t.started) {
+		windowStart = t.started
+	}
+	total := now.Sub(windowStart)
+	if total <= 0 {
+		if t.connected {
+			return 100
+		}
+		return 0
+	}
+
+	var up time.Duration
+	for i, event := range t.events {
+		from := event.At
+		if from.Before(windowStart) {
+			from = windowStart
+		}
+		to := now
+		if i+1 < len(t.events) {
+			to = t.events[i+1].At
+		}
+		if !to.After(from) || !event.Connected {
+			continue
+		}
+		up += to.Sub(from)
+	}
+
+	return float64(up) / float64(total) * 100
+}
+
+// Reconnects counts how often the backend came back after being down within
+// the given duration before now.
+func (t *Tracker) Reconnects(now time.Time, within time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := now.Add(-within)
+	count := 0
+	for i, event := range t.events {
+		if i == 0 || !event.Connected || event.At.Before(since) {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// LastDisconnectReason returns the reason recorded with the latest disconnect.
+func (t *Tracker) LastDisconnectReason() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastDisconnectReason
+}
+
+// History returns a copy of the most recent transitions, oldest first.
+func (t *Tracker) History() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.history...)
+}
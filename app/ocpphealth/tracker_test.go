@@ -0,0 +1,74 @@
+package ocpphealth
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrackerUptimeAndReconnects(t *testing.T) {
+	start := time.Date(2025, 11, 23, 12, 0, 0, 0, time.UTC)
+	tracker := New(24*time.Hour, 10)
+
+	tracker.Observe(start, true, "")
+	tracker.Observe(start.Add(30*time.Minute), false, "backend unreachable (online flag 2)")
+	tracker.Observe(start.Add(45*time.Minute), true, "")
+	tracker.Observe(start.Add(50*time.Minute), false, "backend unreachable (online flag 1)")
+	tracker.Observe(start.Add(55*time.Minute), true, "")
+
+	now := start.Add(60 * time.Minute)
+	if got := tracker.Uptime(now); math.Abs(got-66.666) > 0.01 {
+		t.Fatalf("expected ~66.67%% uptime, got %.3f", got)
+	}
+	if got := tracker.Reconnects(now, time.Hour); got != 2 {
+		t.Fatalf("expected 2 reconnects in the last hour, got %d", got)
+	}
+	if got := tracker.Reconnects(now, 10*time.Minute); got != 1 {
+		t.Fatalf("expected 1 reconnect in the last 10 minutes, got %d", got)
+	}
+	if got := tracker.LastDisconnectReason(); got != "backend unreachable (online flag 1)" {
+		t.Fatalf("unexpected last disconnect reason %q", got)
+	}
+}
+
+func TestTrackerIgnoresRepeatedState(t *testing.T) {
+	start := time.Date(2025, 11, 23, 12, 0, 0, 0, time.UTC)
+	tracker := New(24*time.Hour, 10)
+
+	if !tracker.Observe(start, false, "charger offline") {
+		t.Fatalf("expected first observation to count as a change")
+	}
+	if tracker.Observe(start.Add(time.Second), false, "charger offline") {
+		t.Fatalf("expected repeated state not to count as a change")
+	}
+	if got := len(tracker.History()); got != 1 {
+		t.Fatalf("expected 1 history entry, got %d", got)
+	}
+	if got := tracker.Reconnects(start.Add(time.Minute), time.Hour); got != 0 {
+		t.Fatalf("expected no reconnects, got %d", got)
+	}
+}
+
+func TestTrackerWindowAndHistoryLimit(t *testing.T) {
+	start := time.Date(2025, 11, 23, 0, 0, 0, 0, time.UTC)
+	tracker := New(time.Hour, 3)
+
+	tracker.Observe(start, false, "boot")
+	tracker.Observe(start.Add(10*time.Minute), true, "")
+	tracker.Observe(start.Add(2*time.Hour), false, "backend unreachable")
+	tracker.Observe(start.Add(2*time.Hour+30*time.Minute), true, "")
+
+	// Window is 01:30-02:30: up until 02:00, down until 02:30.
+	now := start.Add(2*time.Hour + 30*time.Minute)
+	if got := tracker.Uptime(now); math.Abs(got-50) > 0.01 {
+		t.Fatalf("expected 50%% uptime over the window, got %.3f", got)
+	}
+
+	history := tracker.History()
+	if len(history) != 3 {
+		t.Fatalf("expected history capped at 3 entries, got %d", len(history))
+	}
+	if !history[0].Connected || history[0].At != start.Add(10*time.Minute) {
+		t.Fatalf("expected oldest kept entry to be the first reconnect, got %+v", history[0])
+	}
+}
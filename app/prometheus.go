@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wallbox-mqtt-bridge/app/metrics"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// metricPrefix prefixes every metric name.
+const metricPrefix = "wallbox_"
+
+// bridgeMetrics counts what the bridge itself does.
+type bridgeMetrics struct {
+	serial string
+
+	publishes       *metrics.Vec
+	mqttConnects    *metrics.Vec
+	healActions     *metrics.Vec
+	refreshDuration *metrics.Vec
+	refreshes       *metrics.Vec
+	startTime       *metrics.Vec
+}
+
+func newBridgeMetrics(serial string) *bridgeMetrics {
+	m := &bridgeMetrics{
+		serial:          serial,
+		publishes:       metrics.NewCounter(metricPrefix+"bridge_mqtt_publishes_total", "Entity states published to MQTT.", "serial"),
+		mqttConnects:    metrics.NewCounter(metricPrefix+"bridge_mqtt_connects_total", "Connections made to the MQTT broker.", "serial"),
+		healActions:     metrics.NewCounter(metricPrefix+"bridge_heal_actions_total", "Heal actions run, by rule and action.", "serial", "rule", "action"),
+		refreshDuration: metrics.NewGauge(metricPrefix+"bridge_refresh_duration_seconds", "Duration of the last Redis and MySQL poll.", "serial"),
+		refreshes:       metrics.NewCounter(metricPrefix+"bridge_refreshes_total", "Redis and MySQL polls.", "serial"),
+		startTime:       metrics.NewGauge(metricPrefix+"bridge_start_time_seconds", "Start time of the bridge process since the Unix epoch.", "serial"),
+	}
+	m.startTime.Set(float64(time.Now().Unix()), serial)
+	return m
+}
+
+func (m *bridgeMetrics) published() {
+	m.publishes.Inc(m.serial)
+}
+
+func (m *bridgeMetrics) connected() {
+	m.mqttConnects.Inc(m.serial)
+}
+
+func (m *bridgeMetrics) healed(rule, action string) {
+	m.healActions.Inc(m.serial, rule, action)
+}
+
+func (m *bridgeMetrics) refreshed(d time.Duration) {
+	m.refreshes.Inc(m.serial)
+	m.refreshDuration.Set(d.Seconds(), m.serial)
+}
+
+// families returns the bridge internals, the numeric entity values, every
+// catalogued telemetry value and the service telemetry.
+func (m *bridgeMetrics) families(w *wallbox.Wallbox, states *stateStore, now time.Time) []metrics.Family {
+	families := []metrics.Family{
+		m.publishes.Family(),
+		m.mqttConnects.Family(),
+		m.healActions.Family(),
+		m.refreshDuration.Family(),
+		m.refreshes.Family(),
+		m.startTime.Family(),
+	}
+	labels := map[string]string{"serial": m.serial}
+	gauge := func(name, help string, value float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.Gauge, Samples: []metrics.Sample{{Labels: labels, Value: value}}}
+	}
+
+	if at := w.Snapshot().TelemetryAt; !at.IsZero() {
+		families = append(families, gauge(metricPrefix+"bridge_telemetry_age_seconds", "Time since the last telemetry event.", now.Sub(at).Seconds()))
+	}
+
+	seen := make(map[string]bool)
+	for _, state := range states.all() {
+		value, err := strconv.ParseFloat(state.Value, 64)
+		if err != nil {
+			continue
+		}
+		name := metricPrefix + metrics.SanitizeName(state.Key)
+		seen[name] = true
+		families = append(families, gauge(name, entityMetricHelp(state.Config["name"], state.Config["unit_of_measurement"]), value))
+	}
+
+	for _, sensor := range wallbox.TelemetryCatalogue() {
+		name := metricPrefix + metrics.SanitizeName(sensor.Key)
+		if sensor.Enum != nil || seen[name] {
+			continue
+		}
+		value, ok := w.TelemetryValue(sensor.Sensor)
+		if !ok {
+			continue
+		}
+		if sensor.Divisor != 0 {
+			value /= sensor.Divisor
+		}
+		families = append(families, gauge(name, entityMetricHelp(sensor.Name, sensor.Unit), value))
+	}
+
+	serviceFamilies := map[string]*metrics.Family{}
+	serviceMetric := func(suffix, help string, service string, value float64) {
+		name := metricPrefix + "service_" + suffix
+		f, ok := serviceFamilies[name]
+		if !ok {
+			f = &metrics.Family{Name: name, Help: help, Type: metrics.Gauge}
+			serviceFamilies[name] = f
+		}
+		f.Samples = append(f.Samples, metrics.Sample{Labels: map[string]string{"serial": m.serial, "service": service}, Value: value})
+	}
+	for _, svc := range wallbox.WallboxServices {
+		telemetry := w.ServiceTelemetry(svc.Sensor)
+		if !telemetry.Reported() {
+			continue
+		}
+		serviceMetric("simple_state", "Simple state reported by telemetry.", svc.Name, telemetry.SimpleState)
+		serviceMetric("cpu_usage", "CPU usage reported by telemetry.", svc.Name, telemetry.CPUUsage)
+		serviceMetric("memory", "Memory usage reported by telemetry.", svc.Name, telemetry.Memory)
+		serviceMetric("threads", "Threads reported by telemetry.", svc.Name, telemetry.Threads)
+	}
+	for _, f := range serviceFamilies {
+		families = append(families, *f)
+	}
+
+	return families
+}
+
+func entityMetricHelp(name, unit string) string {
+	if unit == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, unit)
+}
+
+// metricsHandler serves the metrics in the Prometheus text format.
+func metricsHandler(m *bridgeMetrics, w *wallbox.Wallbox, states *stateStore) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.WriteText(rw, m.families(w, states, time.Now())); err != nil {
+			httpLog.Errorf("Failed to write metrics: %v", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	w := &wallbox.Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_INTERNAL_METER_VOLTAGE_L1","value":231.5},
+		{"id":"SENSOR_CONTROL_PILOT_HIGH_TENTHS_OF_VOLTS","value":120},
+		{"id":"SENSOR_CONNECTION_TYPE","value":1},
+		{"id":"SENSOR_REDIS_SIMPLE_STATE","value":1},
+		{"id":"SENSOR_REDIS_MEMORY","value":4096}]}}`)
+
+	states := newStateStore()
+	now := time.Now()
+	states.update("charging_power", Entity{Config: map[string]string{"name": "Charging power", "unit_of_measurement": "W"}}, "2300", nil, now)
+	states.update("status", Entity{Config: map[string]string{"name": "Status"}}, "Charging", nil, now)
+
+	m := newBridgeMetrics("WB123")
+	m.published()
+	m.healed("ocpp_mismatch", "restart_service")
+	m.refreshed(25 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	metricsHandler(m, w, states).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# HELP wallbox_charging_power Charging power (W)\n",
+		`wallbox_charging_power{serial="WB123"} 2300`,
+		`wallbox_internal_meter_voltage_l1{serial="WB123"} 231.5`,
+		`wallbox_control_pilot_high_voltage{serial="WB123"} 12`,
+		`wallbox_service_memory{serial="WB123",service="redis"} 4096`,
+		`wallbox_bridge_mqtt_publishes_total{serial="WB123"} 1`,
+		`wallbox_bridge_heal_actions_total{action="restart_service",rule="ocpp_mismatch",serial="WB123"} 1`,
+		`wallbox_bridge_refresh_duration_seconds{serial="WB123"} 0.025`,
+		`wallbox_bridge_telemetry_age_seconds{serial="WB123"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"wallbox_status", "wallbox_connection_type"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("metrics contain non-numeric %s", unwanted)
+		}
+	}
+	if t.Failed() {
+		t.Log(body)
+	}
+}
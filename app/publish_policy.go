@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"wallbox-mqtt-bridge/app/ratelimit"
+)
+
+// defaultPublishPolicyName is the [publish.<name>] section applied to
+// entities without a section of their own.
+const defaultPublishPolicyName = "default"
+
+// publishPolicies turns the [publish.<entity>] sections into policies keyed
+// by entity, warning about sections that match no entity.
+func publishPolicies(c *WallboxConfig, entities map[string]Entity) (map[string]ratelimit.Policy, error) {
+	policies := make(map[string]ratelimit.Policy)
+	for _, pc := range c.PublishPolicies {
+		if err := pc.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := entities[pc.Name]; !ok && pc.Name != defaultPublishPolicyName {
+			configLog.Warnf("publish policy %s does not match any entity", pc.Name)
+		}
+		policies[pc.Name] = ratelimit.Policy{
+			MinInterval:     time.Duration(pc.MinIntervalSeconds * float64(time.Second)),
+			Heartbeat:       time.Duration(pc.HeartbeatSeconds * float64(time.Second)),
+			Deadband:        pc.Deadband,
+			DeadbandPercent: pc.DeadbandPercent,
+			Precision:       pc.Precision,
+		}
+	}
+	return policies, nil
+}
+
+func (pc PublishPolicyConfig) validate() error {
+	if pc.MinIntervalSeconds < 0 || pc.HeartbeatSeconds < 0 || pc.Deadband < 0 || pc.DeadbandPercent < 0 {
+		return fmt.Errorf("publish policy %s: intervals and deadbands must not be negative", pc.Name)
+	}
+	return nil
+}
+
+// newEntityPublisher returns the publisher for an entity: its own policy,
+// else the default policy, else one publishing every change, combined with
+// the entity's built-in rate limit.
+func newEntityPublisher(policies map[string]ratelimit.Policy, key string, entity Entity) *ratelimit.Publisher {
+	policy, ok := policies[key]
+	if !ok {
+		policy, ok = policies[defaultPublishPolicyName]
+	}
+	if !ok {
+		policy = ratelimit.Policy{Precision: -1}
+	}
+	return ratelimit.NewPublisher(policy, entity.RateLimit)
+}
@@ -0,0 +1,60 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPublishPoliciesFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.ini")
+	ini := `[mqtt]
+host = broker.lan
+
+[settings]
+polling_interval_seconds = 1
+
+[publish.default]
+heartbeat_seconds = 300
+
+[publish.charging_power]
+min_interval_seconds = 2.5
+deadband_percent = 5
+precision = 0
+`
+	if err := os.WriteFile(path, []byte(ini), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := publishPolicies(c, map[string]Entity{"charging_power": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	power := policies["charging_power"]
+	if power.MinInterval != 2500*time.Millisecond || power.DeadbandPercent != 5 || power.Precision != 0 || power.Heartbeat != 0 {
+		t.Fatalf("charging_power policy = %+v", power)
+	}
+	if def := policies[defaultPublishPolicyName]; def.Heartbeat != 5*time.Minute || def.Precision != -1 {
+		t.Fatalf("default policy = %+v", def)
+	}
+
+	// Entities without a section follow [publish.default].
+	start := time.Now()
+	p := newEntityPublisher(policies, "temp_l1", Entity{})
+	p.Publish(start, "21")
+	if _, ok := p.Publish(start.Add(5*time.Minute), "21"); !ok {
+		t.Fatalf("expected the default heartbeat to republish temp_l1")
+	}
+}
+
+func TestPublishPoliciesRejectNegativeValues(t *testing.T) {
+	c := &WallboxConfig{PublishPolicies: []PublishPolicyConfig{{Name: "lock", Deadband: -1, Precision: -1}}}
+	if _, err := publishPolicies(c, map[string]Entity{"lock": {}}); err == nil {
+		t.Fatal("expected an error for a negative deadband")
+	}
+}
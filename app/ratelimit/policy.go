@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Policy decides when an entity state is published. The zero value, with
+// Precision set to -1, publishes every change immediately.
+type Policy struct {
+	// MinInterval is the minimum time between two publishes of changed
+	// values.
+	MinInterval time.Duration
+	// Heartbeat republishes the state after this long even if it did not
+	// change. Zero disables it.
+	Heartbeat time.Duration
+	// Deadband suppresses numeric changes smaller than this absolute value.
+	Deadband float64
+	// DeadbandPercent suppresses numeric changes smaller than this
+	// percentage of the last published value.
+	DeadbandPercent float64
+	// Precision rounds numeric states to this many decimals before they are
+	// compared and published. Negative disables rounding.
+	Precision int
+}
+
+// HasDeadband reports whether the policy sets its own deadband, replacing
+// an entity's built-in DeltaRateLimit.
+func (p Policy) HasDeadband() bool {
+	return p.Deadband > 0 || p.DeadbandPercent > 0
+}
+
+// Publisher applies a Policy, and optionally an entity's built-in
+// DeltaRateLimit, to the successive states of one entity.
+type Publisher struct {
+	policy Policy
+	limit  *DeltaRateLimit
+
+	sent        bool
+	lastPayload string
+	lastValue   float64
+	lastNumeric bool
+	lastTime    time.Time
+
+	// pending is a changed payload held back by MinInterval or the rate
+	// limit; Flush publishes it once they allow.
+	pending        bool
+	pendingPayload string
+}
+
+// NewPublisher returns a Publisher for policy. limit is the entity's
+// built-in rate limit; it is ignored when the policy sets a deadband.
+func NewPublisher(policy Policy, limit *DeltaRateLimit) *Publisher {
+	if policy.HasDeadband() {
+		limit = nil
+	}
+	return &Publisher{policy: policy, limit: limit}
+}
+
+// Publish returns the payload to publish for the state payload observed at
+// now, and false if nothing should be published.
+func (p *Publisher) Publish(now time.Time, payload string) (string, bool) {
+	value, err := strconv.ParseFloat(payload, 64)
+	numeric := err == nil && !math.IsNaN(value) && !math.IsInf(value, 0)
+	if numeric && p.policy.Precision >= 0 {
+		scale := math.Pow(10, float64(p.policy.Precision))
+		value = math.Round(value*scale) / scale
+		payload = fmt.Sprint(value)
+	}
+
+	if !p.sent {
+		if numeric && p.limit != nil {
+			// Seed the rate limit with the first value.
+			p.limit.Allow(value)
+		}
+	} else if !p.due(now, payload, value, numeric) {
+		return "", false
+	}
+
+	p.record(now, payload, value, numeric)
+	return payload, true
+}
+
+func (p *Publisher) record(now time.Time, payload string, value float64, numeric bool) {
+	p.sent = true
+	p.lastPayload = payload
+	p.lastValue = value
+	p.lastNumeric = numeric
+	p.lastTime = now
+	p.pending = false
+}
+
+// FlushAt returns when a held back payload can be published by Flush; ok is
+// false if nothing is held back.
+func (p *Publisher) FlushAt() (at time.Time, ok bool) {
+	if !p.pending {
+		return time.Time{}, false
+	}
+	at = p.lastTime.Add(p.policy.MinInterval)
+	if p.limit != nil {
+		if _, limitAt, limitPending := p.limit.Pending(); limitPending && limitAt.After(at) {
+			at = limitAt
+		}
+	}
+	return at, true
+}
+
+// Flush returns the last held back payload once MinInterval and the rate
+// limit allow it, so that the final value of a burst of small changes is
+// published even if the state does not change again.
+func (p *Publisher) Flush(now time.Time) (string, bool) {
+	at, ok := p.FlushAt()
+	if !ok || now.Before(at) {
+		return "", false
+	}
+	if p.limit != nil {
+		if _, _, limitPending := p.limit.Pending(); limitPending {
+			if _, ok := p.limit.Flush(); !ok {
+				return "", false
+			}
+		}
+	}
+
+	payload := p.pendingPayload
+	value, err := strconv.ParseFloat(payload, 64)
+	p.record(now, payload, value, err == nil)
+	return payload, true
+}
+
+func (p *Publisher) due(now time.Time, payload string, value float64, numeric bool) bool {
+	elapsed := now.Sub(p.lastTime)
+	if p.policy.Heartbeat > 0 && elapsed >= p.policy.Heartbeat {
+		return true
+	}
+	if payload == p.lastPayload {
+		p.pending = false
+		return false
+	}
+	if elapsed < p.policy.MinInterval {
+		p.hold(payload)
+		return false
+	}
+	if !numeric || !p.lastNumeric {
+		return true
+	}
+
+	// Changes inside the deadband are dropped on purpose; only a heartbeat
+	// publishes them.
+	change := math.Abs(value - p.lastValue)
+	if p.policy.Deadband > 0 && change < p.policy.Deadband {
+		p.pending = false
+		return false
+	}
+	if p.policy.DeadbandPercent > 0 && change < math.Abs(p.lastValue)*p.policy.DeadbandPercent/100 {
+		p.pending = false
+		return false
+	}
+	if p.limit != nil && !p.limit.Allow(value) {
+		p.hold(payload)
+		return false
+	}
+	return true
+}
+
+func (p *Publisher) hold(payload string) {
+	p.pending = true
+	p.pendingPayload = payload
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 11, 23, 0, 0, 0, 0, time.UTC)
+
+type step struct {
+	after   time.Duration
+	payload string
+	want    string // empty: nothing published
+}
+
+func run(t *testing.T, p *Publisher, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		got, ok := p.Publish(start.Add(s.after), s.payload)
+		if s.want == "" {
+			if ok {
+				t.Errorf("step %d (%s at %v): published %q, want nothing", i, s.payload, s.after, got)
+			}
+			continue
+		}
+		if !ok || got != s.want {
+			t.Errorf("step %d (%s at %v): got %q, %v, want %q", i, s.payload, s.after, got, ok, s.want)
+		}
+	}
+}
+
+func TestDefaultPolicyPublishesChangesOnly(t *testing.T) {
+	run(t, NewPublisher(Policy{Precision: -1}, nil), []step{
+		{0, "1", "1"},
+		{time.Second, "1", ""},
+		{2 * time.Second, "2", "2"},
+		{3 * time.Second, "Charging", "Charging"},
+	})
+}
+
+func TestMinInterval(t *testing.T) {
+	run(t, NewPublisher(Policy{MinInterval: 10 * time.Second, Precision: -1}, nil), []step{
+		{0, "1", "1"},
+		{5 * time.Second, "2", ""},
+		{10 * time.Second, "3", "3"},
+	})
+}
+
+func TestHeartbeatRepublishesUnchangedState(t *testing.T) {
+	run(t, NewPublisher(Policy{Heartbeat: time.Minute, Precision: -1}, nil), []step{
+		{0, "on", "on"},
+		{30 * time.Second, "on", ""},
+		{time.Minute, "on", "on"},
+		{90 * time.Second, "on", ""},
+		{2 * time.Minute, "on", "on"},
+	})
+}
+
+func TestHeartbeatOverridesDeadband(t *testing.T) {
+	run(t, NewPublisher(Policy{Heartbeat: time.Minute, Deadband: 100, Precision: -1}, nil), []step{
+		{0, "1000", "1000"},
+		{30 * time.Second, "1050", ""},
+		{time.Minute, "1050", "1050"},
+	})
+}
+
+func TestAbsoluteDeadband(t *testing.T) {
+	run(t, NewPublisher(Policy{Deadband: 50, Precision: -1}, nil), []step{
+		{0, "1000", "1000"},
+		{time.Second, "1049", ""},
+		{2 * time.Second, "950", "950"},
+		{3 * time.Second, "None", "None"},
+		{4 * time.Second, "960", "960"},
+	})
+}
+
+func TestPercentDeadband(t *testing.T) {
+	run(t, NewPublisher(Policy{DeadbandPercent: 5, Precision: -1}, nil), []step{
+		{0, "200", "200"},
+		{time.Second, "209", ""},
+		{2 * time.Second, "210", "210"},
+		{3 * time.Second, "0", "0"},
+		{4 * time.Second, "0.5", "0.5"},
+	})
+}
+
+func TestPrecisionRoundsBeforeComparing(t *testing.T) {
+	run(t, NewPublisher(Policy{Precision: 1}, nil), []step{
+		{0, "230.04", "230"},
+		{time.Second, "229.96", ""},
+		{2 * time.Second, "230.16", "230.2"},
+		{3 * time.Second, "Unknown", "Unknown"},
+	})
+}
+
+func TestDeadbandReplacesBuiltInRateLimit(t *testing.T) {
+	// The built-in limit would suppress a 20 W change for 10s.
+	builtIn := NewDeltaRateLimit(10, 100).WithClock(&fakeClock{now: start})
+	run(t, NewPublisher(Policy{Deadband: 10, Precision: -1}, builtIn), []step{
+		{0, "1000", "1000"},
+		{time.Millisecond, "1020", "1020"},
+	})
+}
+
+func TestBuiltInRateLimitIsKeptWithoutDeadband(t *testing.T) {
+	clock := &fakeClock{now: start}
+	run(t, NewPublisher(Policy{Precision: -1}, NewDeltaRateLimit(10, 100).WithClock(clock)), []step{
+		{0, "1000", "1000"},
+		{time.Millisecond, "1020", ""},
+		{2 * time.Millisecond, "1200", "1200"},
+	})
+}
@@ -5,31 +5,88 @@ import (
 	"time"
 )
 
+// Clock abstracts time so rate limits can be tested deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock returns the wall clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// DeltaRateLimit lets a value through when it changed by at least
+// valueChange, or when interval has passed since the last value let through.
+// The last suppressed value is kept so that it can be flushed once the
+// interval has passed, even if the value does not change again.
 type DeltaRateLimit struct {
+	clock       Clock
 	lastTime    time.Time
 	lastValue   float64
 	interval    time.Duration
 	valueChange float64
+
+	pending      bool
+	pendingValue float64
 }
 
 func NewDeltaRateLimit(interval time.Duration, valueChange float64) *DeltaRateLimit {
 	return &DeltaRateLimit{
+		clock:       SystemClock(),
 		interval:    interval * time.Second,
 		valueChange: valueChange,
 	}
 }
 
+// WithClock makes the rate limit use clock instead of the wall clock.
+func (c *DeltaRateLimit) WithClock(clock Clock) *DeltaRateLimit {
+	c.clock = clock
+	return c
+}
+
 func (c *DeltaRateLimit) Allow(value float64) bool {
-	now := time.Now()
+	now := c.clock.Now()
 
 	if math.Abs(value-c.lastValue) < c.valueChange {
 		if now.Sub(c.lastTime) < c.interval {
+			// Back at the value let through last needs no flush.
+			c.pending = value != c.lastValue
+			c.pendingValue = value
 			return false
 		}
 	}
 
 	c.lastTime = now
 	c.lastValue = value
+	c.pending = false
 
 	return true
 }
+
+// Pending returns the last suppressed value and when Flush will let it
+// through; ok is false if no value is waiting.
+func (c *DeltaRateLimit) Pending() (value float64, at time.Time, ok bool) {
+	if !c.pending {
+		return 0, time.Time{}, false
+	}
+	return c.pendingValue, c.lastTime.Add(c.interval), true
+}
+
+// Flush lets the last suppressed value through once the interval has passed
+// since the last value let through.
+func (c *DeltaRateLimit) Flush() (float64, bool) {
+	now := c.clock.Now()
+	if !c.pending || now.Sub(c.lastTime) < c.interval {
+		return 0, false
+	}
+
+	c.lastTime = now
+	c.lastValue = c.pendingValue
+	c.pending = false
+
+	return c.lastValue, true
+}
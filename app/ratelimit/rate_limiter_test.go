@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestDeltaRateLimitSuppressesSmallChanges(t *testing.T) {
+	clock := &fakeClock{now: start}
+	limit := NewDeltaRateLimit(10, 100).WithClock(clock)
+
+	if !limit.Allow(1000) {
+		t.Fatal("first value must be let through")
+	}
+	clock.advance(time.Second)
+	if limit.Allow(1050) {
+		t.Fatal("small change inside the interval must be suppressed")
+	}
+	if !limit.Allow(1200) {
+		t.Fatal("large change must be let through")
+	}
+	clock.advance(10 * time.Second)
+	if !limit.Allow(1210) {
+		t.Fatal("small change after the interval must be let through")
+	}
+}
+
+func TestDeltaRateLimitFlushesLastValueOfRampDown(t *testing.T) {
+	clock := &fakeClock{now: start}
+	limit := NewDeltaRateLimit(10, 100).WithClock(clock)
+	limit.Allow(90)
+
+	// Power ramps down to zero in steps smaller than the delta, then stays.
+	for _, value := range []float64{70, 50, 20, 0} {
+		clock.advance(500 * time.Millisecond)
+		if limit.Allow(value) {
+			t.Fatalf("step to %v must be suppressed", value)
+		}
+	}
+
+	if _, ok := limit.Flush(); ok {
+		t.Fatal("flush before the interval passed")
+	}
+	value, at, ok := limit.Pending()
+	if !ok || value != 0 || !at.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("Pending = %v, %v, %v", value, at, ok)
+	}
+
+	clock.now = at
+	if value, ok := limit.Flush(); !ok || value != 0 {
+		t.Fatalf("Flush = %v, %v, want 0, true", value, ok)
+	}
+	if _, _, ok := limit.Pending(); ok {
+		t.Fatal("nothing must be pending after a flush")
+	}
+	if limit.Allow(0) {
+		t.Fatal("the flushed value must count as let through")
+	}
+}
+
+func TestDeltaRateLimitReturningToLastValueNeedsNoFlush(t *testing.T) {
+	clock := &fakeClock{now: start}
+	limit := NewDeltaRateLimit(10, 100).WithClock(clock)
+	limit.Allow(1000)
+	clock.advance(time.Second)
+	limit.Allow(1050)
+	limit.Allow(1000)
+
+	if _, _, ok := limit.Pending(); ok {
+		t.Fatal("expected nothing pending after returning to the last value")
+	}
+}
+
+func TestPublisherFlushesHeldBackValue(t *testing.T) {
+	clock := &fakeClock{now: start}
+	p := NewPublisher(Policy{Precision: -1}, NewDeltaRateLimit(10, 100).WithClock(clock))
+
+	p.Publish(clock.Now(), "90")
+	clock.advance(time.Second)
+	if _, ok := p.Publish(clock.Now(), "0.0"); ok {
+		t.Fatal("small change must be held back")
+	}
+	at, ok := p.FlushAt()
+	if !ok || !at.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("FlushAt = %v, %v", at, ok)
+	}
+	if _, ok := p.Flush(clock.Now()); ok {
+		t.Fatal("flush before the interval passed")
+	}
+
+	clock.now = at
+	if payload, ok := p.Flush(clock.Now()); !ok || payload != "0.0" {
+		t.Fatalf("Flush = %q, %v", payload, ok)
+	}
+	if _, ok := p.Publish(clock.Now(), "0.0"); ok {
+		t.Fatal("flushed payload must not be published again")
+	}
+}
+
+func TestPublisherFlushesAfterMinInterval(t *testing.T) {
+	p := NewPublisher(Policy{MinInterval: 5 * time.Second, Precision: -1}, nil)
+	p.Publish(start, "Charging")
+	p.Publish(start.Add(time.Second), "Paused")
+
+	if payload, ok := p.Flush(start.Add(5 * time.Second)); !ok || payload != "Paused" {
+		t.Fatalf("Flush = %q, %v", payload, ok)
+	}
+}
+
+func TestPublisherDoesNotFlushDeadband(t *testing.T) {
+	p := NewPublisher(Policy{Deadband: 50, Precision: -1}, nil)
+	p.Publish(start, "1000")
+	p.Publish(start.Add(time.Second), "1010")
+
+	if _, ok := p.FlushAt(); ok {
+		t.Fatal("changes inside the deadband must not be flushed")
+	}
+}
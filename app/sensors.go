@@ -2,9 +2,9 @@ package bridge
 
 import (
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"wallbox-mqtt-bridge/app/ratelimit"
 	"wallbox-mqtt-bridge/app/wallbox"
@@ -17,8 +17,18 @@ type Entity struct {
 	RateLimit *ratelimit.DeltaRateLimit
 	Config    map[string]string
 	Options   []string
+	// Attributes, if set, is published as JSON on the entity's
+	// json_attributes_topic whenever it changes.
+	Attributes func() map[string]interface{}
+	// Sources are the changes the entity depends on. The publish loop only
+	// evaluates it for those events; zero means every change.
+	Sources wallbox.Source
 }
 
+// noValue is the state of an entity without a value, which Home Assistant
+// shows as unknown.
+const noValue = "None"
+
 func strToInt(val string) int {
 	i, _ := strconv.Atoi(val)
 	return i
@@ -33,6 +43,7 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 	return map[string]Entity{
 		"user_id_select": {
 			Component: "select",
+			Sources:   wallbox.SourcePoll,
 			Getter:    func() string { return w.SelectedUserId() },
 			Setter:    func(val string) { w.SetSelectedUserId(val) },
 			Options:   w.GetAllUserIds(),
@@ -42,6 +53,7 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"user_id_list": {
 			Component: "sensor",
+			Sources:   wallbox.SourcePoll,
 			Getter: func() string {
 				ids := w.GetAllUserIds()
 				return strings.Join(ids, ",")
@@ -52,6 +64,7 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"default_user_id": {
 			Component: "sensor",
+			Sources:   wallbox.SourcePoll,
 			Getter:    func() string { return w.UserId() },
 			Config: map[string]string{
 				"name": "Default User ID",
@@ -61,6 +74,18 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 			Component: "sensor",
 			Getter:    func() string { return fmt.Sprint(w.AddedEnergy()) },
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 50),
+			Attributes: func() map[string]interface{} {
+				detail := w.AddedEnergyDetail()
+				attributes := map[string]interface{}{"source": detail.Source}
+				if detail.SessionID != 0 {
+					attributes["session_id"] = detail.SessionID
+				}
+				if detail.Source == "meter" {
+					attributes["meter_wh"] = detail.Meter
+					attributes["baseline_wh"] = detail.Baseline
+				}
+				return attributes
+			},
 			Config: map[string]string{
 				"name":                        "Added energy",
 				"device_class":                "energy",
@@ -71,7 +96,8 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"added_range": {
 			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.SQL.AddedRange) },
+			Sources:   wallbox.SourcePoll,
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().SQL.AddedRange) },
 			Config: map[string]string{
 				"name":                        "Added range",
 				"device_class":                "distance",
@@ -189,7 +215,8 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"cumulative_added_energy": {
 			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.SQL.CumulativeAddedEnergy) },
+			Sources:   wallbox.SourcePoll,
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().SQL.CumulativeAddedEnergy) },
 			Config: map[string]string{
 				"name":                        "Cumulative added energy",
 				"device_class":                "energy",
@@ -200,8 +227,9 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"halo_brightness": {
 			Component: "number",
+			Sources:   wallbox.SourcePoll,
 			Setter:    func(val string) { w.SetHaloBrightness(strToInt(val)) },
-			Getter:    func() string { return fmt.Sprint(w.Data.SQL.HaloBrightness) },
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().SQL.HaloBrightness) },
 			Config: map[string]string{
 				"name":                "Halo Brightness",
 				"command_topic":       "~/set",
@@ -214,8 +242,9 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"lock": {
 			Component: "lock",
+			Sources:   wallbox.SourcePoll,
 			Setter:    func(val string) { w.SetLocked(strToInt(val), w.SelectedUserId()) },
-			Getter:    func() string { return fmt.Sprint(w.Data.SQL.Lock) },
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().SQL.Lock) },
 			Config: map[string]string{
 				"name":           "Lock",
 				"payload_lock":   "1",
@@ -227,8 +256,9 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"max_charging_current": {
 			Component: "number",
+			Sources:   wallbox.SourcePoll,
 			Setter:    func(val string) { w.SetMaxChargingCurrent(strToInt(val)) },
-			Getter:    func() string { return fmt.Sprint(w.Data.SQL.MaxChargingCurrent) },
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().SQL.MaxChargingCurrent) },
 			Config: map[string]string{
 				"name":                "Max charging current",
 				"command_topic":       "~/set",
@@ -240,11 +270,12 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		},
 		"restart_wallbox": {
 			Component: "button",
+			Sources:   wallbox.SourcePoll,
 			Getter:    func() string { return "" }, // stateless button
 			Setter: func(_ string) {
 				go func() {
-					if err := rebootSystem(); err != nil {
-						log.Printf("Failed to reboot Wallbox via restart button: %v", err)
+					if err := rebootSystem(w.System()); err != nil {
+						bridgeLog.Errorf("Failed to reboot Wallbox via restart button: %v", err)
 					}
 				}()
 			},
@@ -257,6 +288,17 @@ func getEntities(w *wallbox.Wallbox) map[string]Entity {
 		"status": {
 			Component: "sensor",
 			Getter:    w.EffectiveStatus,
+			Attributes: func() map[string]interface{} {
+				detail := w.StatusDetail()
+				return map[string]interface{}{
+					"source":           detail.Source,
+					"state_machine":    detail.StateMachine,
+					"charger_status":   detail.ChargerStatus,
+					"session_state":    detail.SessionState,
+					"session_override": detail.SessionOverride,
+					"control_pilot":    w.ControlPilotCode(),
+				}
+			},
 			Config: map[string]string{
 				"name": "Status",
 			},
@@ -310,10 +352,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_power_l1": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostStatus != 0 {
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_DCA_POWERBOOST_STATUS") != 0 {
 					return fmt.Sprint(w.ChargingPowerL1())
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine1Power)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine1Power)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 100),
 			Config: map[string]string{
@@ -327,10 +370,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_power_l2": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostStatus != 0 {
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_DCA_POWERBOOST_STATUS") != 0 {
 					return "0"
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine2Power)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine2Power)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 100),
 			Config: map[string]string{
@@ -344,10 +388,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_power_l3": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostStatus != 0 {
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_DCA_POWERBOOST_STATUS") != 0 {
 					return "0"
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine3Power)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine3Power)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 100),
 			Config: map[string]string{
@@ -361,10 +406,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_current_l1": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostProposalCurrent != 0 {
-					return fmt.Sprint(w.Data.RedisTelemetry.PowerboostProposalCurrent)
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_POWERBOOST_PROPOSAL_CURRENT") != 0 {
+					return fmt.Sprint(d.Telemetry.Get("SENSOR_POWERBOOST_PROPOSAL_CURRENT"))
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine1Current)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine1Current)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 0.2),
 			Config: map[string]string{
@@ -378,10 +424,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_current_l2": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostStatus != 0 {
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_DCA_POWERBOOST_STATUS") != 0 {
 					return "0"
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine2Current)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine2Current)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 0.2),
 			Config: map[string]string{
@@ -395,10 +442,11 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		"power_boost_current_l3": {
 			Component: "sensor",
 			Getter: func() string {
-				if w.HasTelemetry && w.Data.RedisTelemetry.PowerboostStatus != 0 {
+				d := w.Snapshot()
+				if d.HasTelemetry && d.Telemetry.Get("SENSOR_DCA_POWERBOOST_STATUS") != 0 {
 					return "0"
 				}
-				return fmt.Sprint(w.Data.RedisM2W.PowerBoostLine3Current)
+				return fmt.Sprint(d.RedisM2W.PowerBoostLine3Current)
 			},
 			RateLimit: ratelimit.NewDeltaRateLimit(10, 0.2),
 			Config: map[string]string{
@@ -411,7 +459,7 @@ func getPowerBoostEntities(w *wallbox.Wallbox, c *WallboxConfig) map[string]Enti
 		},
 		"power_boost_cumulative_added_energy": {
 			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisM2W.PowerBoostCumulativeEnergy) },
+			Getter:    func() string { return fmt.Sprint(w.Snapshot().RedisM2W.PowerBoostCumulativeEnergy) },
 			Config: map[string]string{
 				"name":                        "Power Boost Cumulative added energy",
 				"device_class":                "energy",
@@ -474,470 +522,80 @@ func getDebugEntities(w *wallbox.Wallbox) map[string]Entity {
 	}
 }
 
-// getTelemetryEventEntities creates entities for sensor data from the telemetry events
+// getTelemetryEventEntities creates entities for sensor data from the
+// telemetry events, generated from the wallbox telemetry catalogue.
 func getTelemetryEventEntities(w *wallbox.Wallbox) map[string]Entity {
-	entities := map[string]Entity{
-		// Power and Current Related
-		"icp_max_current": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ICPMaxCurrent) },
-			Config: map[string]string{
-				"name":                        "ICP Max Current",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"user_current_proposal": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.UserCurrentProposal) },
-			Config: map[string]string{
-				"name":                        "User Current Proposal",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
+	entities := make(map[string]Entity)
+	for _, sensor := range wallbox.TelemetryCatalogue() {
+		entities[sensor.Key] = telemetryEntity(w, sensor)
+	}
 
-		// Voltage Related
-		"internal_meter_voltage_l1": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.InternalMeterVoltageL1) },
-			RateLimit: ratelimit.NewDeltaRateLimit(10, 2),
-			Config: map[string]string{
-				"name":                        "Internal Meter Voltage L1",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"internal_meter_voltage_l2": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.InternalMeterVoltageL2) },
-			RateLimit: ratelimit.NewDeltaRateLimit(10, 2),
-			Config: map[string]string{
-				"name":                        "Internal Meter Voltage L2",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"internal_meter_voltage_l3": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.InternalMeterVoltageL3) },
-			RateLimit: ratelimit.NewDeltaRateLimit(10, 2),
-			Config: map[string]string{
-				"name":                        "Internal Meter Voltage L3",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"control_pilot_high_voltage": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ControlPilotHighVolts / 10.0) }, // Convert tenths to volts
-			Config: map[string]string{
-				"name":                        "Control Pilot High Voltage",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"control_pilot_low_voltage": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ControlPilotLowVolts / 10.0) }, // Convert tenths to volts
-			Config: map[string]string{
-				"name":                        "Control Pilot Low Voltage",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
+	return entities
+}
 
-		// Energy Related
-		"internal_meter_energy": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.InternalMeterEnergy) },
-			Config: map[string]string{
-				"name":                        "Internal Meter Energy",
-				"device_class":                "energy",
-				"unit_of_measurement":         "Wh",
-				"state_class":                 "total_increasing",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"ecosmart_green_energy": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.EcosmartGreenEnergy) },
-			Config: map[string]string{
-				"name":                        "EcoSmart Green Energy",
-				"device_class":                "energy",
-				"unit_of_measurement":         "Wh",
-				"state_class":                 "total_increasing",
-				"suggested_display_precision": "1",
-				"icon":                        "mdi:leaf",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"ecosmart_energy_total": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.EcosmartEnergyTotal) },
-			Config: map[string]string{
-				"name":                        "EcoSmart Total Energy",
-				"device_class":                "energy",
-				"unit_of_measurement":         "Wh",
-				"state_class":                 "total_increasing",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
+// telemetryEntity builds the entity for a catalogued telemetry sensor.
+func telemetryEntity(w *wallbox.Wallbox, sensor wallbox.TelemetrySensor) Entity {
+	entity := Entity{
+		Component: "sensor",
+		Getter:    func() string { return w.TelemetryState(sensor) },
+		Sources:   wallbox.SourceTelemetry,
+		Config: map[string]string{
+			"name": sensor.Name,
 		},
+	}
 
-		// System Status
-		"ecosmart_mode": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.EcosmartMode) },
-			Config: map[string]string{
-				"name":            "EcoSmart Mode",
-				"icon":            "mdi:leaf",
-				"entity_category": "diagnostic",
-			},
-		},
-		"ecosmart_status": {
-			Component: "sensor",
-			Getter:    w.EcosmartStatus,
-			Config: map[string]string{
-				"name":            "EcoSmart Status",
-				"icon":            "mdi:leaf",
-				"entity_category": "diagnostic",
-			},
-		},
-		"ecosmart_current_proposal": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.EcosmartCurrentProposal) },
-			Config: map[string]string{
-				"name":                        "EcoSmart Current Proposal",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"icon":                        "mdi:leaf",
-				"entity_category":             "diagnostic",
-			},
-		},
+	if sensor.Component == "binary_sensor" {
+		entity.Component = "binary_sensor"
+		entity.Config["payload_on"] = "1"
+		entity.Config["payload_off"] = "0"
+	}
+	if sensor.RateLimit != nil {
+		entity.RateLimit = ratelimit.NewDeltaRateLimit(time.Duration(sensor.RateLimit.Interval), sensor.RateLimit.Delta)
+	}
 
-		// Frequency
-		"internal_meter_frequency": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.InternalMeterFrequency) },
-			Config: map[string]string{
-				"name":                        "Internal Meter Frequency",
-				"device_class":                "frequency",
-				"unit_of_measurement":         "Hz",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_voltage_l1": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_VoltageL1) },
-			Config: map[string]string{
-				"name":                        "DCA Voltage L1",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_voltage_l2": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_VoltageL2) },
-			Config: map[string]string{
-				"name":                        "DCA Voltage L2",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_voltage_l3": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_VoltageL3) },
-			Config: map[string]string{
-				"name":                        "DCA Voltage L3",
-				"device_class":                "voltage",
-				"unit_of_measurement":         "V",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_current_l1": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_CurrentL1) },
-			Config: map[string]string{
-				"name":                        "DCA Current L1",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_current_l2": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_CurrentL2) },
-			Config: map[string]string{
-				"name":                        "DCA Current L2",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_current_l3": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCA_CurrentL3) },
-			Config: map[string]string{
-				"name":                        "DCA Current L3",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"dca_meter_frequency": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DCAMeterFrequency) },
-			Config: map[string]string{
-				"name":                        "DCA Meter Frequency",
-				"device_class":                "frequency",
-				"unit_of_measurement":         "Hz",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"external_meter_status": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ExternalMeterStatus) },
-			Config: map[string]string{
-				"name":            "External Meter Status",
-				"entity_category": "diagnostic",
-			},
-		},
+	optional := map[string]string{
+		"unit_of_measurement": sensor.Unit,
+		"device_class":        sensor.DeviceClass,
+		"state_class":         sensor.StateClass,
+		"icon":                sensor.Icon,
+		"entity_category":     sensor.Category,
+	}
+	for k, v := range optional {
+		if v != "" {
+			entity.Config[k] = v
+		}
+	}
+	if sensor.Precision != nil {
+		entity.Config["suggested_display_precision"] = fmt.Sprint(*sensor.Precision)
+	}
 
-		"ocpp_status": {
-			Component: "sensor",
-			Getter: func() string {
-				code := w.OCPPStatusCode()
-				return fmt.Sprintf("%d: %s", code, w.OCPPStatusDescription())
-			},
-			Config: map[string]string{
-				"name": "OCPP status",
-			},
-		},
+	return entity
+}
 
-		// Schedule and PowerBoost
-		"schedule_status": {
-			Component: "sensor",
-			Getter:    w.ScheduleStatus,
-			Config: map[string]string{
-				"name":            "Schedule Status",
-				"icon":            "mdi:calendar-clock",
-				"entity_category": "diagnostic",
-			},
-		},
-		"schedule_current_proposal": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ScheduleCurrentProposal) },
-			Config: map[string]string{
-				"name":                        "Schedule Current Proposal",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"icon":                        "mdi:calendar-clock",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"powerboost_status": {
-			Component: "sensor",
-			Getter:    w.PowerBoostStatus,
-			Config: map[string]string{
-				"name":            "PowerBoost Status",
-				"entity_category": "diagnostic",
-			},
-		},
-		"powerboost_proposal_current": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.PowerboostProposalCurrent) },
-			Config: map[string]string{
-				"name":                        "PowerBoost Current Proposal",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
+// uncataloguedTelemetryEntityKey returns the entity key of a telemetry
+// sensor without catalogue entry, e.g. "telemetry_new_sensor" for
+// SENSOR_NEW_SENSOR.
+func uncataloguedTelemetryEntityKey(sensorID string) string {
+	return "telemetry_" + strings.ToLower(strings.TrimPrefix(sensorID, "SENSOR_"))
+}
 
-		// New sensors from JSON data
-		"charging_enable_sensor": {
-			Component: "binary_sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ChargingEnable) },
-			Config: map[string]string{
-				"name":            "Charging Enable Status",
-				"payload_on":      "1",
-				"payload_off":     "0",
-				"entity_category": "diagnostic",
-			},
-		},
-		"control_pilot_duty": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ControlPilotDuty) },
-			Config: map[string]string{
-				"name":            "Control Pilot Duty",
-				"state_class":     "measurement",
-				"entity_category": "diagnostic",
-			},
-		},
-		"control_pilot_status_raw": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.ControlPilotStatus) },
-			Config: map[string]string{
-				"name":            "Control Pilot Status Raw",
-				"entity_category": "diagnostic",
-			},
-		},
-		"max_available_current": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.MaxAvailableCurrent) },
-			Config: map[string]string{
-				"name":                        "Max Available Current",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"max_charging_current_sensor": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.MaxChargingCurrent) },
-			Config: map[string]string{
-				"name":                        "Max Charging Current (sensor)",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"mid_status": {
-			Component: "sensor",
-			Getter:    w.MIDStatus,
-			Config: map[string]string{
-				"name":            "MID Status",
-				"entity_category": "diagnostic",
-			},
-		},
-		"welding": {
-			Component: "binary_sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.Welding) },
-			Config: map[string]string{
-				"name":            "Welding Detection",
-				"device_class":    "problem",
-				"payload_on":      "1",
-				"payload_off":     "0",
-				"entity_category": "diagnostic",
-			},
-		},
-		"firmware_error": {
-			Component: "binary_sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.FirmwareError) },
-			Config: map[string]string{
-				"name":            "Firmware Error",
-				"device_class":    "problem",
-				"payload_on":      "1",
-				"payload_off":     "0",
-				"entity_category": "diagnostic",
-			},
-		},
-		"dynamic_power_sharing_max_current": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.DynamicPowerSharingMaxCurrent) },
-			Config: map[string]string{
-				"name":                        "Dynamic Power Sharing Max Current",
-				"device_class":                "current",
-				"unit_of_measurement":         "A",
-				"state_class":                 "measurement",
-				"suggested_display_precision": "1",
-				"entity_category":             "diagnostic",
-			},
-		},
-		"control_mode": {
-			Component: "sensor",
-			Getter:    w.ControlMode,
-			Config: map[string]string{
-				"name":            "Control Mode",
-				"entity_category": "diagnostic",
-			},
-		},
-		"connectivity_status": {
-			Component: "sensor",
-			Getter:    w.ConnectivityStatus,
-			Config: map[string]string{
-				"name":            "Connectivity Status",
-				"entity_category": "diagnostic",
-			},
-		},
-		"on_time": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.OnTime) },
-			Config: map[string]string{
-				"name":            "System On Time",
-				"entity_category": "diagnostic",
-			},
-		},
-		"wifi_signal_strength": {
-			Component: "sensor",
-			Getter:    func() string { return fmt.Sprint(w.Data.RedisTelemetry.WifiSignalStrength) },
-			Config: map[string]string{
-				"name":                        "Wi-Fi Signal Strength",
-				"icon":                        "mdi:wifi",
-				"unit_of_measurement":         "dBm",
-				"suggested_display_precision": "0",
-			},
-		},
-		"connection_type": {
-			Component: "sensor",
-			Getter:    w.ConnectionType,
-			Config: map[string]string{
-				"name":            "Connection Type",
-				"entity_category": "diagnostic",
-			},
+// uncataloguedTelemetryEntity exposes a telemetry sensor without catalogue
+// entry as a generic diagnostic sensor.
+func uncataloguedTelemetryEntity(w *wallbox.Wallbox, sensorID string) Entity {
+	return Entity{
+		Component: "sensor",
+		Getter: func() string {
+			value, ok := w.TelemetryValue(sensorID)
+			if !ok {
+				return noValue
+			}
+			return fmt.Sprint(value)
+		},
+		Sources: wallbox.SourceTelemetry,
+		Config: map[string]string{
+			"name":            "Telemetry " + sensorID,
+			"icon":            "mdi:help-network-outline",
+			"entity_category": "diagnostic",
 		},
 	}
-
-	return entities
 }
@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"fmt"
+	"testing"
+
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+func catalogueSensor(t *testing.T, key string) wallbox.TelemetrySensor {
+	t.Helper()
+	for _, s := range wallbox.TelemetryCatalogue() {
+		if s.Key == key {
+			return s
+		}
+	}
+	t.Fatalf("no catalogue entry for %s", key)
+	return wallbox.TelemetrySensor{}
+}
+
+func TestTelemetryEntityFromCatalogue(t *testing.T) {
+	w := &wallbox.Wallbox{}
+
+	voltage := telemetryEntity(w, catalogueSensor(t, "internal_meter_voltage_l1"))
+	want := map[string]string{
+		"name":                        "Internal Meter Voltage L1",
+		"device_class":                "voltage",
+		"unit_of_measurement":         "V",
+		"state_class":                 "measurement",
+		"suggested_display_precision": "1",
+		"entity_category":             "diagnostic",
+	}
+	if voltage.Component != "sensor" || voltage.RateLimit == nil {
+		t.Fatalf("unexpected voltage entity: %+v", voltage)
+	}
+	for k, v := range want {
+		if voltage.Config[k] != v {
+			t.Errorf("voltage %s = %q, want %q", k, voltage.Config[k], v)
+		}
+	}
+	if len(voltage.Config) != len(want) {
+		t.Errorf("voltage config has extra keys: %v", voltage.Config)
+	}
+
+	wifi := telemetryEntity(w, catalogueSensor(t, "wifi_signal_strength"))
+	if wifi.Config["suggested_display_precision"] != "0" {
+		t.Errorf("wifi precision = %q, want 0", wifi.Config["suggested_display_precision"])
+	}
+	if _, ok := wifi.Config["entity_category"]; ok {
+		t.Errorf("wifi signal strength must not be a diagnostic entity")
+	}
+
+	welding := telemetryEntity(w, catalogueSensor(t, "welding"))
+	if welding.Component != "binary_sensor" || welding.Config["payload_on"] != "1" || welding.Config["device_class"] != "problem" {
+		t.Errorf("unexpected welding entity: %+v", welding)
+	}
+	if got := welding.Getter(); got != "0" {
+		t.Errorf("welding state = %q, want 0", got)
+	}
+}
+
+func TestUncataloguedTelemetryEntity(t *testing.T) {
+	w := &wallbox.Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_SOMETHING_NEW","value":1.5}]}}`)
+
+	key := uncataloguedTelemetryEntityKey("SENSOR_SOMETHING_NEW")
+	if key != "telemetry_something_new" {
+		t.Fatalf("key = %q", key)
+	}
+	entity := uncataloguedTelemetryEntity(w, "SENSOR_SOMETHING_NEW")
+	if got := entity.Getter(); got != "1.5" {
+		t.Fatalf("state = %q, want 1.5", got)
+	}
+	if entity.Config["entity_category"] != "diagnostic" {
+		t.Fatalf("expected a diagnostic entity, got %v", entity.Config)
+	}
+}
+
+func TestOCPPStatusIsAlwaysPublished(t *testing.T) {
+	w := &wallbox.Wallbox{}
+	if _, ok := getTelemetryEventEntities(w)["ocpp_status"]; ok {
+		t.Fatal("ocpp_status should not depend on debug_sensors")
+	}
+	entity, ok := getOCPPEntities(w, newOCPPRuntime())["ocpp_status"]
+	if !ok {
+		t.Fatal("ocpp_status is missing from the always published entities")
+	}
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_OCPP_STATUS","value":1}]}}`)
+	attributes := entity.Attributes()
+	if attributes["source"] != "telemetry" || attributes["code"] != 1 || attributes["updated"] == nil {
+		t.Fatalf("attributes = %v", attributes)
+	}
+	if _, ok := attributes["age_s"]; ok {
+		t.Fatal("age_s would republish the attributes on every evaluation")
+	}
+	if again := entity.Attributes(); fmt.Sprint(again) != fmt.Sprint(attributes) {
+		t.Fatalf("attributes changed without a new status: %v, then %v", attributes, again)
+	}
+}
+
+func TestLastHealEntitiesKeepTheirInitialStates(t *testing.T) {
+	entities := getOCPPEntities(&wallbox.Wallbox{}, newOCPPRuntime())
+	for key, want := range map[string]string{
+		"ocpp_last_heal_action": "idle",
+		"ocpp_last_heal_at":     "never",
+		"ocpp_last_heal_detail": "none",
+	} {
+		if got := entities[key].Getter(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
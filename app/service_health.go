@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"wallbox-mqtt-bridge/app/servicehealth"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// observeServices feeds the telemetry of every Wallbox service into the
+// monitor and logs services going down or starting to leak.
+func observeServices(w *wallbox.Wallbox, services *servicehealth.Monitor, now time.Time) {
+	for _, svc := range wallbox.WallboxServices {
+		telemetry := w.ServiceTelemetry(svc.Sensor)
+		if !telemetry.Reported() {
+			continue
+		}
+
+		before, seen := services.Status(svc.Name)
+		services.Observe(now, svc.Name, servicehealth.Sample{
+			Running:  telemetry.Running(),
+			CPUUsage: telemetry.CPUUsage,
+			Memory:   telemetry.Memory,
+			Threads:  telemetry.Threads,
+		})
+		after, _ := services.Status(svc.Name)
+
+		if (!seen || before.Healthy) && !after.Healthy {
+			serviceLog.Warnf("%s is not running (simple state %.0f)", svc.Name, telemetry.SimpleState)
+		} else if seen && !before.Healthy && after.Healthy {
+			serviceLog.Infof("%s is running again", svc.Name)
+		}
+		if !before.LeakSuspected && after.LeakSuspected {
+			serviceLog.Warnf("%s memory keeps growing (%.1f%% over the window), possible leak", svc.Name, after.MemoryGrowthPercent)
+		}
+	}
+}
+
+// getServiceHealthEntities returns one sensor per Wallbox service plus
+// summary sensors for services that are down or leaking memory. They only
+// change when observeServices runs on the polling tick.
+func getServiceHealthEntities(w *wallbox.Wallbox, services *servicehealth.Monitor) map[string]Entity {
+	entities := make(map[string]Entity)
+
+	for _, svc := range wallbox.WallboxServices {
+		svc := svc
+		entities["service_"+svc.Name] = Entity{
+			Component: "sensor",
+			Sources:   wallbox.SourcePoll,
+			Getter: func() string {
+				status, ok := services.Status(svc.Name)
+				switch {
+				case !ok:
+					return "unknown"
+				case !status.Healthy:
+					return "not running"
+				case status.LeakSuspected:
+					return "leak suspected"
+				}
+				return "running"
+			},
+			Attributes: func() map[string]interface{} {
+				status, ok := services.Status(svc.Name)
+				attributes := map[string]interface{}{
+					"unit":     svc.Unit,
+					"critical": svc.Critical,
+				}
+				if !ok {
+					return attributes
+				}
+				attributes["simple_state"] = w.ServiceTelemetry(svc.Sensor).SimpleState
+				attributes["cpu_usage"] = roundTo(status.CPUUsage, 1)
+				attributes["memory"] = status.Memory
+				attributes["threads"] = status.Threads
+				attributes["memory_growth_per_hour"] = roundTo(status.MemoryGrowthPerHour, 0)
+				attributes["memory_growth_percent"] = roundTo(status.MemoryGrowthPercent, 1)
+				attributes["leak_suspected"] = status.LeakSuspected
+				if !status.UnhealthySince.IsZero() {
+					attributes["unhealthy_since"] = status.UnhealthySince.Format(time.RFC3339)
+				}
+				return attributes
+			},
+			Config: map[string]string{
+				"name":            fmt.Sprintf("Service %s", svc.DisplayName),
+				"icon":            "mdi:cog-outline",
+				"entity_category": "diagnostic",
+			},
+		}
+	}
+
+	entities["services_unhealthy"] = Entity{
+		Component: "sensor",
+		Sources:   wallbox.SourcePoll,
+		Getter:    func() string { return fmt.Sprint(len(services.Unhealthy())) },
+		Attributes: func() map[string]interface{} {
+			return map[string]interface{}{"services": services.Unhealthy()}
+		},
+		Config: map[string]string{
+			"name":            "Services not running",
+			"state_class":     "measurement",
+			"icon":            "mdi:cog-off-outline",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	entities["service_memory_leak"] = Entity{
+		Component: "binary_sensor",
+		Sources:   wallbox.SourcePoll,
+		Getter: func() string {
+			if len(services.LeakSuspects()) > 0 {
+				return "1"
+			}
+			return "0"
+		},
+		Attributes: func() map[string]interface{} {
+			return map[string]interface{}{"services": services.LeakSuspects()}
+		},
+		Config: map[string]string{
+			"name":            "Service memory leak",
+			"payload_on":      "1",
+			"payload_off":     "0",
+			"device_class":    "problem",
+			"entity_category": "diagnostic",
+		},
+	}
+
+	return entities
+}
+
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,219 @@
+// Package servicehealth follows the health of the Wallbox system services
+// reported through telemetry and flags services whose memory keeps growing.
+package servicehealth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is the telemetry of one service at one point in time.
+type Sample struct {
+	Running  bool
+	CPUUsage float64
+	Memory   float64
+	Threads  float64
+}
+
+// Status is what the monitor knows about a service.
+type Status struct {
+	Sample
+	// Healthy is false while the service is not running.
+	Healthy        bool
+	UnhealthySince time.Time
+	// MemoryGrowthPerHour is the fitted memory growth over the leak window,
+	// in the unit telemetry reports memory in.
+	MemoryGrowthPerHour float64
+	// MemoryGrowthPercent is the fitted growth over the samples held,
+	// relative to the fitted starting value.
+	MemoryGrowthPercent float64
+	LeakSuspected       bool
+}
+
+// Config tunes leak detection.
+type Config struct {
+	// Window is how far back memory samples are kept.
+	Window time.Duration
+	// MinGrowthPercent is the fitted growth across the window above which a
+	// steadily growing service is flagged.
+	MinGrowthPercent float64
+}
+
+// DefaultConfig flags services that grew by 20% over six hours.
+func DefaultConfig() Config {
+	return Config{Window: 6 * time.Hour, MinGrowthPercent: 20}
+}
+
+// leakSamples is the number of memory samples kept per window. Telemetry
+// arrives far more often, so samples are thinned to one per window/leakSamples.
+const leakSamples = 60
+
+// minLeakSamples is how many samples are needed, spanning at least half the
+// window, before a service can be flagged.
+const minLeakSamples = 12
+
+// steadyGrowthRatio is the share of consecutive samples that must not shrink
+// for growth to count as steady rather than a spike.
+const steadyGrowthRatio = 0.8
+
+type memorySample struct {
+	at     time.Time
+	memory float64
+}
+
+type serviceState struct {
+	status  Status
+	samples []memorySample
+}
+
+// Monitor tracks service samples. It is safe for concurrent use.
+type Monitor struct {
+	mu       sync.Mutex
+	cfg      Config
+	services map[string]*serviceState
+}
+
+// New creates a monitor with the given leak detection settings.
+func New(cfg Config) *Monitor {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultConfig().Window
+	}
+	if cfg.MinGrowthPercent <= 0 {
+		cfg.MinGrowthPercent = DefaultConfig().MinGrowthPercent
+	}
+	return &Monitor{cfg: cfg, services: make(map[string]*serviceState)}
+}
+
+// Observe records a sample of the named service taken at now.
+func (m *Monitor) Observe(now time.Time, name string, sample Sample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.services[name]
+	if !ok {
+		state = &serviceState{}
+		m.services[name] = state
+	}
+
+	wasHealthy := ok && state.status.Healthy
+	state.status.Sample = sample
+	state.status.Healthy = sample.Running
+	switch {
+	case sample.Running:
+		state.status.UnhealthySince = time.Time{}
+	case wasHealthy || !ok:
+		state.status.UnhealthySince = now
+	}
+
+	if sample.Memory > 0 {
+		interval := m.cfg.Window / leakSamples
+		if n := len(state.samples); n == 0 || now.Sub(state.samples[n-1].at) >= interval {
+			state.samples = append(state.samples, memorySample{at: now, memory: sample.Memory})
+		}
+	}
+	cutoff := now.Add(-m.cfg.Window)
+	drop := 0
+	for drop < len(state.samples) && state.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	state.samples = state.samples[drop:]
+
+	m.updateLeak(state)
+}
+
+func (m *Monitor) updateLeak(state *serviceState) {
+	status := &state.status
+	status.MemoryGrowthPerHour = 0
+	status.MemoryGrowthPercent = 0
+	status.LeakSuspected = false
+
+	samples := state.samples
+	if len(samples) < 2 {
+		return
+	}
+
+	slope, intercept := fitLine(samples)
+	span := samples[len(samples)-1].at.Sub(samples[0].at)
+	status.MemoryGrowthPerHour = slope * float64(time.Hour/time.Second)
+	if intercept > 0 {
+		status.MemoryGrowthPercent = slope * span.Seconds() / intercept * 100
+	}
+
+	if len(samples) < minLeakSamples || span < m.cfg.Window/2 || slope <= 0 {
+		return
+	}
+	growing := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].memory >= samples[i-1].memory {
+			growing++
+		}
+	}
+	// A single step up (e.g. a cache filling once) is not a leak: both halves
+	// of the window have to grow as well.
+	half := len(samples) / 2
+	firstSlope, _ := fitLine(samples[:half])
+	secondSlope, _ := fitLine(samples[half:])
+	steady := float64(growing) >= steadyGrowthRatio*float64(len(samples)-1) &&
+		firstSlope >= slope/4 && secondSlope >= slope/4
+	status.LeakSuspected = steady && status.MemoryGrowthPercent >= m.cfg.MinGrowthPercent
+}
+
+// fitLine returns the least squares slope (per second) and the fitted value
+// at the first sample.
+func fitLine(samples []memorySample) (slope, intercept float64) {
+	start := samples[0].at
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.at.Sub(start).Seconds()
+		sumX += x
+		sumY += s.memory
+		sumXY += x * s.memory
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, sumY / n
+	}
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept
+}
+
+// Status returns the status of the named service and whether it was seen.
+func (m *Monitor) Status(name string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.services[name]
+	if !ok {
+		return Status{}, false
+	}
+	return state.status, true
+}
+
+// Unhealthy returns the names of the services that are not running, sorted.
+func (m *Monitor) Unhealthy() []string {
+	return m.filter(func(s Status) bool { return !s.Healthy })
+}
+
+// LeakSuspects returns the names of the services suspected of leaking
+// memory, sorted.
+func (m *Monitor) LeakSuspects() []string {
+	return m.filter(func(s Status) bool { return s.LeakSuspected })
+}
+
+func (m *Monitor) filter(match func(Status) bool) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for name, state := range m.services {
+		if match(state.status) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
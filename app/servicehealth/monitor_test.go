@@ -0,0 +1,86 @@
+package servicehealth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 11, 23, 0, 0, 0, 0, time.UTC)
+
+func feed(m *Monitor, name string, steps int, every time.Duration, memory func(i int) float64) time.Time {
+	now := start
+	for i := 0; i < steps; i++ {
+		now = start.Add(time.Duration(i) * every)
+		m.Observe(now, name, Sample{Running: true, Memory: memory(i), Threads: 4})
+	}
+	return now
+}
+
+func TestSteadyGrowthIsFlagged(t *testing.T) {
+	m := New(DefaultConfig())
+	feed(m, "mywallbox", 7*60, time.Minute, func(i int) float64 { return 10000 + float64(i)*10 })
+
+	status, ok := m.Status("mywallbox")
+	if !ok || !status.LeakSuspected {
+		t.Fatalf("expected leak to be suspected, got %+v", status)
+	}
+	if status.MemoryGrowthPerHour < 590 || status.MemoryGrowthPerHour > 610 {
+		t.Fatalf("expected ~600/h growth, got %.1f", status.MemoryGrowthPerHour)
+	}
+	if got := m.LeakSuspects(); !reflect.DeepEqual(got, []string{"mywallbox"}) {
+		t.Fatalf("LeakSuspects = %v", got)
+	}
+}
+
+func TestFlatOrNoisyMemoryIsNotFlagged(t *testing.T) {
+	m := New(DefaultConfig())
+	feed(m, "flat", 7*60, time.Minute, func(i int) float64 { return 10000 })
+	// Alternating spikes: large fitted growth is impossible to reach steadily.
+	feed(m, "noisy", 7*60, time.Minute, func(i int) float64 {
+		if i%2 == 0 {
+			return 10000
+		}
+		return 16000
+	})
+	// A single step up is growth, but not steady growth.
+	feed(m, "step", 7*60, time.Minute, func(i int) float64 {
+		if i < 200 {
+			return 10000
+		}
+		return 15000
+	})
+
+	if got := m.LeakSuspects(); len(got) != 0 {
+		t.Fatalf("expected no leak suspects, got %v", got)
+	}
+}
+
+func TestShortHistoryIsNotFlagged(t *testing.T) {
+	m := New(DefaultConfig())
+	feed(m, "young", 60, time.Minute, func(i int) float64 { return 10000 + float64(i)*100 })
+
+	if status, _ := m.Status("young"); status.LeakSuspected {
+		t.Fatalf("an hour of samples must not be enough for a six hour window")
+	}
+}
+
+func TestUnhealthyTracksSince(t *testing.T) {
+	m := New(DefaultConfig())
+	m.Observe(start, "redis", Sample{Running: true})
+	m.Observe(start.Add(time.Minute), "redis", Sample{Running: false})
+	m.Observe(start.Add(2*time.Minute), "redis", Sample{Running: false})
+
+	status, _ := m.Status("redis")
+	if status.Healthy || !status.UnhealthySince.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expected unhealthy since the first failed sample, got %+v", status)
+	}
+	if got := m.Unhealthy(); !reflect.DeepEqual(got, []string{"redis"}) {
+		t.Fatalf("Unhealthy = %v", got)
+	}
+
+	m.Observe(start.Add(3*time.Minute), "redis", Sample{Running: true})
+	if status, _ := m.Status("redis"); !status.Healthy || !status.UnhealthySince.IsZero() {
+		t.Fatalf("expected recovery, got %+v", status)
+	}
+}
@@ -0,0 +1,154 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"wallbox-mqtt-bridge/app/ratelimit"
+	"wallbox-mqtt-bridge/app/wallbox"
+)
+
+// getSiteEntities returns the sensors totalling the chargers, keyed by their
+// device names.
+func getSiteEntities(chargers map[string]*wallbox.Wallbox) map[string]Entity {
+	total := func(get func(w *wallbox.Wallbox) float64) func() string {
+		return func() string {
+			var sum float64
+			for _, w := range chargers {
+				sum += get(w)
+			}
+			return fmt.Sprint(sum)
+		}
+	}
+	each := func(get func(w *wallbox.Wallbox) float64) func() map[string]interface{} {
+		return func() map[string]interface{} {
+			values := make(map[string]interface{}, len(chargers))
+			for name, w := range chargers {
+				values[name] = get(w)
+			}
+			return values
+		}
+	}
+	power := (*wallbox.Wallbox).ChargingPower
+	energy := (*wallbox.Wallbox).AddedEnergy
+
+	return map[string]Entity{
+		"total_charging_power": {
+			Component:  "sensor",
+			Getter:     total(power),
+			Attributes: each(power),
+			RateLimit:  ratelimit.NewDeltaRateLimit(10, 100),
+			Config: map[string]string{
+				"name":                        "Total charging power",
+				"device_class":                "power",
+				"unit_of_measurement":         "W",
+				"state_class":                 "measurement",
+				"suggested_display_precision": "1",
+			},
+		},
+		"total_added_energy": {
+			Component:  "sensor",
+			Getter:     total(energy),
+			Attributes: each(energy),
+			RateLimit:  ratelimit.NewDeltaRateLimit(10, 50),
+			Config: map[string]string{
+				"name":                        "Total added energy",
+				"device_class":                "energy",
+				"unit_of_measurement":         "Wh",
+				"state_class":                 "total",
+				"suggested_display_precision": "1",
+			},
+		},
+		"chargers_charging": {
+			Component: "sensor",
+			Getter: func() string {
+				charging := 0
+				for _, w := range chargers {
+					if w.ChargingPower() > 0 {
+						charging++
+					}
+				}
+				return fmt.Sprint(charging)
+			},
+			Config: map[string]string{
+				"name":        "Chargers charging",
+				"icon":        "mdi:ev-station",
+				"state_class": "measurement",
+			},
+		},
+	}
+}
+
+// runSite publishes the site device, which totals the chargers, until
+// interrupted. It starts with the charger the bridge runs on, whose serial
+// number the site takes, and adds the others as they are received on
+// connected.
+func runSite(c *WallboxConfig, charger bridgeCharger, connected <-chan bridgeCharger, opts RunOptions) {
+	// members is only used on this goroutine, by the entity getters.
+	members := make(map[string]*wallbox.Wallbox, len(c.Chargers)+1)
+	members[c.Settings.DeviceName] = charger.w
+	local := charger.w
+	device := discoveryDevice{Serial: "site_" + local.SerialNumber(), Name: c.Settings.SiteName, Firmware: local.FirmwareVersion()}
+	entities := getSiteEntities(members)
+
+	client, err := connectBroker(c, device.availabilityTopic(), nil)
+	if err != nil {
+		panic(err)
+	}
+	for key, val := range entities {
+		client.Publish(discoveryTopic(device, key, val), 1, true, discoveryConfig(device, key, val)).Wait()
+	}
+	client.Publish(device.availabilityTopic(), 1, true, "online").Wait()
+
+	publishers := make(map[string]*ratelimit.Publisher)
+	publishedAttributes := make(map[string]string)
+	publish := func() {
+		now := time.Now()
+		for key, val := range entities {
+			if val.Attributes != nil {
+				attributes, _ := json.Marshal(val.Attributes())
+				if publishedAttributes[key] != string(attributes) {
+					client.Publish(device.topicPrefix()+"/"+key+"/attributes", 1, true, attributes).Wait()
+					publishedAttributes[key] = string(attributes)
+				}
+			}
+			publisher, ok := publishers[key]
+			if !ok {
+				publisher = newEntityPublisher(nil, key, val)
+				publishers[key] = publisher
+			}
+			if payload, ok := publisher.Publish(now, val.Getter()); ok {
+				mqttLog.Debugf("Publishing %s %s", key, payload)
+				client.Publish(device.topicPrefix()+"/"+key+"/state", 1, true, []byte(payload)).Wait()
+			}
+		}
+	}
+
+	ticker := time.NewTicker(time.Duration(c.Settings.PollingIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case charger := <-connected:
+			config, _ := chargerConfig(c, charger.name)
+			members[config.Settings.DeviceName] = charger.w
+			publish()
+			continue
+		case <-ticker.C:
+			publish()
+			if !opts.Once {
+				continue
+			}
+		case <-interrupt:
+		}
+		client.Publish(device.availabilityTopic(), 1, true, "offline").Wait()
+		client.Disconnect(250)
+		return
+	}
+}
@@ -0,0 +1,83 @@
+package system
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Fake is an in-memory SystemController for tests. It records every call
+// and fails calls listed in Errors, keyed like the recorded call, e.g.
+// "stop ocppwallbox.service" or "vendor_reboot".
+type Fake struct {
+	mu       sync.Mutex
+	calls    []string
+	Errors   map[string]error
+	Tails    map[string]string
+	journals map[string]*io.PipeWriter
+}
+
+// NewFake returns a Fake on which every call succeeds.
+func NewFake() *Fake {
+	return &Fake{
+		Errors:   make(map[string]error),
+		Tails:    make(map[string]string),
+		journals: make(map[string]*io.PipeWriter),
+	}
+}
+
+func (f *Fake) call(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, name)
+	return f.Errors[name]
+}
+
+// Calls returns the calls made so far, in order.
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *Fake) ServiceActive(unit string) error  { return f.call("is-active " + unit) }
+func (f *Fake) StopService(unit string) error    { return f.call("stop " + unit) }
+func (f *Fake) StartService(unit string) error   { return f.call("start " + unit) }
+func (f *Fake) RestartService(unit string) error { return f.call("restart " + unit) }
+func (f *Fake) VendorReboot() error              { return f.call("vendor_reboot") }
+func (f *Fake) Reboot() error                    { return f.call("reboot") }
+
+// FollowJournal returns a stream fed by WriteJournal.
+func (f *Fake) FollowJournal(unit string) (io.ReadCloser, error) {
+	if err := f.call("journal " + unit); err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	f.mu.Lock()
+	f.journals[unit] = w
+	f.mu.Unlock()
+	return r, nil
+}
+
+// JournalTail returns the lines set in Tails for the unit.
+func (f *Fake) JournalTail(unit string, lines int) (string, error) {
+	if err := f.call("journal-tail " + unit); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Tails[unit], nil
+}
+
+// WriteJournal appends a line to the unit's followed journal. It blocks until
+// the follower has read it and fails once the follower closed the stream.
+func (f *Fake) WriteJournal(unit, line string) error {
+	f.mu.Lock()
+	w, ok := f.journals[unit]
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("journal of %s is not followed", unit)
+	}
+	_, err := io.WriteString(w, line+"\n")
+	return err
+}
@@ -0,0 +1,124 @@
+// Package system abstracts the systemd and process control the bridge uses
+// on the charger, so service handling can be exercised without systemd.
+package system
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// VendorRebootScript is the Wallbox-provided reboot wrapper.
+const VendorRebootScript = "/home/root/.wallbox/reboot.sh"
+
+// SystemController controls Wallbox system services and the host.
+type SystemController interface {
+	// ServiceActive returns nil if the unit is active.
+	ServiceActive(unit string) error
+	StopService(unit string) error
+	StartService(unit string) error
+	RestartService(unit string) error
+	// VendorReboot runs the Wallbox reboot wrapper, which flushes telemetry
+	// and stops services before rebooting.
+	VendorReboot() error
+	// Reboot reboots via systemd directly.
+	Reboot() error
+	// FollowJournal streams new journal messages of the unit, one per line,
+	// until the returned reader is closed.
+	FollowJournal(unit string) (io.ReadCloser, error)
+	// JournalTail returns the last lines of the unit's journal, with
+	// timestamps.
+	JournalTail(unit string, lines int) (string, error)
+}
+
+// Exec implements SystemController with systemctl and journalctl.
+type Exec struct{}
+
+// NewExec returns the SystemController used on the charger.
+func NewExec() SystemController {
+	return Exec{}
+}
+
+func (Exec) ServiceActive(unit string) error {
+	return exec.Command("systemctl", "is-active", "--quiet", unit).Run()
+}
+
+func (Exec) StopService(unit string) error {
+	return exec.Command("systemctl", "stop", unit).Run()
+}
+
+func (Exec) StartService(unit string) error {
+	return exec.Command("systemctl", "start", unit).Run()
+}
+
+func (Exec) RestartService(unit string) error {
+	return exec.Command("systemctl", "restart", unit).Run()
+}
+
+func (Exec) VendorReboot() error {
+	return exec.Command(VendorRebootScript).Run()
+}
+
+func (Exec) Reboot() error {
+	return exec.Command("systemctl", "reboot").Run()
+}
+
+func (Exec) FollowJournal(unit string) (io.ReadCloser, error) {
+	cmd := exec.Command("journalctl",
+		"-u", unit,
+		"-f",      // follow new entries
+		"-n", "0", // do not replay historical logs
+		"-o", "cat", // message only, no metadata
+		"-q", // quiet
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &journalProcess{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+func (Exec) JournalTail(unit string, lines int) (string, error) {
+	out, err := exec.Command("journalctl",
+		"-u", unit,
+		"-n", strconv.Itoa(lines),
+		"-o", "short-iso",
+		"--no-pager",
+		"-q",
+	).Output()
+	return string(out), err
+}
+
+// ErrUnavailable is returned by Unavailable.
+var ErrUnavailable = errors.New("not available for a charger the bridge does not run on")
+
+// Unavailable is the SystemController of a charger the bridge reaches over
+// the network: its services and host cannot be controlled, so every call
+// fails.
+type Unavailable struct{}
+
+func (Unavailable) ServiceActive(string) error                  { return ErrUnavailable }
+func (Unavailable) StopService(string) error                    { return ErrUnavailable }
+func (Unavailable) StartService(string) error                   { return ErrUnavailable }
+func (Unavailable) RestartService(string) error                 { return ErrUnavailable }
+func (Unavailable) VendorReboot() error                         { return ErrUnavailable }
+func (Unavailable) Reboot() error                               { return ErrUnavailable }
+func (Unavailable) FollowJournal(string) (io.ReadCloser, error) { return nil, ErrUnavailable }
+func (Unavailable) JournalTail(string, int) (string, error)     { return "", ErrUnavailable }
+
+// journalProcess tears down journalctl when the stream is closed.
+type journalProcess struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (j *journalProcess) Close() error {
+	_ = j.cmd.Process.Kill()
+	_, _ = j.cmd.Process.Wait()
+	return j.ReadCloser.Close()
+}
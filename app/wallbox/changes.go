@@ -0,0 +1,66 @@
+package wallbox
+
+import "sync"
+
+// Source identifies where a change to the Wallbox data came from, so that
+// consumers can re-evaluate only what depends on it.
+type Source uint8
+
+const (
+	// SourceTelemetry is a /wbx/telemetry/events message.
+	SourceTelemetry Source = 1 << iota
+	// SourceSession is a session or state machine event.
+	SourceSession
+	// SourceJournal is an ocppwallbox journal line with an OCPP frame or
+	// status.
+	SourceJournal
+	// SourcePoll is RefreshData reading changed values from the Redis hashes
+	// or MySQL.
+	SourcePoll
+
+	AllSources = SourceTelemetry | SourceSession | SourceJournal | SourcePoll
+)
+
+// changeNotifier coalesces change notifications: any number of changes
+// between two TakeChanges calls result in at most one pending signal.
+type changeNotifier struct {
+	once    sync.Once
+	ch      chan struct{}
+	mux     sync.Mutex
+	pending Source
+}
+
+func (n *changeNotifier) channel() chan struct{} {
+	n.once.Do(func() { n.ch = make(chan struct{}, 1) })
+	return n.ch
+}
+
+func (n *changeNotifier) notify(src Source) {
+	n.mux.Lock()
+	n.pending |= src
+	n.mux.Unlock()
+
+	select {
+	case n.channel() <- struct{}{}:
+	default:
+	}
+}
+
+func (n *changeNotifier) take() Source {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	src := n.pending
+	n.pending = 0
+	return src
+}
+
+// Changes returns a channel that receives a value after the Wallbox data
+// changed. Call TakeChanges to learn which sources changed.
+func (w *Wallbox) Changes() <-chan struct{} {
+	return w.changes.channel()
+}
+
+// TakeChanges returns the sources that changed since the last call.
+func (w *Wallbox) TakeChanges() Source {
+	return w.changes.take()
+}
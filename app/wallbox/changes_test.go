@@ -0,0 +1,41 @@
+package wallbox
+
+import "testing"
+
+func TestChangesAreCoalesced(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_TEMP_L1","value":21}]}}`)
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_TEMP_L1","value":22}]}}`)
+	w.ProcessSessionUpdateEvent(`{"header":{"message_id":"EVENT_SESSION_UPDATE"},"body":{"session":{"state":"ready"}}}`)
+
+	select {
+	case <-w.Changes():
+	default:
+		t.Fatalf("expected a change signal")
+	}
+	select {
+	case <-w.Changes():
+		t.Fatalf("expected changes to be coalesced into one signal")
+	default:
+	}
+
+	if got := w.TakeChanges(); got != SourceTelemetry|SourceSession {
+		t.Fatalf("TakeChanges = %b, want telemetry and session", got)
+	}
+	if got := w.TakeChanges(); got != 0 {
+		t.Fatalf("TakeChanges after take = %b, want 0", got)
+	}
+}
+
+func TestJournalLinesSignalChanges(t *testing.T) {
+	w := newJournalTestWallbox(nil)
+	w.processOCPPJournalLine("no OCPP content here")
+	if got := w.TakeChanges(); got != 0 {
+		t.Fatalf("unrelated line changed %b", got)
+	}
+
+	w.processOCPPJournalLine(`OCPP_STACK|2025-11-23|22:49:54.647|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475570","StatusNotification",{"connectorId": 1,"errorCode": "NoError","status": "Charging"}]`)
+	if got := w.TakeChanges(); got != SourceJournal {
+		t.Fatalf("TakeChanges = %b, want journal", got)
+	}
+}
@@ -0,0 +1,48 @@
+package wallbox
+
+// The Wallbox data is written by the Redis subscription goroutine (telemetry
+// events) and by RefreshData, and read by the publish loop and MQTT command
+// handlers. Writers copy the current DataCache, change the copy and publish
+// it as the new snapshot; a published snapshot is never modified again, so
+// readers need no lock and see a consistent view for as long as they hold it.
+
+// emptyDataCache is the snapshot before the first refresh or event.
+var emptyDataCache = &DataCache{}
+
+// Snapshot returns the current immutable view of the Wallbox data. Callers
+// must not modify it; take one snapshot when several values must agree.
+func (w *Wallbox) Snapshot() *DataCache {
+	if d := w.data.Load(); d != nil {
+		return d
+	}
+	return emptyDataCache
+}
+
+// HasTelemetry reports whether at least one telemetry event was processed.
+func (w *Wallbox) HasTelemetry() bool {
+	return w.Snapshot().HasTelemetry
+}
+
+// update applies fn to a copy of the current data and publishes the result.
+// Writers are serialized so concurrent updates are not lost.
+func (w *Wallbox) update(fn func(d *DataCache)) {
+	w.dataMux.Lock()
+	defer w.dataMux.Unlock()
+
+	next := *w.Snapshot()
+	fn(&next)
+	w.data.Store(&next)
+}
+
+// storeRefresh publishes the Redis hash and MySQL values polled by
+// RefreshData and reports whether any of them changed. Telemetry in polled is
+// ignored: it may have changed while polling.
+func (w *Wallbox) storeRefresh(polled *DataCache) (changed bool) {
+	w.update(func(d *DataCache) {
+		changed = d.SQL != polled.SQL || d.RedisState != polled.RedisState || d.RedisM2W != polled.RedisM2W
+		d.SQL = polled.SQL
+		d.RedisState = polled.RedisState
+		d.RedisM2W = polled.RedisM2W
+	})
+	return changed
+}
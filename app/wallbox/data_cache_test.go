@@ -0,0 +1,146 @@
+package wallbox
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotIsNotChangedByLaterEvents(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_TEMP_L1","value":21}]}}`)
+	before := w.Snapshot()
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_TEMP_L1","value":35}]}}`)
+
+	if before.Telemetry.Get("SENSOR_TEMP_L1") != 21 {
+		t.Fatalf("old snapshot changed to %v", before.Telemetry.Get("SENSOR_TEMP_L1"))
+	}
+	if got := w.Snapshot().Telemetry.Get("SENSOR_TEMP_L1"); got != 35 {
+		t.Fatalf("new snapshot has TempL1 = %v, want 35", got)
+	}
+}
+
+func TestRefreshKeepsTelemetry(t *testing.T) {
+	w := &Wallbox{}
+	polled := *w.Snapshot()
+	polled.SQL.Lock = 1
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_TEMP_L1","value":21}]}}`)
+	w.storeRefresh(&polled)
+
+	d := w.Snapshot()
+	if d.SQL.Lock != 1 || d.Telemetry.Get("SENSOR_TEMP_L1") != 21 || !d.HasTelemetry {
+		t.Fatalf("refresh lost data: lock %v, TempL1 %v, HasTelemetry %v", d.SQL.Lock, d.Telemetry.Get("SENSOR_TEMP_L1"), d.HasTelemetry)
+	}
+}
+
+// TestConcurrentAccess is meant to be run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	w := &Wallbox{}
+	w.storeSelectedUserId("7")
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			w.ProcessTelemetryEvent(fmt.Sprintf(`{"body":{"sensors":[
+				{"id":"SENSOR_STATE_MACHINE","value":194},
+				{"id":"SENSOR_INTERNAL_METER_ENERGY","value":%d},
+				{"id":"SENSOR_REDIS_MEMORY","value":%d},
+				{"id":"SENSOR_SOMETHING_NEW","value":%d}]}}`, 1000+i, 4096+i, i))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			polled := *w.Snapshot()
+			polled.SQL.Lock = i % 2
+			polled.RedisState.ScheduleEnergy = float64(i)
+			w.storeRefresh(&polled)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			w.storeSelectedUserId(fmt.Sprint(7 + i%2))
+		}
+	}()
+
+	for r := 0; r < 4; r++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w.HasTelemetry()
+				w.ChargingPower()
+				w.ControlPilotStatus()
+				w.AddedEnergy()
+				w.ConnectionType()
+				w.TelemetryValue("SENSOR_SOMETHING_NEW")
+				w.ServiceTelemetry("REDIS")
+				w.UncataloguedTelemetrySensors()
+				w.SelectedUserId()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+
+	d := w.Snapshot()
+	if d.Telemetry.Get("SENSOR_INTERNAL_METER_ENERGY") != 1199 || d.RedisState.ScheduleEnergy != 199 {
+		t.Fatalf("lost update: energy %v, schedule energy %v", d.Telemetry.Get("SENSOR_INTERNAL_METER_ENERGY"), d.RedisState.ScheduleEnergy)
+	}
+}
+
+func TestStoreRefreshReportsChanges(t *testing.T) {
+	w := &Wallbox{}
+	polled := *w.Snapshot()
+	polled.SQL.Lock = 1
+	if !w.storeRefresh(&polled) {
+		t.Fatalf("expected a change after the lock changed")
+	}
+	if w.storeRefresh(&polled) {
+		t.Fatalf("expected no change for the same values")
+	}
+}
+
+func TestNeedsChangeComparesRefreshedData(t *testing.T) {
+	w := &Wallbox{}
+	lock := func(d *DataCache) int { return d.SQL.Lock }
+	polledLock := 0
+	w.refresh = func() error {
+		polled := *w.Snapshot()
+		polled.SQL.Lock = polledLock
+		w.storeRefresh(&polled)
+		return nil
+	}
+
+	if w.needsChange(lock, 0) {
+		t.Fatal("unlocked charger needs no unlock")
+	}
+	// Locked from the app since the last poll: unlocking must not be
+	// dropped as a no-op.
+	polledLock = 1
+	if !w.needsChange(lock, 0) {
+		t.Fatal("unlock dropped although the charger was locked in the meantime")
+	}
+	if w.needsChange(lock, 1) {
+		t.Fatal("locked charger needs no lock")
+	}
+
+	w.refresh = func() error { return fmt.Errorf("redis down") }
+	if !w.needsChange(lock, 1) {
+		t.Fatal("a failed refresh must not drop the command")
+	}
+}
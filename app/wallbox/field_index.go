@@ -0,0 +1,24 @@
+package wallbox
+
+import "reflect"
+
+// redisFieldIndex is built once per struct type from the fields' redis tags,
+// so hot paths neither scan the struct nor rebuild field lists.
+type redisFieldIndex struct {
+	// fields lists the redis tags in field order, as passed to HMGET.
+	fields []string
+}
+
+// newRedisFieldIndex indexes the redis tags of typ.
+func newRedisFieldIndex(typ reflect.Type) *redisFieldIndex {
+	ix := &redisFieldIndex{fields: make([]string, 0, typ.NumField())}
+	for i := 0; i < typ.NumField(); i++ {
+		ix.fields = append(ix.fields, typ.Field(i).Tag.Get("redis"))
+	}
+	return ix
+}
+
+var (
+	redisStateIndex = newRedisFieldIndex(reflect.TypeOf(DataCache{}.RedisState))
+	redisM2WIndex   = newRedisFieldIndex(reflect.TypeOf(DataCache{}.RedisM2W))
+)
@@ -0,0 +1,90 @@
+package wallbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"wallbox-mqtt-bridge/app/system"
+)
+
+func newJournalTestWallbox(sys system.SystemController) *Wallbox {
+	return &Wallbox{
+		telemetryOCPPStatus: -1,
+		journalOCPPStatus:   -1,
+		ocppJournal:         newOCPPJournalTracker(),
+		system:              sys,
+	}
+}
+
+func waitForJournal(t *testing.T, fake *system.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, call := range fake.Calls() {
+			if call == "journal ocppwallbox.service" {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("journal of ocppwallbox.service was never followed")
+}
+
+func TestOCPPJournalWatcherLifecycle(t *testing.T) {
+	fake := system.NewFake()
+	w := newJournalTestWallbox(fake)
+
+	w.StartOCPPJournalWatcher()
+	w.StartOCPPJournalWatcher() // second start is a no-op
+	waitForJournal(t, fake)
+
+	line := `OCPP_STACK|2025-11-23|22:49:54.647|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475570","StatusNotification",{"connectorId": 1,"errorCode": "NoError","status": "Charging"}]`
+	if err := fake.WriteJournal("ocppwallbox.service", line); err != nil {
+		t.Fatalf("WriteJournal: %v", err)
+	}
+	// The write returns once the line was read; a second write guarantees
+	// the first one has been processed.
+	if err := fake.WriteJournal("ocppwallbox.service", "noise"); err != nil {
+		t.Fatalf("WriteJournal: %v", err)
+	}
+
+	if code, _, ok := w.getJournalOCPPStatus(); !ok || code != 3 {
+		t.Fatalf("expected journal OCPP status 3 (Charging), got %d (ok=%v)", code, ok)
+	}
+
+	follows := 0
+	for _, call := range fake.Calls() {
+		if call == "journal ocppwallbox.service" {
+			follows++
+		}
+	}
+	if follows != 1 {
+		t.Fatalf("expected a single journal follower, got %d", follows)
+	}
+
+	w.StopOCPPJournalWatcher()
+	if err := fake.WriteJournal("ocppwallbox.service", line); err == nil {
+		t.Fatalf("expected journal stream to be closed after stop")
+	}
+	w.StopOCPPJournalWatcher() // stopping twice is harmless
+}
+
+func TestOCPPJournalWatcherFollowError(t *testing.T) {
+	fake := system.NewFake()
+	fake.Errors["journal ocppwallbox.service"] = errors.New("journalctl: not found")
+	w := newJournalTestWallbox(fake)
+
+	w.StartOCPPJournalWatcher()
+	done := make(chan struct{})
+	go func() {
+		w.StopOCPPJournalWatcher()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("StopOCPPJournalWatcher hung after follow error")
+	}
+}
@@ -0,0 +1,300 @@
+package wallbox
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OCPP-J message type identifiers, see OCPP-J 1.6 section 4.1.3.
+const (
+	ocppCall       = 2
+	ocppCallResult = 3
+	ocppCallError  = 4
+)
+
+// ocppChargePointActions lists the actions initiated by the charge point.
+// Only responses to these are used for backend latency, since the latency of
+// a CALLRESULT we send ourselves says nothing about the central system.
+var ocppChargePointActions = map[string]bool{
+	"Authorize":                     true,
+	"BootNotification":              true,
+	"DataTransfer":                  true,
+	"DiagnosticsStatusNotification": true,
+	"FirmwareStatusNotification":    true,
+	"Heartbeat":                     true,
+	"MeterValues":                   true,
+	"StartTransaction":              true,
+	"StatusNotification":            true,
+	"StopTransaction":               true,
+}
+
+// ocppFrame is a decoded OCPP-J CALL, CALLRESULT or CALLERROR array.
+type ocppFrame struct {
+	Type             int
+	UniqueID         string
+	Action           string
+	Payload          json.RawMessage
+	ErrorCode        string
+	ErrorDescription string
+}
+
+var (
+	ocppFrameStartRe = regexp.MustCompile(`\[\s*[234]\s*,\s*"`)
+	ocppStackTimeRe  = regexp.MustCompile(`OCPP_STACK\|(\d{4}-\d{2}-\d{2})\|(\d{2}:\d{2}:\d{2}\.\d{3})\|`)
+)
+
+// parseOCPPFrameFromLogLine locates the OCPP-J frame embedded in an
+// ocppwallbox WebSocketJsonClient journald line and decodes it. It returns
+// false if the line does not carry a complete, well-formed frame.
+func parseOCPPFrameFromLogLine(line string) (ocppFrame, bool) {
+	loc := ocppFrameStartRe.FindStringIndex(line)
+	if loc == nil {
+		return ocppFrame{}, false
+	}
+
+	var parts []json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(line[loc[0]:])).Decode(&parts); err != nil {
+		return ocppFrame{}, false
+	}
+	if len(parts) < 3 {
+		return ocppFrame{}, false
+	}
+
+	var frame ocppFrame
+	if err := json.Unmarshal(parts[0], &frame.Type); err != nil {
+		return ocppFrame{}, false
+	}
+	if err := json.Unmarshal(parts[1], &frame.UniqueID); err != nil {
+		return ocppFrame{}, false
+	}
+
+	switch frame.Type {
+	case ocppCall:
+		if len(parts) != 4 {
+			return ocppFrame{}, false
+		}
+		if err := json.Unmarshal(parts[2], &frame.Action); err != nil || frame.Action == "" {
+			return ocppFrame{}, false
+		}
+		frame.Payload = parts[3]
+	case ocppCallResult:
+		if len(parts) != 3 {
+			return ocppFrame{}, false
+		}
+		frame.Payload = parts[2]
+	case ocppCallError:
+		if len(parts) < 4 {
+			return ocppFrame{}, false
+		}
+		if err := json.Unmarshal(parts[2], &frame.ErrorCode); err != nil {
+			return ocppFrame{}, false
+		}
+		_ = json.Unmarshal(parts[3], &frame.ErrorDescription)
+	default:
+		return ocppFrame{}, false
+	}
+
+	return frame, true
+}
+
+// parseOCPPStackTime extracts the timestamp the OCPP stack logged the frame
+// with. journalctl may deliver lines in bursts, so this is more accurate for
+// latency measurements than the time we read the line.
+func parseOCPPStackTime(line string) (time.Time, bool) {
+	matches := ocppStackTimeRe.FindStringSubmatch(line)
+	if len(matches) < 3 {
+		return time.Time{}, false
+	}
+	ts, err := time.ParseInLocation("2006-01-02 15:04:05.000", matches[1]+" "+matches[2], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+var statusNotificationStatusRe = regexp.MustCompile(`status"\s*:\s*"([^"]+)"`)
+
+// parseOCPPStatusFromLogLine extracts the OCPP StatusNotification "status" field
+// from an ocppwallbox journald line. It returns the status string (e.g. "Available")
+// and true on success, or ""/false if the line does not contain a parsable
+// StatusNotification payload.
+func parseOCPPStatusFromLogLine(line string) (string, bool) {
+	if frame, ok := parseOCPPFrameFromLogLine(line); ok {
+		if frame.Type != ocppCall || frame.Action != "StatusNotification" {
+			return "", false
+		}
+		var req struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(frame.Payload, &req); err != nil || req.Status == "" {
+			return "", false
+		}
+		return req.Status, true
+	}
+
+	// Fall back to a plain regex for lines the stack truncated mid-frame.
+	if !strings.Contains(line, "StatusNotification") {
+		return "", false
+	}
+	matches := statusNotificationStatusRe.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		return "", false
+	}
+	status := strings.TrimSpace(matches[1])
+	if status == "" {
+		return "", false
+	}
+	return status, true
+}
+
+// OCPPJournalState is what the journal watcher has learned from the OCPP-J
+// frames exchanged between the charger and the central system.
+type OCPPJournalState struct {
+	TransactionID     int
+	TransactionActive bool
+
+	BootStatus  string
+	LastBootAt  time.Time
+	LastMeterAt time.Time
+
+	LastHeartbeat     time.Time
+	HeartbeatInterval time.Duration
+
+	AuthorizeStatus   string
+	RemoteStartStatus string
+	RemoteStopStatus  string
+
+	LastErrorCode        string
+	LastErrorDescription string
+	LastErrorAction      string
+	LastErrorAt          time.Time
+
+	LastLatency       time.Duration
+	LastLatencyAction string
+}
+
+type pendingOCPPCall struct {
+	action string
+	sentAt time.Time
+}
+
+// maxPendingOCPPCalls bounds the table of calls awaiting a response, so lost
+// responses cannot grow it without limit.
+const maxPendingOCPPCalls = 64
+
+// ocppJournalTracker correlates CALLs with their CALLRESULT/CALLERROR by
+// unique ID and folds the outcome into an OCPPJournalState.
+type ocppJournalTracker struct {
+	mu      sync.RWMutex
+	pending map[string]pendingOCPPCall
+	state   OCPPJournalState
+}
+
+func newOCPPJournalTracker() *ocppJournalTracker {
+	return &ocppJournalTracker{pending: make(map[string]pendingOCPPCall)}
+}
+
+func (t *ocppJournalTracker) State() OCPPJournalState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.state
+}
+
+func (t *ocppJournalTracker) handleFrame(frame ocppFrame, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch frame.Type {
+	case ocppCall:
+		t.handleCall(frame, at)
+	case ocppCallResult:
+		call, ok := t.takePending(frame.UniqueID, at)
+		if !ok {
+			return
+		}
+		t.handleResult(call.action, frame.Payload, at)
+	case ocppCallError:
+		call, _ := t.takePending(frame.UniqueID, at)
+		t.state.LastErrorCode = frame.ErrorCode
+		t.state.LastErrorDescription = frame.ErrorDescription
+		t.state.LastErrorAction = call.action
+		t.state.LastErrorAt = at
+	}
+}
+
+func (t *ocppJournalTracker) handleCall(frame ocppFrame, at time.Time) {
+	if len(t.pending) >= maxPendingOCPPCalls {
+		for id, call := range t.pending {
+			if at.Sub(call.sentAt) > 5*time.Minute {
+				delete(t.pending, id)
+			}
+		}
+		if len(t.pending) >= maxPendingOCPPCalls {
+			t.pending = make(map[string]pendingOCPPCall)
+		}
+	}
+	t.pending[frame.UniqueID] = pendingOCPPCall{action: frame.Action, sentAt: at}
+
+	switch frame.Action {
+	case "MeterValues":
+		t.state.LastMeterAt = at
+	case "StopTransaction":
+		var req struct {
+			TransactionID int `json:"transactionId"`
+		}
+		if json.Unmarshal(frame.Payload, &req) == nil && req.TransactionID != 0 {
+			t.state.TransactionID = req.TransactionID
+		}
+		t.state.TransactionActive = false
+	}
+}
+
+// takePending removes and returns the CALL a response refers to, recording
+// the round trip if the charger was the one waiting for it.
+func (t *ocppJournalTracker) takePending(uniqueID string, at time.Time) (pendingOCPPCall, bool) {
+	call, ok := t.pending[uniqueID]
+	if !ok {
+		return pendingOCPPCall{}, false
+	}
+	delete(t.pending, uniqueID)
+
+	if ocppChargePointActions[call.action] && !at.Before(call.sentAt) {
+		t.state.LastLatency = at.Sub(call.sentAt)
+		t.state.LastLatencyAction = call.action
+	}
+	return call, true
+}
+
+func (t *ocppJournalTracker) handleResult(action string, payload json.RawMessage, at time.Time) {
+	var conf struct {
+		Status        string `json:"status"`
+		TransactionID int    `json:"transactionId"`
+		IDTagInfo     struct {
+			Status string `json:"status"`
+		} `json:"idTagInfo"`
+	}
+	_ = json.Unmarshal(payload, &conf)
+
+	switch action {
+	case "BootNotification":
+		t.state.BootStatus = conf.Status
+		t.state.LastBootAt = at
+	case "Heartbeat":
+		if !t.state.LastHeartbeat.IsZero() && at.After(t.state.LastHeartbeat) {
+			t.state.HeartbeatInterval = at.Sub(t.state.LastHeartbeat)
+		}
+		t.state.LastHeartbeat = at
+	case "Authorize":
+		t.state.AuthorizeStatus = conf.IDTagInfo.Status
+	case "StartTransaction":
+		t.state.TransactionID = conf.TransactionID
+		t.state.TransactionActive = conf.TransactionID != 0 && conf.IDTagInfo.Status == "Accepted"
+	case "RemoteStartTransaction":
+		t.state.RemoteStartStatus = conf.Status
+	case "RemoteStopTransaction":
+		t.state.RemoteStopStatus = conf.Status
+	}
+}
@@ -1,6 +1,9 @@
 package wallbox
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestParseOCPPStatusFromLogLine_StatusNotificationAvailable(t *testing.T) {
 	line := `Nov 23 22:49:54 WB225619 ocppwallbox[13222]: OCPP_STACK|2025-11-23|22:49:54.647|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475570","StatusNotification",{"info": "","vendorId": "com.wallbox","vendorErrorCode": "","connectorId": 1,"errorCode": "NoError","status": "Available","timestamp": "2025-11-23T22:49:54Z"}]`
@@ -30,4 +33,140 @@ func TestParseOCPPStatusFromLogLine_NonStatusNotification(t *testing.T) {
 	}
 }
 
+func TestParseOCPPFrameFromLogLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantType  int
+		wantID    string
+		wantExtra string
+	}{
+		{
+			name:      "call",
+			line:      `OCPP_STACK|2025-11-23|22:50:04.112|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475571","Heartbeat",{}]`,
+			wantType:  ocppCall,
+			wantID:    "1115475571",
+			wantExtra: "Heartbeat",
+		},
+		{
+			name:     "call result",
+			line:     `OCPP_STACK|2025-11-23|22:50:04.398|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475571",{"currentTime": "2025-11-23T22:50:04Z"}]`,
+			wantType: ocppCallResult,
+			wantID:   "1115475571",
+		},
+		{
+			name:      "call error",
+			line:      `OCPP_STACK|2025-11-23|22:51:10.020|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[4,"1115475572","NotImplemented","Requested Action is not known by receiver",{}]`,
+			wantType:  ocppCallError,
+			wantID:    "1115475572",
+			wantExtra: "NotImplemented",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, ok := parseOCPPFrameFromLogLine(tt.line)
+			if !ok {
+				t.Fatalf("expected to parse frame from line")
+			}
+			if frame.Type != tt.wantType || frame.UniqueID != tt.wantID {
+				t.Fatalf("got type=%d id=%q, want type=%d id=%q", frame.Type, frame.UniqueID, tt.wantType, tt.wantID)
+			}
+			if got := frame.Action + frame.ErrorCode; got != tt.wantExtra {
+				t.Fatalf("got action/error %q, want %q", got, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestParseOCPPFrameFromLogLine_Truncated(t *testing.T) {
+	line := `OCPP_STACK|2025-11-23|22:49:54.647|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475570","StatusNotification",{"info": "","vendorId": "com.wal`
+
+	if _, ok := parseOCPPFrameFromLogLine(line); ok {
+		t.Fatalf("expected truncated frame to be rejected")
+	}
+}
+
+func TestOCPPJournalTracker_Transaction(t *testing.T) {
+	lines := []string{
+		`OCPP_STACK|2025-11-23|23:01:02.000|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[2,"c0ffee01","RemoteStartTransaction",{"connectorId": 1,"idTag": "HA01"}]`,
+		`OCPP_STACK|2025-11-23|23:01:02.050|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Response to CS:[3,"c0ffee01",{"status": "Accepted"}]`,
+		`OCPP_STACK|2025-11-23|23:01:02.100|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475580","Authorize",{"idTag": "HA01"}]`,
+		`OCPP_STACK|2025-11-23|23:01:02.300|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475580",{"idTagInfo": {"status": "Accepted"}}]`,
+		`OCPP_STACK|2025-11-23|23:01:03.000|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475581","StartTransaction",{"connectorId": 1,"idTag": "HA01","meterStart": 1520,"timestamp": "2025-11-23T23:01:03Z"}]`,
+		`OCPP_STACK|2025-11-23|23:01:03.250|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475581",{"idTagInfo": {"status": "Accepted"},"transactionId": 4711}]`,
+	}
+
+	tracker := newOCPPJournalTracker()
+	feedOCPPLines(t, tracker, lines)
+
+	state := tracker.State()
+	if !state.TransactionActive || state.TransactionID != 4711 {
+		t.Fatalf("expected active transaction 4711, got active=%v id=%d", state.TransactionActive, state.TransactionID)
+	}
+	if state.RemoteStartStatus != "Accepted" {
+		t.Fatalf("expected RemoteStartTransaction status Accepted, got %q", state.RemoteStartStatus)
+	}
+	if state.AuthorizeStatus != "Accepted" {
+		t.Fatalf("expected Authorize status Accepted, got %q", state.AuthorizeStatus)
+	}
+	if state.LastLatencyAction != "StartTransaction" || state.LastLatency != 250*time.Millisecond {
+		t.Fatalf("expected 250ms StartTransaction latency, got %s for %q", state.LastLatency, state.LastLatencyAction)
+	}
 
+	feedOCPPLines(t, tracker, []string{
+		`OCPP_STACK|2025-11-23|23:40:00.000|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475590","StopTransaction",{"meterStop": 9120,"timestamp": "2025-11-23T23:40:00Z","transactionId": 4711,"reason": "EVDisconnected"}]`,
+	})
+	if state := tracker.State(); state.TransactionActive {
+		t.Fatalf("expected transaction to end after StopTransaction")
+	}
+}
+
+func TestOCPPJournalTracker_HeartbeatAndError(t *testing.T) {
+	lines := []string{
+		`OCPP_STACK|2025-11-23|22:49:50.000|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475560","BootNotification",{"chargePointModel": "PLP1","chargePointVendor": "Wall Box Chargers"}]`,
+		`OCPP_STACK|2025-11-23|22:49:50.400|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475560",{"currentTime": "2025-11-23T22:49:50Z","interval": 300,"status": "Accepted"}]`,
+		`OCPP_STACK|2025-11-23|22:50:04.112|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475571","Heartbeat",{}]`,
+		`OCPP_STACK|2025-11-23|22:50:04.398|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475571",{"currentTime": "2025-11-23T22:50:04Z"}]`,
+		`OCPP_STACK|2025-11-23|22:55:04.100|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475573","Heartbeat",{}]`,
+		`OCPP_STACK|2025-11-23|22:55:04.398|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[3,"1115475573",{"currentTime": "2025-11-23T22:55:04Z"}]`,
+		`OCPP_STACK|2025-11-23|22:51:10.000|INFO |13222|WebSocketJsonClient.cpp|63|dropMessages::Sending Request to CS:[2,"1115475572","MeterValues",{"connectorId": 1,"meterValue": []}]`,
+		`OCPP_STACK|2025-11-23|22:51:10.020|INFO |13222|WebSocketJsonClient.cpp|112|onMessage::Received from CS:[4,"1115475572","InternalError","Backend unavailable",{}]`,
+	}
+
+	tracker := newOCPPJournalTracker()
+	feedOCPPLines(t, tracker, lines)
+
+	state := tracker.State()
+	if state.BootStatus != "Accepted" {
+		t.Fatalf("expected BootNotification status Accepted, got %q", state.BootStatus)
+	}
+	wantHeartbeat := time.Date(2025, 11, 23, 22, 55, 4, 398000000, time.Local)
+	if !state.LastHeartbeat.Equal(wantHeartbeat) {
+		t.Fatalf("expected last heartbeat %s, got %s", wantHeartbeat, state.LastHeartbeat)
+	}
+	if state.HeartbeatInterval != 5*time.Minute {
+		t.Fatalf("expected 5m heartbeat interval, got %s", state.HeartbeatInterval)
+	}
+	if state.LastErrorCode != "InternalError" || state.LastErrorAction != "MeterValues" {
+		t.Fatalf("expected InternalError on MeterValues, got %q on %q", state.LastErrorCode, state.LastErrorAction)
+	}
+	if state.LastLatencyAction != "MeterValues" || state.LastLatency != 20*time.Millisecond {
+		t.Fatalf("expected 20ms MeterValues latency, got %s for %q", state.LastLatency, state.LastLatencyAction)
+	}
+}
+
+func feedOCPPLines(t *testing.T, tracker *ocppJournalTracker, lines []string) {
+	t.Helper()
+	for _, line := range lines {
+		frame, ok := parseOCPPFrameFromLogLine(line)
+		if !ok {
+			t.Fatalf("failed to parse frame from line: %s", line)
+		}
+		at, ok := parseOCPPStackTime(line)
+		if !ok {
+			t.Fatalf("failed to parse stack time from line: %s", line)
+		}
+		tracker.handleFrame(frame, at)
+	}
+}
@@ -0,0 +1,84 @@
+package wallbox
+
+// WallboxService is a system service whose resource usage the charger
+// reports through telemetry.
+type WallboxService struct {
+	// Name is used in entity IDs and heal readings, e.g. "micro2wallbox".
+	Name string
+	// DisplayName is the human readable name used for Home Assistant.
+	DisplayName string
+	// Sensor is the telemetry sensor prefix, e.g. "MICRO2WALLBOX" for
+	// SENSOR_MICRO2WALLBOX_MEMORY.
+	Sensor string
+	// Unit is the systemd unit, empty if the service cannot be restarted on
+	// its own.
+	Unit string
+	// Critical services are needed for charging; the bridge can heal them.
+	Critical bool
+}
+
+// WallboxServices lists the services reported by telemetry.
+var WallboxServices = []WallboxService{
+	{Name: "micro2wallbox", DisplayName: "micro2wallbox", Sensor: "MICRO2WALLBOX", Unit: "micro2wallbox.service", Critical: true},
+	{Name: "wallboxsmachine", DisplayName: "wallboxsmachine", Sensor: "WALLBOXSMACHINE", Unit: "wallboxsmachine.service", Critical: true},
+	{Name: "mywallbox", DisplayName: "mywallbox", Sensor: "MYWALLBOX", Unit: "mywallbox.service", Critical: true},
+	{Name: "ocppwallbox", DisplayName: "ocppwallbox", Sensor: "OCPPWALLBOX", Unit: "ocppwallbox.service"},
+	{Name: "redis", DisplayName: "Redis", Sensor: "REDIS", Unit: "redis.service", Critical: true},
+	{Name: "mysqld", DisplayName: "MySQL", Sensor: "MYSQLD", Unit: "mysqld.service", Critical: true},
+	{Name: "power_manager", DisplayName: "Power manager", Sensor: "POWER_MANAGER"},
+	{Name: "schedule_manager", DisplayName: "Schedule manager", Sensor: "SCHEDULE_MANAGER"},
+	{Name: "system_supervisor", DisplayName: "System supervisor", Sensor: "SYSTEM_SUPERVISOR"},
+	{Name: "software_update", DisplayName: "Software update", Sensor: "SOFTWARE_UPDATE"},
+	{Name: "telemetry_srvc", DisplayName: "Telemetry service", Sensor: "TELEMETRY_SRVC"},
+	{Name: "resources_monitor", DisplayName: "Resources monitor", Sensor: "RESOURCES_MONITOR"},
+	{Name: "on_time_track", DisplayName: "On-time tracker", Sensor: "ON_TIME_TRACK"},
+	{Name: "cloud_pub_sub_command", DisplayName: "Cloud pub/sub command", Sensor: "CLOUD_PUB_SUB_COMMAND"},
+	{Name: "cloud_pub_sub_telemetry", DisplayName: "Cloud pub/sub telemetry", Sensor: "CLOUD_PUB_SUB_TELEMETRY"},
+	{Name: "credentials_generator", DisplayName: "Credentials generator", Sensor: "CREDENTIALS_GENERATOR"},
+	{Name: "wallbox_cbit", DisplayName: "Wallbox CBIT", Sensor: "WALLBOX_CBIT"},
+	{Name: "wallbox_login", DisplayName: "Wallbox login", Sensor: "WALLBOX_LOGIN"},
+	{Name: "wallbox_network", DisplayName: "Wallbox network", Sensor: "WALLBOX_NETWORK"},
+	{Name: "wallco_adapter", DisplayName: "Wallco adapter", Sensor: "WALLCO_ADAPTER"},
+	{Name: "wbx_charger_info", DisplayName: "Charger info", Sensor: "WBX_CHARGER_INFO"},
+	{Name: "blewallbox", DisplayName: "BLE Wallbox", Sensor: "BLEWALLBOX"},
+	{Name: "bluetooth_gateway", DisplayName: "Bluetooth gateway", Sensor: "BLUETOOTH_GATEWAY"},
+	{Name: "networkmanager", DisplayName: "NetworkManager", Sensor: "NETWORKMANAGER"},
+	{Name: "wpa_supplicant", DisplayName: "wpa_supplicant", Sensor: "WPA_SUPPLICANT"},
+	{Name: "dbus", DisplayName: "D-Bus", Sensor: "DBUS"},
+	{Name: "non_wallbox", DisplayName: "Non-Wallbox processes", Sensor: "NON_WALLBOX"},
+}
+
+// serviceRunningState is the SIMPLE_STATE value of a running service
+// (observed).
+const serviceRunningState = 1
+
+// ServiceTelemetry is the last telemetry reported for a service.
+type ServiceTelemetry struct {
+	SimpleState float64
+	CPUUsage    float64
+	Memory      float64
+	Threads     float64
+}
+
+// Reported is false until telemetry for the service was received.
+func (s ServiceTelemetry) Reported() bool {
+	return s.SimpleState != 0 || s.CPUUsage != 0 || s.Memory != 0 || s.Threads != 0
+}
+
+// Running reports whether the service's simple state says it is running.
+func (s ServiceTelemetry) Running() bool {
+	return s.SimpleState == serviceRunningState
+}
+
+// ServiceTelemetry returns the telemetry last reported for the service with
+// the given sensor prefix.
+func (w *Wallbox) ServiceTelemetry(sensor string) ServiceTelemetry {
+	t := w.Snapshot().Telemetry
+	prefix := "SENSOR_" + sensor
+	return ServiceTelemetry{
+		SimpleState: t.Get(prefix + "_SIMPLE_STATE"),
+		CPUUsage:    t.Get(prefix + "_CPU_USAGE"),
+		Memory:      t.Get(prefix + "_MEMORY"),
+		Threads:     t.Get(prefix + "_THREADS"),
+	}
+}
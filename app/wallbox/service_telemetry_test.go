@@ -0,0 +1,32 @@
+package wallbox
+
+import "testing"
+
+func TestEveryServiceHasTelemetrySlots(t *testing.T) {
+	for _, svc := range WallboxServices {
+		for _, suffix := range []string{"_SIMPLE_STATE", "_CPU_USAGE", "_MEMORY", "_THREADS"} {
+			if _, ok := telemetrySlots["SENSOR_"+svc.Sensor+suffix]; !ok {
+				t.Errorf("service %s (%s) has no slot for %s", svc.Name, svc.Sensor, suffix)
+			}
+		}
+	}
+}
+
+func TestServiceTelemetryFollowsTelemetryEvents(t *testing.T) {
+	w := &Wallbox{}
+	if w.ServiceTelemetry("REDIS").Reported() {
+		t.Fatalf("expected no telemetry before any event")
+	}
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_REDIS_SIMPLE_STATE","value":1},
+		{"id":"SENSOR_REDIS_CPU_USAGE","value":2.5},
+		{"id":"SENSOR_REDIS_MEMORY","value":4096},
+		{"id":"SENSOR_REDIS_THREADS","value":4}]}}`)
+
+	got := w.ServiceTelemetry("REDIS")
+	want := ServiceTelemetry{SimpleState: 1, CPUUsage: 2.5, Memory: 4096, Threads: 4}
+	if got != want || !got.Running() {
+		t.Fatalf("ServiceTelemetry = %+v, want %+v", got, want)
+	}
+}
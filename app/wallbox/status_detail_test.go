@@ -0,0 +1,65 @@
+package wallbox
+
+import "testing"
+
+func TestStatusDetail(t *testing.T) {
+	w := &Wallbox{}
+	polled := *w.Snapshot()
+	polled.RedisM2W.ChargerStatus = 2
+	polled.RedisState.SessionState = 0xA1
+	w.storeRefresh(&polled)
+
+	detail := w.StatusDetail()
+	if detail.Source != "m2w" || !detail.SessionOverride || detail.Status != w.EffectiveStatus() || detail.SessionState != 0xA1 {
+		t.Fatalf("m2w detail = %+v", detail)
+	}
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_STATE_MACHINE","value":194}]}}`)
+	detail = w.StatusDetail()
+	if detail.Source != "telemetry" || detail.StateMachine != 194 || detail.Status != "Charging" || detail.ChargerStatus != 2 {
+		t.Fatalf("telemetry detail = %+v", detail)
+	}
+}
+
+func TestAddedEnergyDetail(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_STATE_MACHINE","value":161},
+		{"id":"SENSOR_INTERNAL_METER_ENERGY","value":1000}]}}`)
+	if detail := w.AddedEnergyDetail(); detail.Source != "meter" || detail.Baseline != 1000 || detail.Energy != 0 {
+		t.Fatalf("before charging: %+v", detail)
+	}
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_STATE_MACHINE","value":194},
+		{"id":"SENSOR_INTERNAL_METER_ENERGY","value":1250}]}}`)
+	if detail := w.AddedEnergyDetail(); detail.Meter != 1250 || detail.Baseline != 1000 || detail.Energy != 250 {
+		t.Fatalf("charging: %+v", detail)
+	}
+
+	polled := *w.Snapshot()
+	polled.SQL.ActiveSessionEnergyTotal = 300
+	polled.SQL.ActiveSessionID = 77
+	w.storeRefresh(&polled)
+	if detail := w.AddedEnergyDetail(); detail.Source != "session" || detail.SessionID != 77 || detail.Energy != w.AddedEnergy() {
+		t.Fatalf("active session: %+v", detail)
+	}
+}
+
+func TestOCPPStatusDetail(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_OCPP_STATUS","value":1}]}}`)
+	if detail := w.OCPPStatusDetail(); detail.Source != "telemetry" || detail.Code != 1 || detail.Updated.IsZero() {
+		t.Fatalf("telemetry: %+v", detail)
+	}
+
+	w.SetTelemetryOCPPStatus(3)
+	if detail := w.OCPPStatusDetail(); detail.Source != "session" || detail.Code != 3 {
+		t.Fatalf("session: %+v", detail)
+	}
+
+	w.SetJournalOCPPStatus(2)
+	if detail := w.OCPPStatusDetail(); detail.Source != "journal" || detail.Code != 2 || detail.Code != w.OCPPStatusCode() {
+		t.Fatalf("journal: %+v", detail)
+	}
+}
@@ -0,0 +1,177 @@
+package wallbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// loadTelemetryEvent reads a telemetry event captured on a Pulsar Plus
+// running 6.7.x, with two sensors the bridge has no field for.
+func loadTelemetryEvent(tb testing.TB) (string, TelemetryEvent) {
+	tb.Helper()
+	payload, err := os.ReadFile("testdata/telemetry_event.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var event TelemetryEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		tb.Fatal(err)
+	}
+	return string(payload), event
+}
+
+func TestTelemetryEventIsStoredBySensor(t *testing.T) {
+	payload, event := loadTelemetryEvent(t)
+
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(payload)
+	d := w.Snapshot()
+	for _, sensor := range event.Body.Sensors {
+		if value, ok := d.Telemetry.Value(sensor.ID); !ok || value != sensor.Value {
+			t.Errorf("%s = %v, %v; want %v", sensor.ID, value, ok, sensor.Value)
+		}
+	}
+	if got := w.UncataloguedTelemetrySensors(); len(got) != 2 {
+		t.Fatalf("expected the two unknown sensors to be kept, got %v", got)
+	}
+}
+
+func TestTelemetryUpdateKeepsPublishedSnapshot(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_SOMETHING_NEW","value":1},{"id":"SENSOR_TEMP_L1","value":20}]}}`)
+	before := w.Snapshot()
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[{"id":"SENSOR_SOMETHING_NEW","value":2},{"id":"SENSOR_TEMP_L1","value":30}]}}`)
+
+	if before.Telemetry.Get("SENSOR_SOMETHING_NEW") != 1 || before.Telemetry.Get("SENSOR_TEMP_L1") != 20 {
+		t.Fatalf("published snapshot changed: %s", mustJSON(t, before.Telemetry))
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRedisFieldListsFollowStructs(t *testing.T) {
+	typ := reflect.TypeOf(DataCache{}.RedisState)
+	if len(redisStateIndex.fields) != typ.NumField() || redisStateIndex.fields[0] != "session.state" {
+		t.Fatalf("unexpected state field list %v", redisStateIndex.fields)
+	}
+}
+
+// scanTelemetryType is the struct the telemetry used to be stored in: one
+// float64 field per known sensor, tagged with its Redis key.
+var scanTelemetryType = func() reflect.Type {
+	fields := make([]reflect.StructField, len(telemetrySlotSensors))
+	for i, sensorID := range telemetrySlotSensors {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Sensor%d", i),
+			Type: reflect.TypeOf(float64(0)),
+			Tag:  reflect.StructTag(`redis:"telemetry.` + sensorID + `"`),
+		}
+	}
+	return reflect.StructOf(fields)
+}()
+
+// updateTelemetryFieldScan is the previous implementation, which scanned
+// every field of the telemetry struct per sample. It is kept as the
+// benchmark baseline.
+func updateTelemetryFieldScan(v reflect.Value, sensorID string, value float64) bool {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		if t.Field(i).Tag.Get("redis") == "telemetry."+sensorID {
+			v.Field(i).SetFloat(value)
+			return true
+		}
+	}
+	return false
+}
+
+// getRedisFieldsScan is the previous way of listing the Redis hash fields,
+// reflecting on every RefreshData. It is kept as the benchmark baseline.
+func getRedisFieldsScan(obj interface{}) []string {
+	var result []string
+	typ := reflect.TypeOf(obj)
+	for i := 0; i < typ.NumField(); i++ {
+		result = append(result, typ.Field(i).Tag.Get("redis"))
+	}
+	return result
+}
+
+func TestSlotUpdateMatchesScan(t *testing.T) {
+	_, event := loadTelemetryEvent(t)
+
+	scanned := reflect.New(scanTelemetryType).Elem()
+	values := TelemetryValues{}.clone()
+	for _, sensor := range event.Body.Sensors {
+		known := updateTelemetryFieldScan(scanned, sensor.ID, sensor.Value)
+		if unknown := values.set(sensor.ID, sensor.Value); unknown == known {
+			t.Errorf("%s: known to the scan %v, to the slots %v", sensor.ID, known, !unknown)
+		}
+	}
+	for slot := range telemetrySlotSensors {
+		if got, want := values.at(slot), scanned.Field(slot).Float(); got != want {
+			t.Errorf("%s = %v, scan has %v", telemetrySlotSensors[slot], got, want)
+		}
+	}
+	if got := getRedisFieldsScan(DataCache{}.RedisM2W); !reflect.DeepEqual(got, redisM2WIndex.fields) {
+		t.Fatalf("m2w field list %v, scan has %v", redisM2WIndex.fields, got)
+	}
+}
+
+func BenchmarkUpdateTelemetryFieldScan(b *testing.B) {
+	_, event := loadTelemetryEvent(b)
+	v := reflect.New(scanTelemetryType).Elem()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, sensor := range event.Body.Sensors {
+			updateTelemetryFieldScan(v, sensor.ID, sensor.Value)
+		}
+	}
+}
+
+func BenchmarkUpdateTelemetryFieldSlot(b *testing.B) {
+	_, event := loadTelemetryEvent(b)
+	values := TelemetryValues{}.clone()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, sensor := range event.Body.Sensors {
+			values.set(sensor.ID, sensor.Value)
+		}
+	}
+}
+
+func BenchmarkRedisFieldsScan(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		getRedisFieldsScan(DataCache{}.RedisState)
+		getRedisFieldsScan(DataCache{}.RedisM2W)
+	}
+}
+
+func BenchmarkRedisFieldsIndexed(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_ = redisStateIndex.fields
+		_ = redisM2WIndex.fields
+	}
+}
+
+func BenchmarkProcessTelemetryEvent(b *testing.B) {
+	payload, _ := loadTelemetryEvent(b)
+	w := &Wallbox{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		w.ProcessTelemetryEvent(payload)
+	}
+}
@@ -0,0 +1,119 @@
+package wallbox
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// TelemetrySensor describes how a telemetry sensor is exposed to Home
+// Assistant. The catalogue is maintained in telemetry_catalogue.json.
+type TelemetrySensor struct {
+	// Sensor is the telemetry sensor ID, e.g. "SENSOR_ICP_MAX_CURRENT".
+	Sensor string `json:"sensor"`
+	// Key is the entity key used in topics and unique IDs.
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// Component is "sensor" (default) or "binary_sensor" for 0/1 values.
+	Component   string `json:"component,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	DeviceClass string `json:"device_class,omitempty"`
+	StateClass  string `json:"state_class,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	// Category is the Home Assistant entity_category, e.g. "diagnostic".
+	Category string `json:"category,omitempty"`
+	// Internal sensors are stored, but not exposed as telemetry entities:
+	// the bridge derives entities of its own from them.
+	Internal  bool `json:"internal,omitempty"`
+	Precision *int `json:"precision,omitempty"`
+	// Divisor scales the raw value, e.g. 10 for tenths of volts.
+	Divisor float64 `json:"divisor,omitempty"`
+	// Enum maps raw codes to descriptions. Codes not listed are formatted
+	// with EnumFallback, "Unknown (%d)" by default.
+	Enum         map[string]string `json:"enum,omitempty"`
+	EnumFallback string            `json:"enum_fallback,omitempty"`
+	RateLimit    *struct {
+		Interval int     `json:"interval"`
+		Delta    float64 `json:"delta"`
+	} `json:"rate_limit,omitempty"`
+}
+
+//go:embed telemetry_catalogue.json
+var telemetryCatalogueJSON []byte
+
+var telemetryCatalogue, telemetryCatalogueBySensor = func() ([]TelemetrySensor, map[string]TelemetrySensor) {
+	var sensors []TelemetrySensor
+	if err := json.Unmarshal(telemetryCatalogueJSON, &sensors); err != nil {
+		panic(fmt.Sprintf("invalid telemetry catalogue: %v", err))
+	}
+	bySensor := make(map[string]TelemetrySensor, len(sensors))
+	for _, s := range sensors {
+		bySensor[s.Sensor] = s
+	}
+	return sensors, bySensor
+}()
+
+// TelemetryCatalogue returns the catalogued telemetry sensors exposed as
+// entities.
+func TelemetryCatalogue() []TelemetrySensor {
+	var sensors []TelemetrySensor
+	for _, s := range telemetryCatalogue {
+		if !s.Internal {
+			sensors = append(sensors, s)
+		}
+	}
+	return sensors
+}
+
+// Describe returns the description of an enum code.
+func (s TelemetrySensor) Describe(code int) string {
+	if desc, ok := s.Enum[strconv.Itoa(code)]; ok {
+		return desc
+	}
+	if s.EnumFallback != "" {
+		return fmt.Sprintf(s.EnumFallback, code)
+	}
+	return fmt.Sprintf("Unknown (%d)", code)
+}
+
+// TelemetryValue returns the last value of a telemetry sensor and whether
+// it is known.
+func (w *Wallbox) TelemetryValue(sensorID string) (float64, bool) {
+	return w.Snapshot().Telemetry.Value(sensorID)
+}
+
+// TelemetryState formats the value of a catalogued sensor for publishing.
+func (w *Wallbox) TelemetryState(s TelemetrySensor) string {
+	value, ok := w.TelemetryValue(s.Sensor)
+	if s.Enum != nil {
+		if !w.HasTelemetry() || !ok {
+			return "Unknown"
+		}
+		return s.Describe(int(value))
+	}
+	if !ok {
+		return "None"
+	}
+	if s.Divisor != 0 {
+		value /= s.Divisor
+	}
+	return fmt.Sprint(value)
+}
+
+// UncataloguedTelemetrySensors returns the IDs of received sensors that are
+// neither catalogued nor service sensors, sorted.
+func (w *Wallbox) UncataloguedTelemetrySensors() []string {
+	var ids []string
+	for id := range w.Snapshot().Telemetry.extra {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// describeTelemetry describes the current value of a catalogued enum sensor.
+func (w *Wallbox) describeTelemetry(sensorID string) string {
+	return w.TelemetryState(telemetryCatalogueBySensor[sensorID])
+}
@@ -0,0 +1,72 @@
+package wallbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTelemetryCatalogueIsConsistent(t *testing.T) {
+	keys := make(map[string]string)
+	for _, s := range TelemetryCatalogue() {
+		if s.Sensor == "" || s.Key == "" || s.Name == "" {
+			t.Errorf("incomplete catalogue entry: %+v", s)
+		}
+		if other, dup := keys[s.Key]; dup {
+			t.Errorf("entity key %s used by %s and %s", s.Key, other, s.Sensor)
+		}
+		keys[s.Key] = s.Sensor
+		if s.Component != "" && s.Component != "sensor" && s.Component != "binary_sensor" {
+			t.Errorf("%s: unsupported component %q", s.Sensor, s.Component)
+		}
+	}
+}
+
+func TestTelemetryStateFormatsCatalogueValues(t *testing.T) {
+	w := &Wallbox{}
+	if got := w.ConnectivityStatus(); got != "Unknown" {
+		t.Fatalf("ConnectivityStatus before telemetry = %q", got)
+	}
+
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_CONTROL_PILOT_HIGH_TENTHS_OF_VOLTS","value":118},
+		{"id":"SENSOR_CONNECTIVITY_STATUS","value":3},
+		{"id":"SENSOR_CONTROL_MODE","value":7},
+		{"id":"SENSOR_MID_STATUS","value":9}]}}`)
+
+	high := telemetryCatalogueBySensor["SENSOR_CONTROL_PILOT_HIGH_TENTHS_OF_VOLTS"]
+	if got := w.TelemetryState(high); got != "11.8" {
+		t.Errorf("control pilot high voltage = %q, want 11.8", got)
+	}
+	if got := w.ConnectivityStatus(); got != "Offline" {
+		t.Errorf("ConnectivityStatus = %q, want Offline", got)
+	}
+	if got := w.ControlMode(); got != "7" {
+		t.Errorf("ControlMode fallback = %q, want 7", got)
+	}
+	if got := w.MIDStatus(); got != "Unknown (9)" {
+		t.Errorf("MIDStatus fallback = %q, want Unknown (9)", got)
+	}
+}
+
+func TestUncataloguedTelemetryIsKept(t *testing.T) {
+	w := &Wallbox{}
+	w.ProcessTelemetryEvent(`{"body":{"sensors":[
+		{"id":"SENSOR_SOMETHING_NEW","value":42},
+		{"id":"SENSOR_ICP_MAX_CURRENT","value":32}]}}`)
+
+	if !w.HasTelemetry() {
+		t.Fatalf("expected HasTelemetry after an event")
+	}
+	if got := w.UncataloguedTelemetrySensors(); !reflect.DeepEqual(got, []string{"SENSOR_SOMETHING_NEW"}) {
+		t.Fatalf("UncataloguedTelemetrySensors = %v", got)
+	}
+	if value, ok := w.TelemetryValue("SENSOR_SOMETHING_NEW"); !ok || value != 42 {
+		t.Fatalf("TelemetryValue = %v, %v", value, ok)
+	}
+	if value, ok := w.TelemetryValue("SENSOR_ICP_MAX_CURRENT"); !ok || value != 32 {
+		t.Fatalf("TelemetryValue of struct field = %v, %v", value, ok)
+	}
+	if _, ok := w.TelemetryValue("SENSOR_NEVER_SEEN"); ok {
+		t.Fatalf("expected unseen sensor to be unknown")
+	}
+}
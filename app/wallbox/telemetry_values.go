@@ -0,0 +1,139 @@
+package wallbox
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// telemetrySlots gives every known telemetry sensor, those of the catalogue
+// and the resource sensors of WallboxServices, its index in
+// TelemetryValues. It is built once from the catalogue and the service list,
+// so a new sensor only needs an entry there.
+var telemetrySlots, telemetrySlotSensors = func() (map[string]int, []string) {
+	slots := make(map[string]int)
+	var sensors []string
+	add := func(sensorID string) {
+		if _, ok := slots[sensorID]; ok {
+			return
+		}
+		slots[sensorID] = len(sensors)
+		sensors = append(sensors, sensorID)
+	}
+	for _, s := range telemetryCatalogue {
+		add(s.Sensor)
+	}
+	for _, svc := range WallboxServices {
+		for _, suffix := range []string{"_SIMPLE_STATE", "_CPU_USAGE", "_MEMORY", "_THREADS"} {
+			add("SENSOR_" + svc.Sensor + suffix)
+		}
+	}
+	return slots, sensors
+}()
+
+// telemetrySlot returns the slot of a known sensor. It panics for unknown
+// ones, so a misspelt sensor ID fails at startup.
+func telemetrySlot(sensorID string) int {
+	slot, ok := telemetrySlots[sensorID]
+	if !ok {
+		panic(fmt.Sprintf("telemetry sensor %s is neither catalogued nor a service sensor", sensorID))
+	}
+	return slot
+}
+
+// The slots of the sensors the bridge derives its own entities from.
+var (
+	sensorStateMachine       = telemetrySlot("SENSOR_STATE_MACHINE")
+	sensorControlPilotStatus = telemetrySlot("SENSOR_CONTROL_PILOT_STATUS")
+	sensorChargingEnable     = telemetrySlot("SENSOR_CHARGING_ENABLE")
+	sensorConnectionType     = telemetrySlot("SENSOR_CONNECTION_TYPE")
+	sensorOCPPStatus         = telemetrySlot("SENSOR_OCPP_STATUS")
+	sensorMeterEnergy        = telemetrySlot("SENSOR_INTERNAL_METER_ENERGY")
+	sensorMeterVoltage       = [3]int{
+		telemetrySlot("SENSOR_INTERNAL_METER_VOLTAGE_L1"),
+		telemetrySlot("SENSOR_INTERNAL_METER_VOLTAGE_L2"),
+		telemetrySlot("SENSOR_INTERNAL_METER_VOLTAGE_L3"),
+	}
+	sensorMeterCurrent = [3]int{
+		telemetrySlot("SENSOR_INTERNAL_METER_CURRENT_L1"),
+		telemetrySlot("SENSOR_INTERNAL_METER_CURRENT_L2"),
+		telemetrySlot("SENSOR_INTERNAL_METER_CURRENT_L3"),
+	}
+	sensorTemp = [3]int{
+		telemetrySlot("SENSOR_TEMP_L1"),
+		telemetrySlot("SENSOR_TEMP_L2"),
+		telemetrySlot("SENSOR_TEMP_L3"),
+	}
+)
+
+// TelemetryValues holds the telemetry sensor values of a snapshot. Known
+// sensors are addressed by their slot; sensors the bridge does not know yet
+// are kept by ID. Like the rest of a snapshot it must not be modified once
+// published: writers clone it first.
+type TelemetryValues struct {
+	known []float64
+	extra map[string]float64
+}
+
+// clone returns a copy that may be modified without changing t.
+func (t TelemetryValues) clone() TelemetryValues {
+	c := TelemetryValues{known: make([]float64, len(telemetrySlotSensors))}
+	copy(c.known, t.known)
+	if len(t.extra) > 0 {
+		c.extra = make(map[string]float64, len(t.extra))
+		for id, value := range t.extra {
+			c.extra[id] = value
+		}
+	}
+	return c
+}
+
+// set stores the value of a sensor. t must have been cloned. It reports
+// whether the sensor is new and unknown.
+func (t *TelemetryValues) set(sensorID string, value float64) (unknown bool) {
+	if slot, ok := telemetrySlots[sensorID]; ok {
+		t.known[slot] = value
+		return false
+	}
+	if t.extra == nil {
+		t.extra = make(map[string]float64)
+	}
+	_, seen := t.extra[sensorID]
+	t.extra[sensorID] = value
+	return !seen
+}
+
+// at returns the value in a slot, zero before the first telemetry event.
+func (t TelemetryValues) at(slot int) float64 {
+	if slot >= len(t.known) {
+		return 0
+	}
+	return t.known[slot]
+}
+
+// Value returns the value of a sensor and whether it is known. Known sensors
+// read zero until they are reported; unknown ones only once received.
+func (t TelemetryValues) Value(sensorID string) (float64, bool) {
+	if slot, ok := telemetrySlots[sensorID]; ok {
+		return t.at(slot), true
+	}
+	value, ok := t.extra[sensorID]
+	return value, ok
+}
+
+// Get returns the value of a sensor, zero if it is not known.
+func (t TelemetryValues) Get(sensorID string) float64 {
+	value, _ := t.Value(sensorID)
+	return value
+}
+
+// MarshalJSON writes the values keyed by sensor ID.
+func (t TelemetryValues) MarshalJSON() ([]byte, error) {
+	values := make(map[string]float64, len(telemetrySlotSensors)+len(t.extra))
+	for slot, sensorID := range telemetrySlotSensors {
+		values[sensorID] = t.at(slot)
+	}
+	for sensorID, value := range t.extra {
+		values[sensorID] = value
+	}
+	return json.Marshal(values)
+}
@@ -4,21 +4,28 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os/exec"
-	"reflect"
-	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"wallbox-mqtt-bridge/app/logging"
+	"wallbox-mqtt-bridge/app/system"
+
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	logger     = logging.New("wallbox")
+	ocppLogger = logging.New("ocpp")
+)
+
 type DataCache struct {
 	SQL struct {
 		Lock                     int     `db:"lock"`
@@ -28,6 +35,7 @@ type DataCache struct {
 		CumulativeAddedEnergy    float64 `db:"cumulative_added_energy"`
 		AddedRange               float64 `db:"added_range"`
 		ActiveSessionEnergyTotal float64 `db:"active_session_energy_total"`
+		ActiveSessionID          int64   `db:"active_session_id"`
 	}
 
 	RedisState struct {
@@ -57,298 +65,116 @@ type DataCache struct {
 		TempL3                     float64 `redis:"tms.line3.temp_deg.value"`
 	}
 
-	RedisTelemetry struct {
-		ICPMaxCurrent                 float64 `redis:"telemetry.SENSOR_ICP_MAX_CURRENT"`
-		InternalMeterCurrentL1        float64 `redis:"telemetry.SENSOR_INTERNAL_METER_CURRENT_L1"`
-		InternalMeterCurrentL2        float64 `redis:"telemetry.SENSOR_INTERNAL_METER_CURRENT_L2"`
-		InternalMeterCurrentL3        float64 `redis:"telemetry.SENSOR_INTERNAL_METER_CURRENT_L3"`
-		MaxAvailableCurrent           float64 `redis:"telemetry.SENSOR_MAX_AVAILABLE_CURRENT"`
-		UserCurrentProposal           float64 `redis:"telemetry.SENSOR_USER_CURRENT_PROPOSAL"`
-		DynamicPowerSharingMaxCurrent float64 `redis:"telemetry.SENSOR_DYNAMIC_POWER_SHARING_MAX_CURRENT"`
-
-		InternalMeterVoltageL1           float64 `redis:"telemetry.SENSOR_INTERNAL_METER_VOLTAGE_L1"`
-		InternalMeterVoltageL2           float64 `redis:"telemetry.SENSOR_INTERNAL_METER_VOLTAGE_L2"`
-		InternalMeterVoltageL3           float64 `redis:"telemetry.SENSOR_INTERNAL_METER_VOLTAGE_L3"`
-		InternalMeterVoltageFilterStatus float64 `redis:"telemetry.SENSOR_INTERNAL_METER_VOLTAGE_FILTER_STATUS"`
-		ControlPilotHighVolts            float64 `redis:"telemetry.SENSOR_CONTROL_PILOT_HIGH_TENTHS_OF_VOLTS"`
-		ControlPilotLowVolts             float64 `redis:"telemetry.SENSOR_CONTROL_PILOT_LOW_TENTHS_OF_VOLTS"`
-
-		InternalMeterEnergy float64 `redis:"telemetry.SENSOR_INTERNAL_METER_ENERGY"`
-		EcosmartGreenEnergy float64 `redis:"telemetry.SENSOR_ECOSMART_GREEN_ENERGY"`
-		EcosmartEnergyTotal float64 `redis:"telemetry.SENSOR_ECOSMART_ENERGY_TOTAL"`
-
-		EcosmartMode            float64 `redis:"telemetry.SENSOR_ECOSMART_MODE"`
-		EcosmartStatus          float64 `redis:"telemetry.SENSOR_ECOSMART_STATUS"`
-		EcosmartCurrentProposal float64 `redis:"telemetry.SENSOR_ECOSMART_CURRENT_PROPOSAL"`
-
-		InternalMeterFrequency float64 `redis:"telemetry.SENSOR_INTERNAL_METER_FREQUENCY"`
-
-		ScheduleStatus            float64 `redis:"telemetry.SENSOR_SCHEDULE_STATUS"`
-		ScheduleCurrentProposal   float64 `redis:"telemetry.SENSOR_SCHEDULE_CURRENT_PROPOSAL"`
-		PowerboostStatus          float64 `redis:"telemetry.SENSOR_DCA_POWERBOOST_STATUS"`
-		PowerboostProposalCurrent float64 `redis:"telemetry.SENSOR_POWERBOOST_PROPOSAL_CURRENT"`
-
-		// Additional fields referenced in getTelemetryEventEntities
-		ChargingEnable              float64 `redis:"telemetry.SENSOR_CHARGING_ENABLE"`
-		ControlPilotDuty            float64 `redis:"telemetry.SENSOR_CONTROL_PILOT_DUTY"`
-		ControlPilotStatus          float64 `redis:"telemetry.SENSOR_CONTROL_PILOT_STATUS"`
-		MaxChargingCurrent          float64 `redis:"telemetry.SENSOR_MAX_CHARGING_CURRENT"`
-		MidStatus                   float64 `redis:"telemetry.SENSOR_MID_STATUS"`
-		PowerSharingStatus          float64 `redis:"telemetry.SENSOR_POWER_SHARING_STATUS"`
-		TempL1                      float64 `redis:"telemetry.SENSOR_TEMP_L1"`
-		TempL2                      float64 `redis:"telemetry.SENSOR_TEMP_L2"`
-		TempL3                      float64 `redis:"telemetry.SENSOR_TEMP_L3"`
-		Welding                     float64 `redis:"telemetry.SENSOR_WELDING"`
-		FirmwareError               float64 `redis:"telemetry.SENSOR_FIRMWARE_ERROR"`
-		PowerRelayManagementCommand float64 `redis:"telemetry.SENSOR_POWER_RELAY_MANAGEMENT_COMMAND"`
-		StateMachine                float64 `redis:"telemetry.SENSOR_STATE_MACHINE"`
-		OCPPStatus                  float64 `redis:"telemetry.SENSOR_OCPP_STATUS"`
-
-		// Quiet unmapped telemetry to avoid log spam
-		ControlMode             float64 `redis:"telemetry.SENSOR_CONTROL_MODE"`
-		DCA_VoltageL1           float64 `redis:"telemetry.SENSOR_DCA_VOLTAGE_L1"`
-		DCA_VoltageL2           float64 `redis:"telemetry.SENSOR_DCA_VOLTAGE_L2"`
-		DCA_VoltageL3           float64 `redis:"telemetry.SENSOR_DCA_VOLTAGE_L3"`
-		DCA_CurrentL1           float64 `redis:"telemetry.SENSOR_DCA_CURRENT_L1"`
-		DCA_CurrentL2           float64 `redis:"telemetry.SENSOR_DCA_CURRENT_L2"`
-		DCA_CurrentL3           float64 `redis:"telemetry.SENSOR_DCA_CURRENT_L3"`
-		DCAMeterFrequency       float64 `redis:"telemetry.SENSOR_DCA_METER_FREQUENCY"`
-		ExternalMeterStatus     float64 `redis:"telemetry.SENSOR_EXTERNAL_METER_STATUS"`
-		PMSDominantFeature      float64 `redis:"telemetry.SENSOR_PMS_DOMINANT_FEATURE"`
-		PMSMetadata             float64 `redis:"telemetry.SENSOR_PMS_METADATA"`
-		PMSPhaseSwitch          float64 `redis:"telemetry.SENSOR_PMS_PHASE_SWITCH"`
-		GSMRecoTrigger          float64 `redis:"telemetry.SENSOR_GSM_RECO_TRIGGER"`
-		ConnectivityStatus      float64 `redis:"telemetry.SENSOR_CONNECTIVITY_STATUS"`
-		OnTime                  float64 `redis:"telemetry.SENSOR_ON_TIME"`
-		WifiSignalStrength      float64 `redis:"telemetry.SENSOR_WIFI_SIGNAL_STRENGTH"`
-		ConnectionType          float64 `redis:"telemetry.SENSOR_CONNECTION_TYPE"`
-		GetChargerConfigSend    float64 `redis:"telemetry.SENSOR_GET_CHARGER_CONFIG_SEND"`
-		GetChargerConfigReceive float64 `redis:"telemetry.SENSOR_GET_CHARGER_CONFIG_RECEIVE"`
-		GetChargerConfigCalls   float64 `redis:"telemetry.SENSOR_GET_CHARGER_CONFIG_CALLS"`
-
-		// Service resource telemetry
-		NetworkManagerCPUUsage    float64 `redis:"telemetry.SENSOR_NETWORKMANAGER_CPU_USAGE"`
-		NetworkManagerThreads     float64 `redis:"telemetry.SENSOR_NETWORKMANAGER_THREADS"`
-		NetworkManagerMemory      float64 `redis:"telemetry.SENSOR_NETWORKMANAGER_MEMORY"`
-		NetworkManagerSimpleState float64 `redis:"telemetry.SENSOR_NETWORKMANAGER_SIMPLE_STATE"`
-
-		BLEWallboxCPUUsage    float64 `redis:"telemetry.SENSOR_BLEWALLBOX_CPU_USAGE"`
-		BLEWallboxThreads     float64 `redis:"telemetry.SENSOR_BLEWALLBOX_THREADS"`
-		BLEWallboxMemory      float64 `redis:"telemetry.SENSOR_BLEWALLBOX_MEMORY"`
-		BLEWallboxSimpleState float64 `redis:"telemetry.SENSOR_BLEWALLBOX_SIMPLE_STATE"`
-
-		BluetoothGatewayCPUUsage    float64 `redis:"telemetry.SENSOR_BLUETOOTH_GATEWAY_CPU_USAGE"`
-		BluetoothGatewayThreads     float64 `redis:"telemetry.SENSOR_BLUETOOTH_GATEWAY_THREADS"`
-		BluetoothGatewayMemory      float64 `redis:"telemetry.SENSOR_BLUETOOTH_GATEWAY_MEMORY"`
-		BluetoothGatewaySimpleState float64 `redis:"telemetry.SENSOR_BLUETOOTH_GATEWAY_SIMPLE_STATE"`
-
-		CloudPubSubCommandCPUUsage    float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_COMMAND_CPU_USAGE"`
-		CloudPubSubCommandThreads     float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_COMMAND_THREADS"`
-		CloudPubSubCommandMemory      float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_COMMAND_MEMORY"`
-		CloudPubSubCommandSimpleState float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_COMMAND_SIMPLE_STATE"`
-
-		CloudPubSubTelemetryCPUUsage    float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_TELEMETRY_CPU_USAGE"`
-		CloudPubSubTelemetryThreads     float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_TELEMETRY_THREADS"`
-		CloudPubSubTelemetryMemory      float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_TELEMETRY_MEMORY"`
-		CloudPubSubTelemetrySimpleState float64 `redis:"telemetry.SENSOR_CLOUD_PUB_SUB_TELEMETRY_SIMPLE_STATE"`
-
-		CredentialsGeneratorCPUUsage    float64 `redis:"telemetry.SENSOR_CREDENTIALS_GENERATOR_CPU_USAGE"`
-		CredentialsGeneratorThreads     float64 `redis:"telemetry.SENSOR_CREDENTIALS_GENERATOR_THREADS"`
-		CredentialsGeneratorMemory      float64 `redis:"telemetry.SENSOR_CREDENTIALS_GENERATOR_MEMORY"`
-		CredentialsGeneratorSimpleState float64 `redis:"telemetry.SENSOR_CREDENTIALS_GENERATOR_SIMPLE_STATE"`
-
-		DBUSCPUUsage    float64 `redis:"telemetry.SENSOR_DBUS_CPU_USAGE"`
-		DBUSThreads     float64 `redis:"telemetry.SENSOR_DBUS_THREADS"`
-		DBUSMemory      float64 `redis:"telemetry.SENSOR_DBUS_MEMORY"`
-		DBUSSimpleState float64 `redis:"telemetry.SENSOR_DBUS_SIMPLE_STATE"`
-
-		Micro2WallboxCPUUsage    float64 `redis:"telemetry.SENSOR_MICRO2WALLBOX_CPU_USAGE"`
-		Micro2WallboxThreads     float64 `redis:"telemetry.SENSOR_MICRO2WALLBOX_THREADS"`
-		Micro2WallboxMemory      float64 `redis:"telemetry.SENSOR_MICRO2WALLBOX_MEMORY"`
-		Micro2WallboxSimpleState float64 `redis:"telemetry.SENSOR_MICRO2WALLBOX_SIMPLE_STATE"`
-
-		MySQLDCPUUsage    float64 `redis:"telemetry.SENSOR_MYSQLD_CPU_USAGE"`
-		MySQLDThreads     float64 `redis:"telemetry.SENSOR_MYSQLD_THREADS"`
-		MySQLDMemory      float64 `redis:"telemetry.SENSOR_MYSQLD_MEMORY"`
-		MySQLDSimpleState float64 `redis:"telemetry.SENSOR_MYSQLD_SIMPLE_STATE"`
-
-		MyWallboxCPUUsage    float64 `redis:"telemetry.SENSOR_MYWALLBOX_CPU_USAGE"`
-		MyWallboxThreads     float64 `redis:"telemetry.SENSOR_MYWALLBOX_THREADS"`
-		MyWallboxMemory      float64 `redis:"telemetry.SENSOR_MYWALLBOX_MEMORY"`
-		MyWallboxSimpleState float64 `redis:"telemetry.SENSOR_MYWALLBOX_SIMPLE_STATE"`
-
-		OCPPWallboxCPUUsage    float64 `redis:"telemetry.SENSOR_OCPPWALLBOX_CPU_USAGE"`
-		OCPPWallboxThreads     float64 `redis:"telemetry.SENSOR_OCPPWALLBOX_THREADS"`
-		OCPPWallboxMemory      float64 `redis:"telemetry.SENSOR_OCPPWALLBOX_MEMORY"`
-		OCPPWallboxSimpleState float64 `redis:"telemetry.SENSOR_OCPPWALLBOX_SIMPLE_STATE"`
-
-		OnTimeTrackCPUUsage    float64 `redis:"telemetry.SENSOR_ON_TIME_TRACK_CPU_USAGE"`
-		OnTimeTrackThreads     float64 `redis:"telemetry.SENSOR_ON_TIME_TRACK_THREADS"`
-		OnTimeTrackMemory      float64 `redis:"telemetry.SENSOR_ON_TIME_TRACK_MEMORY"`
-		OnTimeTrackSimpleState float64 `redis:"telemetry.SENSOR_ON_TIME_TRACK_SIMPLE_STATE"`
-
-		PowerManagerCPUUsage    float64 `redis:"telemetry.SENSOR_POWER_MANAGER_CPU_USAGE"`
-		PowerManagerThreads     float64 `redis:"telemetry.SENSOR_POWER_MANAGER_THREADS"`
-		PowerManagerMemory      float64 `redis:"telemetry.SENSOR_POWER_MANAGER_MEMORY"`
-		PowerManagerSimpleState float64 `redis:"telemetry.SENSOR_POWER_MANAGER_SIMPLE_STATE"`
-
-		RedisCPUUsage    float64 `redis:"telemetry.SENSOR_REDIS_CPU_USAGE"`
-		RedisThreads     float64 `redis:"telemetry.SENSOR_REDIS_THREADS"`
-		RedisMemory      float64 `redis:"telemetry.SENSOR_REDIS_MEMORY"`
-		RedisSimpleState float64 `redis:"telemetry.SENSOR_REDIS_SIMPLE_STATE"`
-
-		ResourcesMonitorCPUUsage    float64 `redis:"telemetry.SENSOR_RESOURCES_MONITOR_CPU_USAGE"`
-		ResourcesMonitorThreads     float64 `redis:"telemetry.SENSOR_RESOURCES_MONITOR_THREADS"`
-		ResourcesMonitorMemory      float64 `redis:"telemetry.SENSOR_RESOURCES_MONITOR_MEMORY"`
-		ResourcesMonitorSimpleState float64 `redis:"telemetry.SENSOR_RESOURCES_MONITOR_SIMPLE_STATE"`
-
-		ScheduleManagerCPUUsage    float64 `redis:"telemetry.SENSOR_SCHEDULE_MANAGER_CPU_USAGE"`
-		ScheduleManagerThreads     float64 `redis:"telemetry.SENSOR_SCHEDULE_MANAGER_THREADS"`
-		ScheduleManagerMemory      float64 `redis:"telemetry.SENSOR_SCHEDULE_MANAGER_MEMORY"`
-		ScheduleManagerSimpleState float64 `redis:"telemetry.SENSOR_SCHEDULE_MANAGER_SIMPLE_STATE"`
-
-		SoftwareUpdateCPUUsage    float64 `redis:"telemetry.SENSOR_SOFTWARE_UPDATE_CPU_USAGE"`
-		SoftwareUpdateThreads     float64 `redis:"telemetry.SENSOR_SOFTWARE_UPDATE_THREADS"`
-		SoftwareUpdateMemory      float64 `redis:"telemetry.SENSOR_SOFTWARE_UPDATE_MEMORY"`
-		SoftwareUpdateSimpleState float64 `redis:"telemetry.SENSOR_SOFTWARE_UPDATE_SIMPLE_STATE"`
-
-		SystemSupervisorCPUUsage    float64 `redis:"telemetry.SENSOR_SYSTEM_SUPERVISOR_CPU_USAGE"`
-		SystemSupervisorThreads     float64 `redis:"telemetry.SENSOR_SYSTEM_SUPERVISOR_THREADS"`
-		SystemSupervisorMemory      float64 `redis:"telemetry.SENSOR_SYSTEM_SUPERVISOR_MEMORY"`
-		SystemSupervisorSimpleState float64 `redis:"telemetry.SENSOR_SYSTEM_SUPERVISOR_SIMPLE_STATE"`
-
-		TelemetryServiceCPUUsage    float64 `redis:"telemetry.SENSOR_TELEMETRY_SRVC_CPU_USAGE"`
-		TelemetryServiceThreads     float64 `redis:"telemetry.SENSOR_TELEMETRY_SRVC_THREADS"`
-		TelemetryServiceMemory      float64 `redis:"telemetry.SENSOR_TELEMETRY_SRVC_MEMORY"`
-		TelemetryServiceSimpleState float64 `redis:"telemetry.SENSOR_TELEMETRY_SRVC_SIMPLE_STATE"`
-
-		WallboxCBITCPUUsage    float64 `redis:"telemetry.SENSOR_WALLBOX_CBIT_CPU_USAGE"`
-		WallboxCBITThreads     float64 `redis:"telemetry.SENSOR_WALLBOX_CBIT_THREADS"`
-		WallboxCBITMemory      float64 `redis:"telemetry.SENSOR_WALLBOX_CBIT_MEMORY"`
-		WallboxCBITSimpleState float64 `redis:"telemetry.SENSOR_WALLBOX_CBIT_SIMPLE_STATE"`
-
-		WallboxLoginCPUUsage    float64 `redis:"telemetry.SENSOR_WALLBOX_LOGIN_CPU_USAGE"`
-		WallboxLoginThreads     float64 `redis:"telemetry.SENSOR_WALLBOX_LOGIN_THREADS"`
-		WallboxLoginMemory      float64 `redis:"telemetry.SENSOR_WALLBOX_LOGIN_MEMORY"`
-		WallboxLoginSimpleState float64 `redis:"telemetry.SENSOR_WALLBOX_LOGIN_SIMPLE_STATE"`
-
-		WallboxNetworkCPUUsage    float64 `redis:"telemetry.SENSOR_WALLBOX_NETWORK_CPU_USAGE"`
-		WallboxNetworkThreads     float64 `redis:"telemetry.SENSOR_WALLBOX_NETWORK_THREADS"`
-		WallboxNetworkMemory      float64 `redis:"telemetry.SENSOR_WALLBOX_NETWORK_MEMORY"`
-		WallboxNetworkSimpleState float64 `redis:"telemetry.SENSOR_WALLBOX_NETWORK_SIMPLE_STATE"`
-
-		WallboxSMachineCPUUsage    float64 `redis:"telemetry.SENSOR_WALLBOXSMACHINE_CPU_USAGE"`
-		WallboxSMachineThreads     float64 `redis:"telemetry.SENSOR_WALLBOXSMACHINE_THREADS"`
-		WallboxSMachineMemory      float64 `redis:"telemetry.SENSOR_WALLBOXSMACHINE_MEMORY"`
-		WallboxSMachineSimpleState float64 `redis:"telemetry.SENSOR_WALLBOXSMACHINE_SIMPLE_STATE"`
-
-		WallcoAdapterCPUUsage    float64 `redis:"telemetry.SENSOR_WALLCO_ADAPTER_CPU_USAGE"`
-		WallcoAdapterThreads     float64 `redis:"telemetry.SENSOR_WALLCO_ADAPTER_THREADS"`
-		WallcoAdapterMemory      float64 `redis:"telemetry.SENSOR_WALLCO_ADAPTER_MEMORY"`
-		WallcoAdapterSimpleState float64 `redis:"telemetry.SENSOR_WALLCO_ADAPTER_SIMPLE_STATE"`
-
-		WBXChargerInfoCPUUsage    float64 `redis:"telemetry.SENSOR_WBX_CHARGER_INFO_CPU_USAGE"`
-		WBXChargerInfoThreads     float64 `redis:"telemetry.SENSOR_WBX_CHARGER_INFO_THREADS"`
-		WBXChargerInfoMemory      float64 `redis:"telemetry.SENSOR_WBX_CHARGER_INFO_MEMORY"`
-		WBXChargerInfoSimpleState float64 `redis:"telemetry.SENSOR_WBX_CHARGER_INFO_SIMPLE_STATE"`
-
-		WPASupplicantCPUUsage    float64 `redis:"telemetry.SENSOR_WPA_SUPPLICANT_CPU_USAGE"`
-		WPASupplicantThreads     float64 `redis:"telemetry.SENSOR_WPA_SUPPLICANT_THREADS"`
-		WPASupplicantMemory      float64 `redis:"telemetry.SENSOR_WPA_SUPPLICANT_MEMORY"`
-		WPASupplicantSimpleState float64 `redis:"telemetry.SENSOR_WPA_SUPPLICANT_SIMPLE_STATE"`
-
-		NonWallboxCPUUsage    float64 `redis:"telemetry.SENSOR_NON_WALLBOX_CPU_USAGE"`
-		NonWallboxThreads     float64 `redis:"telemetry.SENSOR_NON_WALLBOX_THREADS"`
-		NonWallboxMemory      float64 `redis:"telemetry.SENSOR_NON_WALLBOX_MEMORY"`
-		NonWallboxSimpleState float64 `redis:"telemetry.SENSOR_NON_WALLBOX_SIMPLE_STATE"`
-
-		AvailableMemory      float64 `redis:"telemetry.SENSOR_AVAILABLE_MEMORY"`
-		CMAFreeMemory        float64 `redis:"telemetry.SENSOR_CMAFREE_MEMORY"`
-		AvailableStorageRoot float64 `redis:"telemetry.SENSOR_AVAILABLE_STORAGE_ROOTFS"`
-		CPUTemperature       float64 `redis:"telemetry.SENSOR_CPU_TEMPERATURE"`
-		SystemUptime         float64 `redis:"telemetry.SENSOR_SYSTEM_UPTIME"`
-	}
-}
+	// Telemetry holds the values of the telemetry sensors.
+	Telemetry TelemetryValues
 
-type Wallbox struct {
-	redisClient          *redis.Client
-	sqlClient            *sqlx.DB
-	Data                 DataCache
-	ChargerType          string `db:"charger_type"`
-	telemetryOCPPStatus  int
-	telemetryOCPPUpdated time.Time
-	journalOCPPStatus    int
-	journalOCPPUpdated   time.Time
-	ocppStatusMux        sync.RWMutex
 	// HasTelemetry becomes true once we have successfully processed at least
-	// one telemetry event and mapped it into RedisTelemetry. This lets higher
+	// one telemetry event and stored it in Telemetry. This lets higher
 	// layers prefer telemetry-based values on newer firmware while keeping a
 	// fallback to legacy Redis/M2W data for older firmware.
-	HasTelemetry          bool
+	HasTelemetry bool
+	// TelemetryAt is when the last telemetry event was processed.
+	TelemetryAt time.Time
+}
+
+type Wallbox struct {
+	redisClient           *redis.Client
+	sqlClient             *sqlx.DB
+	data                  atomic.Pointer[DataCache]
+	dataMux               sync.Mutex
+	changes               changeNotifier
+	ChargerType           string `db:"charger_type"`
+	telemetryOCPPStatus   int
+	telemetryOCPPUpdated  time.Time
+	journalOCPPStatus     int
+	journalOCPPUpdated    time.Time
+	ocppStatusMux         sync.RWMutex
+	ocppJournal           *ocppJournalTracker
 	pubsub                *redis.PubSub
 	eventHandler          func(channel string, message string)
 	sessionEnergyBaseline float64
+	sessionEnergyMux      sync.Mutex
 	journalStopCh         chan struct{}
+	journalDoneCh         chan struct{}
+	journalMux            sync.Mutex
+	system                system.SystemController
 	selectedUserId        string
 	selectedUserIdMux     sync.RWMutex
+	// refresh replaces RefreshData in tests.
+	refresh func() error
+}
+
+// Endpoint is where the MySQL and Redis of a charger are reached.
+type Endpoint struct {
+	// MySQL and Redis are host:port addresses.
+	MySQL string
+	Redis string
 }
 
+// LocalEndpoint is the charger the bridge runs on.
+var LocalEndpoint = Endpoint{MySQL: "127.0.0.1:3306", Redis: "localhost:6379"}
+
+// New connects to the charger the bridge runs on.
 func New() *Wallbox {
+	w, err := Connect(LocalEndpoint, system.NewExec())
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// Connect connects to the charger at e, whose services and host sys
+// controls. It fails if the charger's MySQL cannot be reached.
+func Connect(e Endpoint, sys system.SystemController) (*Wallbox, error) {
 	var w Wallbox
 
 	var err error
-	w.sqlClient, err = sqlx.Connect("mysql", "root:fJmExsJgmKV7cq8H@tcp(127.0.0.1:3306)/wallbox")
+	w.sqlClient, err = sqlx.Connect("mysql", "root:fJmExsJgmKV7cq8H@tcp("+e.MySQL+")/wallbox")
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("connecting to MySQL at %s: %w", e.MySQL, err)
 	}
 
 	query := "select SUBSTRING_INDEX(part_number, '-', 1) AS charger_type from charger_info;"
 	w.sqlClient.Get(&w, query)
 
 	w.redisClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
+		Addr:     e.Redis,
 		Password: "",
 		DB:       0,
 	})
 
 	w.telemetryOCPPStatus = -1
 	w.journalOCPPStatus = -1
+	w.ocppJournal = newOCPPJournalTracker()
+	w.system = sys
 
-	return &w
-}
-
-func getRedisFields(obj interface{}) []string {
-	var result []string
-	val := reflect.ValueOf(obj)
-	typ := val.Type()
-
-	for i := 0; i < val.NumField(); i++ {
-		field := typ.Field(i)
-		result = append(result, field.Tag.Get("redis"))
-	}
-
-	return result
+	return &w, nil
 }
 
-func (w *Wallbox) RefreshData() {
+// RefreshData polls the Redis hashes and MySQL. On an error nothing is
+// stored, so the previous values stay in place until a poll succeeds.
+func (w *Wallbox) RefreshData() error {
 	ctx := context.Background()
 
-	stateRes := w.redisClient.HMGet(ctx, "state", getRedisFields(w.Data.RedisState)...)
+	stateRes := w.redisClient.HMGet(ctx, "state", redisStateIndex.fields...)
 	if stateRes.Err() != nil {
-		panic(stateRes.Err())
+		return fmt.Errorf("reading Redis state: %w", stateRes.Err())
 	}
 
-	if err := stateRes.Scan(&w.Data.RedisState); err != nil {
-		panic(err)
+	// Scan into copies of the current values so fields missing from Redis
+	// keep their last value, as they did before.
+	polled := *w.Snapshot()
+	if err := stateRes.Scan(&polled.RedisState); err != nil {
+		return fmt.Errorf("reading Redis state: %w", err)
 	}
 
-	m2wRes := w.redisClient.HMGet(ctx, "m2w", getRedisFields(w.Data.RedisM2W)...)
+	m2wRes := w.redisClient.HMGet(ctx, "m2w", redisM2WIndex.fields...)
 	if m2wRes.Err() != nil {
-		panic(m2wRes.Err())
+		return fmt.Errorf("reading Redis m2w: %w", m2wRes.Err())
 	}
 
-	if err := m2wRes.Scan(&w.Data.RedisM2W); err != nil {
-		panic(err)
+	if err := m2wRes.Scan(&polled.RedisM2W); err != nil {
+		return fmt.Errorf("reading Redis m2w: %w", err)
 	}
 
 	query := "SELECT " +
@@ -362,15 +188,23 @@ func (w *Wallbox) RefreshData() {
 		"    `latest_session`.`charged_range`) AS added_range," +
 		"  IF(`active_session`.`unique_id` != 0," +
 		"    `active_session`.`energy_total`," +
-		"    0) AS active_session_energy_total " +
+		"    0) AS active_session_energy_total," +
+		"  `active_session`.`unique_id` AS active_session_id " +
 		"FROM `wallbox_config`," +
 		"    `active_session`," +
 		"    `power_outage_values`," +
 		"    (SELECT * FROM `session` ORDER BY `id` DESC LIMIT 1) AS latest_session"
-	w.sqlClient.Get(&w.Data.SQL, query)
+	if err := w.sqlClient.Get(&polled.SQL, query); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("reading MySQL: %w", err)
+	}
+
+	if w.storeRefresh(&polled) {
+		w.changes.notify(SourcePoll)
+	}
 
 	// We no longer need to refresh telemetry data from Redis
 	// The telemetry data comes directly from Redis subscriptions and is stored only in memory
+	return nil
 }
 
 func (w *Wallbox) SerialNumber() string {
@@ -401,23 +235,32 @@ func (w *Wallbox) UserId() string {
 	return userId
 }
 
+// SelectedUserId returns the user the lock and events are attributed to,
+// the newest user unless one was selected. It may be called from any
+// goroutine.
 func (w *Wallbox) SelectedUserId() string {
-	if w.selectedUserId != "" {
-		return w.selectedUserId
+	w.selectedUserIdMux.RLock()
+	userId := w.selectedUserId
+	w.selectedUserIdMux.RUnlock()
+	if userId != "" {
+		return userId
 	}
 	return w.UserId()
 }
 
+// SetSelectedUserId selects the user, or clears the selection if userId is
+// empty or does not exist. It may be called from any goroutine.
 func (w *Wallbox) SetSelectedUserId(userId string) {
-	if userId == "" {
-		w.selectedUserId = ""
-		return
-	}
-	if w.userIdExists(userId) {
-		w.selectedUserId = userId
-		return
+	if userId != "" && !w.userIdExists(userId) {
+		userId = ""
 	}
-	w.selectedUserId = ""
+	w.storeSelectedUserId(userId)
+}
+
+func (w *Wallbox) storeSelectedUserId(userId string) {
+	w.selectedUserIdMux.Lock()
+	w.selectedUserId = userId
+	w.selectedUserIdMux.Unlock()
 }
 
 func (w *Wallbox) userIdExists(userId string) bool {
@@ -438,28 +281,31 @@ func (w *Wallbox) AvailableCurrent() int {
 // this is sourced from telemetry events; on older firmware it falls back to
 // the legacy m2w Redis hash.
 func (w *Wallbox) ChargingCurrentL1() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.InternalMeterCurrentL1 != 0 {
-		return w.Data.RedisTelemetry.InternalMeterCurrentL1
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorMeterCurrent[0]) != 0 {
+		return d.Telemetry.at(sensorMeterCurrent[0])
 	}
-	return w.Data.RedisM2W.Line1Current
+	return d.RedisM2W.Line1Current
 }
 
 // ChargingCurrentL2 returns the phase 2 charging current, using telemetry when
 // available and falling back to the legacy m2w Redis hash otherwise.
 func (w *Wallbox) ChargingCurrentL2() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.InternalMeterCurrentL2 != 0 {
-		return w.Data.RedisTelemetry.InternalMeterCurrentL2
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorMeterCurrent[1]) != 0 {
+		return d.Telemetry.at(sensorMeterCurrent[1])
 	}
-	return w.Data.RedisM2W.Line2Current
+	return d.RedisM2W.Line2Current
 }
 
 // ChargingCurrentL3 returns the phase 3 charging current, using telemetry when
 // available and falling back to the legacy m2w Redis hash otherwise.
 func (w *Wallbox) ChargingCurrentL3() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.InternalMeterCurrentL3 != 0 {
-		return w.Data.RedisTelemetry.InternalMeterCurrentL3
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorMeterCurrent[2]) != 0 {
+		return d.Telemetry.at(sensorMeterCurrent[2])
 	}
-	return w.Data.RedisM2W.Line3Current
+	return d.RedisM2W.Line3Current
 }
 
 // linePowerFromTelemetry derives per‑phase power from internal meter voltage
@@ -476,43 +322,46 @@ func linePowerFromTelemetry(voltage, current float64) float64 {
 // this from internal meter telemetry, otherwise we fall back to legacy m2w
 // power values.
 func (w *Wallbox) ChargingPowerL1() float64 {
-	if w.HasTelemetry &&
-		(w.Data.RedisTelemetry.InternalMeterVoltageL1 != 0 ||
-			w.Data.RedisTelemetry.InternalMeterCurrentL1 != 0) {
+	d := w.Snapshot()
+	if d.HasTelemetry &&
+		(d.Telemetry.at(sensorMeterVoltage[0]) != 0 ||
+			d.Telemetry.at(sensorMeterCurrent[0]) != 0) {
 		return linePowerFromTelemetry(
-			w.Data.RedisTelemetry.InternalMeterVoltageL1,
-			w.Data.RedisTelemetry.InternalMeterCurrentL1,
+			d.Telemetry.at(sensorMeterVoltage[0]),
+			d.Telemetry.at(sensorMeterCurrent[0]),
 		)
 	}
-	return w.Data.RedisM2W.Line1Power
+	return d.RedisM2W.Line1Power
 }
 
 // ChargingPowerL2 returns per‑phase power for L2. See ChargingPowerL1 for
 // details.
 func (w *Wallbox) ChargingPowerL2() float64 {
-	if w.HasTelemetry &&
-		(w.Data.RedisTelemetry.InternalMeterVoltageL2 != 0 ||
-			w.Data.RedisTelemetry.InternalMeterCurrentL2 != 0) {
+	d := w.Snapshot()
+	if d.HasTelemetry &&
+		(d.Telemetry.at(sensorMeterVoltage[1]) != 0 ||
+			d.Telemetry.at(sensorMeterCurrent[1]) != 0) {
 		return linePowerFromTelemetry(
-			w.Data.RedisTelemetry.InternalMeterVoltageL2,
-			w.Data.RedisTelemetry.InternalMeterCurrentL2,
+			d.Telemetry.at(sensorMeterVoltage[1]),
+			d.Telemetry.at(sensorMeterCurrent[1]),
 		)
 	}
-	return w.Data.RedisM2W.Line2Power
+	return d.RedisM2W.Line2Power
 }
 
 // ChargingPowerL3 returns per‑phase power for L3. See ChargingPowerL1 for
 // details.
 func (w *Wallbox) ChargingPowerL3() float64 {
-	if w.HasTelemetry &&
-		(w.Data.RedisTelemetry.InternalMeterVoltageL3 != 0 ||
-			w.Data.RedisTelemetry.InternalMeterCurrentL3 != 0) {
+	d := w.Snapshot()
+	if d.HasTelemetry &&
+		(d.Telemetry.at(sensorMeterVoltage[2]) != 0 ||
+			d.Telemetry.at(sensorMeterCurrent[2]) != 0) {
 		return linePowerFromTelemetry(
-			w.Data.RedisTelemetry.InternalMeterVoltageL3,
-			w.Data.RedisTelemetry.InternalMeterCurrentL3,
+			d.Telemetry.at(sensorMeterVoltage[2]),
+			d.Telemetry.at(sensorMeterCurrent[2]),
 		)
 	}
-	return w.Data.RedisM2W.Line3Power
+	return d.RedisM2W.Line3Power
 }
 
 // ChargingPower returns total charging power across all phases.
@@ -523,28 +372,31 @@ func (w *Wallbox) ChargingPower() float64 {
 // TemperatureL1 returns the line 1 temperature, preferring telemetry values
 // when available and otherwise falling back to legacy m2w data.
 func (w *Wallbox) TemperatureL1() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.TempL1 != 0 {
-		return w.Data.RedisTelemetry.TempL1
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorTemp[0]) != 0 {
+		return d.Telemetry.at(sensorTemp[0])
 	}
-	return w.Data.RedisM2W.TempL1
+	return d.RedisM2W.TempL1
 }
 
 // TemperatureL2 returns the line 2 temperature, preferring telemetry values
 // when available and otherwise falling back to legacy m2w data.
 func (w *Wallbox) TemperatureL2() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.TempL2 != 0 {
-		return w.Data.RedisTelemetry.TempL2
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorTemp[1]) != 0 {
+		return d.Telemetry.at(sensorTemp[1])
 	}
-	return w.Data.RedisM2W.TempL2
+	return d.RedisM2W.TempL2
 }
 
 // TemperatureL3 returns the line 3 temperature, preferring telemetry values
 // when available and otherwise falling back to legacy m2w data.
 func (w *Wallbox) TemperatureL3() float64 {
-	if w.HasTelemetry && w.Data.RedisTelemetry.TempL3 != 0 {
-		return w.Data.RedisTelemetry.TempL3
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorTemp[2]) != 0 {
+		return d.Telemetry.at(sensorTemp[2])
 	}
-	return w.Data.RedisM2W.TempL3
+	return d.RedisM2W.TempL3
 }
 
 func sendToPosixQueue(path, data string) {
@@ -558,9 +410,24 @@ func sendToPosixQueue(path, data string) {
 	mqClose(mq)
 }
 
+// needsChange refreshes the data and reports whether the value current reads
+// from it differs from want. The charger may have been changed from the app
+// or the RFID reader since the last poll, so it never compares against older
+// data; if refreshing fails, the change is made anyway.
+func (w *Wallbox) needsChange(current func(d *DataCache) int, want int) bool {
+	refresh := w.RefreshData
+	if w.refresh != nil {
+		refresh = w.refresh
+	}
+	if err := refresh(); err != nil {
+		logger.Warnf("Refreshing before a command: %v", err)
+		return true
+	}
+	return current(w.Snapshot()) != want
+}
+
 func (w *Wallbox) SetLocked(lock int, userIdOpt ...string) {
-	w.RefreshData()
-	if lock == w.Data.SQL.Lock {
+	if !w.needsChange(func(d *DataCache) int { return d.SQL.Lock }, lock) {
 		return
 	}
 	if w.ChargerType == "CPB1" {
@@ -584,8 +451,7 @@ func (w *Wallbox) SetLocked(lock int, userIdOpt ...string) {
 }
 
 func (w *Wallbox) SetChargingEnable(enable int) {
-	w.RefreshData()
-	if enable == w.Data.SQL.ChargingEnable {
+	if !w.needsChange(func(d *DataCache) int { return d.SQL.ChargingEnable }, enable) {
 		return
 	}
 	if enable == 1 {
@@ -604,59 +470,90 @@ func (w *Wallbox) SetHaloBrightness(brightness int) {
 }
 
 func (w *Wallbox) CableConnected() int {
-	if w.HasTelemetry {
-		status := int(w.Data.RedisTelemetry.ControlPilotStatus)
+	d := w.Snapshot()
+	if d.HasTelemetry {
+		status := int(d.Telemetry.at(sensorControlPilotStatus))
 		if status != 0 && isTelemetryCableConnected(status) {
 			return 1
 		}
 		return 0
 	}
 
-	if w.Data.RedisM2W.ChargerStatus == 0 || w.Data.RedisM2W.ChargerStatus == 6 {
+	if d.RedisM2W.ChargerStatus == 0 || d.RedisM2W.ChargerStatus == 6 {
 		return 0
 	}
 	return 1
 }
 
-func (w *Wallbox) EffectiveStatus() string {
-	if w.HasTelemetry && w.Data.RedisTelemetry.StateMachine != 0 {
-		return describeTelemetryStatus(int(w.Data.RedisTelemetry.StateMachine))
+// StatusDetail explains EffectiveStatus with the raw codes it was derived
+// from.
+type StatusDetail struct {
+	Status string
+	// Source is "telemetry" for the telemetry state machine and "m2w" for
+	// the legacy charger status.
+	Source        string
+	StateMachine  int
+	ChargerStatus int
+	SessionState  int
+	// SessionOverride is set when the session state replaced ChargerStatus.
+	SessionOverride bool
+}
+
+func (w *Wallbox) StatusDetail() StatusDetail {
+	d := w.Snapshot()
+	detail := StatusDetail{
+		StateMachine:  int(d.Telemetry.at(sensorStateMachine)),
+		ChargerStatus: d.RedisM2W.ChargerStatus,
+		SessionState:  d.RedisState.SessionState,
+	}
+	if d.HasTelemetry && d.Telemetry.at(sensorStateMachine) != 0 {
+		detail.Source = "telemetry"
+		detail.Status = describeTelemetryStatus(detail.StateMachine)
+		return detail
 	}
 
-	tmsStatus := w.Data.RedisM2W.ChargerStatus
-	state := w.Data.RedisState.SessionState
+	detail.Source = "m2w"
+	tmsStatus := d.RedisM2W.ChargerStatus
+	state := d.RedisState.SessionState
 
 	if override, ok := stateOverrides[state]; ok {
 		tmsStatus = override
+		detail.SessionOverride = true
 	}
 
+	detail.Status = "Unknown"
 	if tmsStatus >= 0 && tmsStatus < len(wallboxStatusCodes) {
-		return wallboxStatusCodes[tmsStatus]
+		detail.Status = wallboxStatusCodes[tmsStatus]
 	}
+	return detail
+}
 
-	return "Unknown"
+func (w *Wallbox) EffectiveStatus() string {
+	return w.StatusDetail().Status
 }
 
 func (w *Wallbox) ControlPilotStatus() string {
-	if w.HasTelemetry && w.Data.RedisTelemetry.ControlPilotStatus != 0 {
-		status := int(w.Data.RedisTelemetry.ControlPilotStatus)
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorControlPilotStatus) != 0 {
+		status := int(d.Telemetry.at(sensorControlPilotStatus))
 		if desc, ok := telemetryControlPilotStates[status]; ok {
 			return fmt.Sprintf("%d: %s", status, desc)
 		}
 		return fmt.Sprintf("%d: %s", status, describeTelemetryStatus(status))
 	}
 
-	if desc, ok := controlPilotStates[w.Data.RedisState.ControlPilot]; ok {
-		return fmt.Sprintf("%d: %s", w.Data.RedisState.ControlPilot, desc)
+	if desc, ok := controlPilotStates[d.RedisState.ControlPilot]; ok {
+		return fmt.Sprintf("%d: %s", d.RedisState.ControlPilot, desc)
 	}
-	return fmt.Sprintf("%d: Unknown", w.Data.RedisState.ControlPilot)
+	return fmt.Sprintf("%d: Unknown", d.RedisState.ControlPilot)
 }
 
 func (w *Wallbox) ControlPilotCode() int {
-	if w.HasTelemetry && w.Data.RedisTelemetry.ControlPilotStatus != 0 {
-		return int(w.Data.RedisTelemetry.ControlPilotStatus)
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorControlPilotStatus) != 0 {
+		return int(d.Telemetry.at(sensorControlPilotStatus))
 	}
-	return w.Data.RedisState.ControlPilot
+	return d.RedisState.ControlPilot
 }
 
 func (w *Wallbox) ControlPilotLetter() string {
@@ -671,14 +568,32 @@ func (w *Wallbox) IsChargingPilot() bool {
 	return isTelemetryCharging(w.ControlPilotCode())
 }
 
-func (w *Wallbox) OCPPStatusCode() int {
-	if code, ok := w.getJournalOCPPStatus(); ok {
-		return code
+// OCPPStatusDetail explains OCPPStatusCode: which source it was taken from
+// and when that source reported it.
+type OCPPStatusDetail struct {
+	Code int
+	// Source is "journal" for the ocppwallbox journal, "session" for Redis
+	// session events and "telemetry" for the telemetry sensor.
+	Source string
+	// Updated is when the source reported Code; zero if it never did.
+	Updated time.Time
+}
+
+// OCPPStatusDetail returns the OCPP status from the freshest source: the
+// journal, then session events, then telemetry.
+func (w *Wallbox) OCPPStatusDetail() OCPPStatusDetail {
+	if code, updated, ok := w.getJournalOCPPStatus(); ok {
+		return OCPPStatusDetail{Code: code, Source: "journal", Updated: updated}
 	}
-	if code, ok := w.getTelemetryOCPPStatus(); ok {
-		return code
+	if code, updated, ok := w.getTelemetryOCPPStatus(); ok {
+		return OCPPStatusDetail{Code: code, Source: "session", Updated: updated}
 	}
-	return int(w.Data.RedisTelemetry.OCPPStatus)
+	d := w.Snapshot()
+	return OCPPStatusDetail{Code: int(d.Telemetry.at(sensorOCPPStatus)), Source: "telemetry", Updated: d.TelemetryAt}
+}
+
+func (w *Wallbox) OCPPStatusCode() int {
+	return w.OCPPStatusDetail().Code
 }
 
 func (w *Wallbox) OCPPStatusDescription() string {
@@ -706,6 +621,11 @@ func (w *Wallbox) OCPPOnlineCode() int {
 	return val
 }
 
+// OCPPOnlineDescription describes the OCPPOnlineCode value.
+func (w *Wallbox) OCPPOnlineDescription() string {
+	return describeOCPPOnlineCode(w.OCPPOnlineCode())
+}
+
 // OCPPEnabled reports whether OCPP is enabled (any non-zero online flag).
 func (w *Wallbox) OCPPEnabled() string {
 	if code := w.OCPPOnlineCode(); code > 0 {
@@ -723,81 +643,55 @@ func (w *Wallbox) OCPPConnected() string {
 }
 
 func (w *Wallbox) ConnectionType() string {
-	if !w.HasTelemetry || w.Data.RedisTelemetry.ConnectionType == 0 {
+	d := w.Snapshot()
+	if !d.HasTelemetry || d.Telemetry.at(sensorConnectionType) == 0 {
 		return "Unknown"
 	}
-	code := int(w.Data.RedisTelemetry.ConnectionType)
-	return describeConnectionType(code)
+	return w.describeTelemetry("SENSOR_CONNECTION_TYPE")
 }
 
 func (w *Wallbox) ConnectivityStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	code := int(w.Data.RedisTelemetry.ConnectivityStatus)
-	return describeConnectivityStatus(code)
+	return w.describeTelemetry("SENSOR_CONNECTIVITY_STATUS")
 }
 
 func (w *Wallbox) ControlMode() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	code := int(w.Data.RedisTelemetry.ControlMode)
-	return describeControlMode(code)
+	return w.describeTelemetry("SENSOR_CONTROL_MODE")
 }
 
 func (w *Wallbox) ScheduleStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describeScheduleStatus(int(w.Data.RedisTelemetry.ScheduleStatus))
+	return w.describeTelemetry("SENSOR_SCHEDULE_STATUS")
 }
 
 func (w *Wallbox) EcosmartStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describeEcosmartStatus(int(w.Data.RedisTelemetry.EcosmartStatus))
+	return w.describeTelemetry("SENSOR_ECOSMART_STATUS")
 }
 
 func (w *Wallbox) PowerBoostStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describePowerBoostStatus(int(w.Data.RedisTelemetry.PowerboostStatus))
+	return w.describeTelemetry("SENSOR_DCA_POWERBOOST_STATUS")
 }
 
 func (w *Wallbox) PowerSharingStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describePowerSharingStatus(int(w.Data.RedisTelemetry.PowerSharingStatus))
+	return w.describeTelemetry("SENSOR_POWER_SHARING_STATUS")
 }
 
 func (w *Wallbox) MIDStatus() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describeMIDStatus(int(w.Data.RedisTelemetry.MidStatus))
+	return w.describeTelemetry("SENSOR_MID_STATUS")
 }
 
 func (w *Wallbox) PowerRelayCommand() string {
-	if !w.HasTelemetry {
-		return "Unknown"
-	}
-	return describePowerRelayCommand(int(w.Data.RedisTelemetry.PowerRelayManagementCommand))
+	return w.describeTelemetry("SENSOR_POWER_RELAY_MANAGEMENT_COMMAND")
 }
 
-func (w *Wallbox) getTelemetryOCPPStatus() (int, bool) {
+func (w *Wallbox) getTelemetryOCPPStatus() (int, time.Time, bool) {
 	w.ocppStatusMux.RLock()
 	code := w.telemetryOCPPStatus
 	ts := w.telemetryOCPPUpdated
 	w.ocppStatusMux.RUnlock()
 
 	if code >= 0 && time.Since(ts) < 10*time.Minute {
-		return code, true
+		return code, ts, true
 	}
-	return 0, false
+	return 0, time.Time{}, false
 }
 
 func (w *Wallbox) SetJournalOCPPStatus(code int) {
@@ -807,41 +701,44 @@ func (w *Wallbox) SetJournalOCPPStatus(code int) {
 	w.ocppStatusMux.Unlock()
 }
 
-func (w *Wallbox) getJournalOCPPStatus() (int, bool) {
+func (w *Wallbox) getJournalOCPPStatus() (int, time.Time, bool) {
 	w.ocppStatusMux.RLock()
 	code := w.journalOCPPStatus
 	ts := w.journalOCPPUpdated
 	w.ocppStatusMux.RUnlock()
 
 	if code >= 0 && time.Since(ts) < 10*time.Minute {
-		return code, true
+		return code, ts, true
 	}
-	return 0, false
+	return 0, time.Time{}, false
 }
 
 func (w *Wallbox) StateMachineState() string {
-	if w.HasTelemetry && w.Data.RedisTelemetry.StateMachine != 0 {
-		status := int(w.Data.RedisTelemetry.StateMachine)
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorStateMachine) != 0 {
+		status := int(d.Telemetry.at(sensorStateMachine))
 		return fmt.Sprintf("%d: %s", status, describeTelemetryStatus(status))
 	}
 
-	if desc, ok := stateMachineStates[w.Data.RedisState.SessionState]; ok {
-		return fmt.Sprintf("%d: %s", w.Data.RedisState.SessionState, desc)
+	if desc, ok := stateMachineStates[d.RedisState.SessionState]; ok {
+		return fmt.Sprintf("%d: %s", d.RedisState.SessionState, desc)
 	}
 
-	return fmt.Sprintf("%d: Unknown", w.Data.RedisState.SessionState)
+	return fmt.Sprintf("%d: Unknown", d.RedisState.SessionState)
 }
 
 func (w *Wallbox) ChargingEnable() int {
-	if w.HasTelemetry && w.Data.RedisTelemetry.ChargingEnable != 0 {
-		return int(w.Data.RedisTelemetry.ChargingEnable)
+	d := w.Snapshot()
+	if d.HasTelemetry && d.Telemetry.at(sensorChargingEnable) != 0 {
+		return int(d.Telemetry.at(sensorChargingEnable))
 	}
-	return w.Data.SQL.ChargingEnable
+	return d.SQL.ChargingEnable
 }
 
 func (w *Wallbox) S2Open() int {
-	if w.HasTelemetry {
-		status := int(w.Data.RedisTelemetry.ControlPilotStatus)
+	d := w.Snapshot()
+	if d.HasTelemetry {
+		status := int(d.Telemetry.at(sensorControlPilotStatus))
 		if status != 0 {
 			if describeTelemetryStatus(status) == "Charging" {
 				return 0
@@ -850,34 +747,70 @@ func (w *Wallbox) S2Open() int {
 		}
 	}
 
-	return w.Data.RedisState.S2open
+	return d.RedisState.S2open
 }
 
-func (w *Wallbox) AddedEnergy() float64 {
-	if w.Data.SQL.ActiveSessionEnergyTotal > 0 {
-		return w.Data.SQL.ActiveSessionEnergyTotal
+// AddedEnergyDetail explains AddedEnergy.
+type AddedEnergyDetail struct {
+	Energy float64
+	// Source is "session" for the active session in MySQL, "meter" for the
+	// internal meter minus Baseline and "schedule" for the schedule energy.
+	Source string
+	// SessionID is the active session, zero if there is none.
+	SessionID int64
+	// Meter is the internal meter reading and Baseline the reading at the
+	// start of the session, both only set for the "meter" source.
+	Meter    float64
+	Baseline float64
+}
+
+func (w *Wallbox) AddedEnergyDetail() AddedEnergyDetail {
+	d := w.Snapshot()
+	if d.SQL.ActiveSessionEnergyTotal > 0 {
+		return AddedEnergyDetail{Energy: d.SQL.ActiveSessionEnergyTotal, Source: "session", SessionID: d.SQL.ActiveSessionID}
 	}
 
-	if w.HasTelemetry && w.Data.RedisTelemetry.InternalMeterEnergy != 0 {
-		status := int(w.Data.RedisTelemetry.StateMachine)
-		current := w.Data.RedisTelemetry.InternalMeterEnergy
+	if d.HasTelemetry && d.Telemetry.at(sensorMeterEnergy) != 0 {
+		status := int(d.Telemetry.at(sensorStateMachine))
+		current := d.Telemetry.at(sensorMeterEnergy)
 
+		w.sessionEnergyMux.Lock()
+		defer w.sessionEnergyMux.Unlock()
+
+		detail := AddedEnergyDetail{Source: "meter", SessionID: d.SQL.ActiveSessionID, Meter: current}
 		if !isChargingTelemetryStatus(status) && current > 0 {
 			w.sessionEnergyBaseline = current
-			return 0
+			detail.Baseline = current
+			return detail
 		}
 
 		if w.sessionEnergyBaseline == 0 {
 			w.sessionEnergyBaseline = current
 		}
 
-		delta := current - w.sessionEnergyBaseline
-		if delta < 0 {
-			return 0
+		detail.Baseline = w.sessionEnergyBaseline
+		if delta := current - w.sessionEnergyBaseline; delta > 0 {
+			detail.Energy = delta
 		}
-		return delta
+		return detail
 	}
-	return w.Data.RedisState.ScheduleEnergy
+	return AddedEnergyDetail{Energy: d.RedisState.ScheduleEnergy, Source: "schedule", SessionID: d.SQL.ActiveSessionID}
+}
+
+func (w *Wallbox) AddedEnergy() float64 {
+	return w.AddedEnergyDetail().Energy
+}
+
+// SetSystemController replaces the controller used to follow the OCPP
+// journal and to heal services. It must be called before
+// StartOCPPJournalWatcher.
+func (w *Wallbox) SetSystemController(sys system.SystemController) {
+	w.system = sys
+}
+
+// System returns the controller for the charger's services and host.
+func (w *Wallbox) System() system.SystemController {
+	return w.system
 }
 
 func (w *Wallbox) SetEventHandler(handler func(channel string, message string)) {
@@ -921,86 +854,109 @@ func (w *Wallbox) StopRedisSubscriptions() {
 }
 
 // StartOCPPJournalWatcher spawns a background goroutine that tails the
-// ocppwallbox journald stream and extracts OCPP StatusNotification "status"
-// values (Available, Charging, SuspendedEV, etc). These are mapped to
-// numeric OCPP status codes and fed into SetJournalOCPPStatus, which is
-// preferred by OCPPStatusCode over session/telemetry-based fallbacks.
+// ocppwallbox journald stream and decodes the OCPP-J frames it logs.
+// StatusNotification "status" values (Available, Charging, SuspendedEV, etc)
+// are mapped to numeric OCPP status codes and fed into SetJournalOCPPStatus,
+// which is preferred by OCPPStatusCode over session/telemetry-based
+// fallbacks. All other frames update the state returned by OCPPJournal.
 func (w *Wallbox) StartOCPPJournalWatcher() {
+	w.journalMux.Lock()
+	defer w.journalMux.Unlock()
+
 	// Avoid starting multiple watchers if called more than once.
 	if w.journalStopCh != nil {
 		return
 	}
 
 	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
 	w.journalStopCh = stopCh
+	w.journalDoneCh = doneCh
 
 	go func() {
-		defer func() {
-			// Best-effort cleanup of the child process if we managed to start it.
-			w.journalStopCh = nil
-		}()
-
-		cmd := exec.Command("journalctl",
-			"-u", "ocppwallbox.service",
-			"-f",      // follow new entries
-			"-n", "0", // do not replay historical logs
-			"-o", "cat", // message only, no metadata
-			"-q", // quiet
-		)
+		defer close(doneCh)
 
-		stdout, err := cmd.StdoutPipe()
+		journal, err := w.system.FollowJournal("ocppwallbox.service")
 		if err != nil {
-			log.Printf("OCPP journal: failed to open stdout: %v", err)
+			ocppLogger.Errorf("Failed to follow the ocppwallbox.service journal: %v", err)
 			return
 		}
 
-		if err := cmd.Start(); err != nil {
-			log.Printf("OCPP journal: failed to start journalctl: %v", err)
-			return
-		}
-		defer func() {
-			_ = cmd.Process.Kill()
-			_, _ = cmd.Process.Wait()
-		}()
-
-		scanner := bufio.NewScanner(stdout)
-		for {
+		// Closing the stream unblocks the scanner when we are asked to stop.
+		scanDone := make(chan struct{})
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
 			select {
 			case <-stopCh:
-				return
-			default:
-			}
-
-			if !scanner.Scan() {
-				if err := scanner.Err(); err != nil {
-					log.Printf("OCPP journal: scanner error: %v", err)
-				}
-				return
-			}
-
-			line := scanner.Text()
-			status, ok := parseOCPPStatusFromLogLine(line)
-			if !ok {
-				continue
+			case <-scanDone:
 			}
+			_ = journal.Close()
+		}()
 
-			if code, found := LookupOCPPStatusCode(status); found {
-				w.SetJournalOCPPStatus(code)
+		scanner := bufio.NewScanner(journal)
+		for scanner.Scan() {
+			w.processOCPPJournalLine(scanner.Text())
+		}
+		close(scanDone)
+		<-closed
+
+		select {
+		case <-stopCh:
+		default:
+			if err := scanner.Err(); err != nil {
+				ocppLogger.Errorf("Journal scanner error: %v", err)
 			} else {
-				log.Printf("OCPP journal: unknown StatusNotification status %q in line: %s", status, line)
+				ocppLogger.Warnf("journalctl exited")
 			}
 		}
 	}()
 }
 
+// processOCPPJournalLine feeds one ocppwallbox journald line into the OCPP
+// frame tracker and, for StatusNotification requests, the journal OCPP status.
+func (w *Wallbox) processOCPPJournalLine(line string) {
+	if frame, ok := parseOCPPFrameFromLogLine(line); ok {
+		at, ok := parseOCPPStackTime(line)
+		if !ok {
+			at = time.Now()
+		}
+		w.ocppJournal.handleFrame(frame, at)
+		defer w.changes.notify(SourceJournal)
+	}
+
+	status, ok := parseOCPPStatusFromLogLine(line)
+	if !ok {
+		return
+	}
+
+	if code, found := LookupOCPPStatusCode(status); found {
+		w.SetJournalOCPPStatus(code)
+		w.changes.notify(SourceJournal)
+	} else {
+		ocppLogger.Warnf("Unknown StatusNotification status %q in journal line: %s", status, line)
+	}
+}
+
+// OCPPJournal returns what the journal watcher has learned from the OCPP-J
+// frames seen so far (transaction, heartbeat, errors, backend latency).
+func (w *Wallbox) OCPPJournal() OCPPJournalState {
+	return w.ocppJournal.State()
+}
+
 // StopOCPPJournalWatcher signals the background journal watcher (if any) to
-// stop and lets the goroutine tear down its journalctl process.
+// stop and waits for the goroutine to tear down its journal stream.
 func (w *Wallbox) StopOCPPJournalWatcher() {
-	if w.journalStopCh == nil {
+	w.journalMux.Lock()
+	stopCh, doneCh := w.journalStopCh, w.journalDoneCh
+	w.journalStopCh, w.journalDoneCh = nil, nil
+	w.journalMux.Unlock()
+
+	if stopCh == nil {
 		return
 	}
-	close(w.journalStopCh)
-	w.journalStopCh = nil
+	close(stopCh)
+	<-doneCh
 }
 
 // StartTimeConstrRedisSubscriptions starts Redis subscriptions and automatically stops them after the specified duration
@@ -1009,7 +965,7 @@ func (w *Wallbox) StartTimeConstrainedRedisSubscriptions(duration time.Duration)
 
 	// Set up a timer to stop the subscription after the specified duration
 	time.AfterFunc(duration, func() {
-		log.Printf("Subscription time limit of %v reached. Stopping subscriptions...", duration)
+		logger.Infof("Subscription time limit of %v reached. Stopping subscriptions...", duration)
 		w.StopRedisSubscriptions()
 	})
 }
@@ -1059,55 +1015,42 @@ type ChargerStatusEvent struct {
 	} `json:"header"`
 }
 
-// ProcessTelemetryEvent processes telemetry events and updates the RedisTelemetry struct
+// ProcessTelemetryEvent stores the sensor values of a telemetry event.
 func (w *Wallbox) ProcessTelemetryEvent(payload string) {
 	var event TelemetryEvent
 	err := json.Unmarshal([]byte(payload), &event)
 	if err != nil {
-		log.Printf("Error unmarshalling telemetry event: %v", err)
+		logger.Warnf("Error unmarshalling telemetry event: %v", err)
 		return
 	}
 
-	// Process each sensor in the event
-	for _, sensor := range event.Body.Sensors {
-		// Directly update the RedisTelemetry struct based on the sensor ID
-		w.updateTelemetryField(sensor.ID, sensor.Value)
-	}
+	// Apply the whole event as one update, so readers never see half of it
+	w.update(func(d *DataCache) {
+		d.Telemetry = d.Telemetry.clone()
+		for _, sensor := range event.Body.Sensors {
+			updateTelemetryField(d, sensor.ID, sensor.Value)
+		}
+		d.TelemetryAt = time.Now()
+	})
+	w.changes.notify(SourceTelemetry)
 }
 
-// updateTelemetryField updates a specific field in the RedisTelemetry struct by sensor ID
-func (w *Wallbox) updateTelemetryField(sensorID string, value float64) {
-	// Use reflection to update the appropriate field in the RedisTelemetry struct
-	v := reflect.ValueOf(&w.Data.RedisTelemetry).Elem()
-	t := v.Type()
+// updateTelemetryField stores the value of a sensor in d, whose Telemetry
+// must have been cloned.
+func updateTelemetryField(d *DataCache, sensorID string, value float64) {
+	// Mark that we have seen at least one telemetry sample so higher‑level
+	// code can choose telemetry-backed values.
+	d.HasTelemetry = true
 
-	// Iterate through struct fields to find the matching one
-	for i := 0; i < v.NumField(); i++ {
-		field := t.Field(i)
-		redisTag := field.Tag.Get("redis")
-
-		// Check if this field's redis tag matches our telemetry key
-		if redisTag == "telemetry."+sensorID {
-			// Mark that we have seen at least one mapped telemetry sample so
-			// higher‑level code can choose telemetry-backed values.
-			w.HasTelemetry = true
-			// Make sure the field is settable
-			if v.Field(i).CanSet() {
-				v.Field(i).SetFloat(value)
-			}
-			return
-		}
+	if d.Telemetry.set(sensorID, value) {
+		logger.Infof("New telemetry sensor without catalogue entry: %s", sensorID)
 	}
-
-	// If we get here, we didn't find a matching field (might be a new sensor we're not tracking yet)
-	// We could log this for debugging purposes
-	log.Printf("No matching struct field found for sensor ID: %s", sensorID)
 }
 
 func (w *Wallbox) ProcessSessionUpdateEvent(payload string) {
 	var event SessionUpdateEvent
 	if err := json.Unmarshal([]byte(payload), &event); err != nil {
-		log.Printf("Error unmarshalling session event: %v", err)
+		logger.Warnf("Error unmarshalling session event: %v", err)
 		return
 	}
 
@@ -1122,20 +1065,21 @@ func (w *Wallbox) ProcessSessionUpdateEvent(payload string) {
 
 	if code, ok := ocppCodeFromSessionState(state); ok {
 		w.SetTelemetryOCPPStatus(code)
+		w.changes.notify(SourceSession)
 	} else {
-		log.Printf("Unmapped session state for OCPP status: %s", state)
+		logger.Debugf("Unmapped session state for OCPP status: %s", state)
 	}
 }
 
 func (w *Wallbox) ProcessChargerStatusEvent(payload string) {
 	var event ChargerStatusEvent
 	if err := json.Unmarshal([]byte(payload), &event); err != nil {
-		log.Printf("Error unmarshalling charger status event: %v", err)
+		logger.Warnf("Error unmarshalling charger status event: %v", err)
 		return
 	}
 
 	if err := w.redisClient.Set(context.Background(), "bridge:last_ocpp_status", payload, 0).Err(); err != nil {
-		log.Printf("Failed to cache last OCPP status event: %v", err)
+		logger.Errorf("Failed to cache last OCPP status event: %v", err)
 	}
 
 	// We still consume the event for other telemetry fields and to cache the payload,
@@ -1143,27 +1087,6 @@ func (w *Wallbox) ProcessChargerStatusEvent(payload string) {
 	// session events provide a fresher, more accurate view of the connector state.
 }
 
-var statusNotificationStatusRe = regexp.MustCompile(`status"\s*:\s*"([^"]+)"`)
-
-// parseOCPPStatusFromLogLine extracts the OCPP StatusNotification "status" field
-// from an ocppwallbox journald line. It returns the status string (e.g. "Available")
-// and true on success, or ""/false if the line does not contain a parsable
-// StatusNotification payload.
-func parseOCPPStatusFromLogLine(line string) (string, bool) {
-	if !strings.Contains(line, "StatusNotification") {
-		return "", false
-	}
-	matches := statusNotificationStatusRe.FindStringSubmatch(line)
-	if len(matches) < 2 {
-		return "", false
-	}
-	status := strings.TrimSpace(matches[1])
-	if status == "" {
-		return "", false
-	}
-	return status, true
-}
-
 func ocppCodeFromSessionState(state string) (int, bool) {
 	normalized := normalizeSessionState(state)
 	switch normalized {
@@ -1213,7 +1136,7 @@ func normalizeSessionState(state string) string {
 func (w *Wallbox) GetAllUserIds() []string {
 	rows, err := w.sqlClient.Query("SELECT user_id FROM users WHERE user_id != 1 ORDER BY user_id DESC")
 	if err != nil {
-		log.Printf("GetAllUserIds: query error: %v", err)
+		logger.Errorf("GetAllUserIds: query error: %v", err)
 		return nil
 	}
 	defer rows.Close()
@@ -1222,14 +1145,14 @@ func (w *Wallbox) GetAllUserIds() []string {
 	for rows.Next() {
 		var id string
 		if err := rows.Scan(&id); err != nil {
-			log.Printf("GetAllUserIds: scan error: %v", err)
+			logger.Errorf("GetAllUserIds: scan error: %v", err)
 			return nil
 		}
 		ids = append(ids, id)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("GetAllUserIds: rows iteration error: %v", err)
+		logger.Errorf("GetAllUserIds: rows iteration error: %v", err)
 		return nil
 	}
 
@@ -241,114 +241,14 @@ func ocppStatusIndicatesDisconnect(code int) bool {
 	return ocppProblemStates[code]
 }
 
-// Connection type / connectivity / control mode mappings are derived from
-// observed Wallbox telemetry. Unknown codes fall back to "Unknown (<code>)".
-var connectionTypeDescriptions = map[int]string{
-	0: "Unknown",
-	1: "Wi-Fi",
-	2: "Ethernet",
-	3: "GSM",
-}
-
-func describeConnectionType(code int) string {
-	if desc, ok := connectionTypeDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("Unknown (%d)", code)
-}
-
-var connectivityStatusDescriptions = map[int]string{
-	0: "Unknown",
-	1: "Online",
-	2: "Degraded",
-	3: "Offline",
-}
-
-func describeConnectivityStatus(code int) string {
-	if desc, ok := connectivityStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("%d", code)
-}
-
-var controlModeDescriptions = map[int]string{
-	0: "Unknown",
-	1: "Local",
-	2: "Remote/OCPP",
-	3: "Smart/Managed",
-}
-
-func describeControlMode(code int) string {
-	if desc, ok := controlModeDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("%d", code)
-}
-
-var scheduleStatusDescriptions = map[int]string{
-	0: "Inactive",
-}
-
-func describeScheduleStatus(code int) string {
-	if desc, ok := scheduleStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("Unknown (%d)", code)
-}
-
-var ecosmartStatusDescriptions = map[int]string{
-	0: "Off",
-}
-
-func describeEcosmartStatus(code int) string {
-	if desc, ok := ecosmartStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("Unknown (%d)", code)
-}
-
-var powerBoostStatusDescriptions = map[int]string{
-	0: "Off",
-	2: "Active", // observed
-}
-
-func describePowerBoostStatus(code int) string {
-	if desc, ok := powerBoostStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("%d", code)
-}
-
-var powerSharingStatusDescriptions = map[int]string{
-	0: "Off/Not sharing",
-}
-
-func describePowerSharingStatus(code int) string {
-	if desc, ok := powerSharingStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("Unknown (%d)", code)
-}
-
-var midStatusDescriptions = map[int]string{
-	0: "Unknown",
-	1: "Active", // observed
-}
-
-func describeMIDStatus(code int) string {
-	if desc, ok := midStatusDescriptions[code]; ok {
-		return desc
-	}
-	return fmt.Sprintf("Unknown (%d)", code)
-}
-
-var powerRelayCommandDescriptions = map[int]string{
-	0: "Idle",
-}
-
-func describePowerRelayCommand(code int) string {
-	if desc, ok := powerRelayCommandDescriptions[code]; ok {
-		return desc
+func describeOCPPOnlineCode(code int) string {
+	switch {
+	case code < 0:
+		return "online flag unavailable"
+	case code == 0:
+		return "disabled"
+	case code == 4:
+		return "connected"
 	}
-	return fmt.Sprintf("Unknown (%d)", code)
+	return fmt.Sprintf("backend unreachable (online flag %d)", code)
 }
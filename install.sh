@@ -77,9 +77,8 @@ chmod +x ~/mqtt-bridge/bridge
 
 # Create config if it doesn't exist
 if [ ! -e "$INI_FILE" ]; then
-    echo "No configuration found, please provide it now"
-    cd ~/mqtt-bridge/
-    ./bridge --config
+    echo "No configuration found, please provide it now in the web form printed below"
+    ~/mqtt-bridge/bridge --config "$INI_FILE"
 fi
 
 # Optional: enable diagnostic/debug sensors in Home Assistant
@@ -208,6 +207,7 @@ Restart=always
 RestartSec=1
 User=root
 ExecStart=/home/root/mqtt-bridge/bridge /home/root/mqtt-bridge/bridge.ini
+ExecReload=/bin/kill -HUP \$MAINPID
 
 [Install]
 WantedBy=multi-user.target"
@@ -7,13 +7,5 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		panic("Usage: ./bridge --config or ./bridge bridge.ini")
-	}
-	firstArgument := os.Args[1]
-	if firstArgument == "--config" {
-		bridge.RunTuiSetup()
-	} else {
-		bridge.RunBridge(firstArgument)
-	}
+	os.Exit(bridge.RunCLI(os.Args[1:], os.Stdout, os.Stderr))
 }